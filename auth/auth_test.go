@@ -2,11 +2,26 @@ package auth
 
 import (
 	"crud-books/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func Test_GenAccessToken(t *testing.T) {
@@ -20,8 +35,470 @@ func Test_GenAccessToken(t *testing.T) {
 		RefreshTokenTTL: rTTL,
 	}
 
-	jwtEng := NewJwtEngine(&cfg)
+	jwtEng := newTestEngine(t, &cfg)
 	got, err := jwtEng.GenAccessToken(userId)
 	require.NoError(t, err)
 	fmt.Println(got)
 }
+
+var testConfig = config.Config{
+	JwtSecret:       "asd21531asda",
+	JwtIssuer:       "crud-books",
+	JwtAudience:     "crud-books",
+	JwtLeeway:       30 * time.Second,
+	AccessTokenTTL:  10 * time.Minute,
+	RefreshTokenTTL: 10 * time.Minute,
+}
+
+// serve runs the middleware on a request with the given Authorization header
+// and returns the response code and the user seen by the handler.
+func serve(mw echo.MiddlewareFunc, header string) (int, *User) {
+	req := httptest.NewRequest(http.MethodGet, "/books/", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	var user *User
+	mw(func(c echo.Context) error {
+		if u, ok := CurrentUser(c.Request().Context()); ok {
+			user = &u
+		}
+		return c.String(http.StatusOK, "")
+	})(c)
+	return rec.Code, user
+}
+
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func Test_AuthMiddlewares(t *testing.T) {
+	jwtEng := newTestEngine(t, &testConfig)
+	valid, err := jwtEng.GenAccessToken("12454161464")
+	require.NoError(t, err)
+
+	expiredEng := newTestEngine(t, &testConfig)
+	expiredEng.AccessTokenTTL = -time.Minute
+	expired, err := expiredEng.GenAccessToken("12454161464")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		header       string
+		wantRequired int
+		wantOptional int
+		wantUser     bool
+	}{
+		{name: "anonymous", header: "", wantRequired: http.StatusUnauthorized, wantOptional: http.StatusOK},
+		{name: "valid", header: "Bearer " + valid, wantRequired: http.StatusOK, wantOptional: http.StatusOK, wantUser: true},
+		{name: "malformed", header: "Bearer abc", wantRequired: http.StatusUnauthorized, wantOptional: http.StatusUnauthorized},
+		{name: "expired", header: "Bearer " + expired, wantRequired: http.StatusUnauthorized, wantOptional: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mw := range []struct {
+				middleware echo.MiddlewareFunc
+				want       int
+			}{
+				{jwtEng.RequireAuth(), tt.wantRequired},
+				{jwtEng.OptionalAuth(), tt.wantOptional},
+			} {
+				code, user := serve(mw.middleware, tt.header)
+				assert.Equal(t, mw.want, code)
+				assert.Equal(t, tt.wantUser, user != nil)
+				if tt.wantUser {
+					assert.Equal(t, "12454161464", user.Id)
+					assert.NotEmpty(t, user.TokenId)
+				}
+			}
+		})
+	}
+}
+
+func Test_Claims(t *testing.T) {
+	jwtEng := newTestEngine(t, &testConfig)
+	now := time.Now()
+	key := []byte(testConfig.JwtSecret)
+
+	claims := func(edit func(c *jwt.RegisteredClaims)) Claims {
+		c := jwt.RegisteredClaims{
+			Subject:   "12454161464",
+			Issuer:    testConfig.JwtIssuer,
+			Audience:  jwt.ClaimStrings{testConfig.JwtAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "1",
+		}
+		edit(&c)
+		return Claims{c}
+	}
+
+	refresh, err := jwtEng.GenRefreshToken()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{
+			name:   "valid",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) {})),
+			want:   http.StatusOK,
+		},
+		{
+			name:   "refresh token",
+			header: "Bearer " + refresh,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "other issuer",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) { c.Issuer = "someone" })),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "other audience",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other"} })),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name: "issued by a clock ahead within leeway",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) {
+				c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second))
+				c.IssuedAt = c.NotBefore
+			})),
+			want: http.StatusOK,
+		},
+		{
+			name: "not valid yet",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) {
+				c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute))
+			})),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "expired within leeway",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) {
+				c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+			})),
+			want: http.StatusOK,
+		},
+		{
+			name: "no expiry",
+			header: signed(t, jwt.SigningMethodHS256, key, claims(func(c *jwt.RegisteredClaims) {
+				c.ExpiresAt = nil
+			})),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:   "other signing method",
+			header: signed(t, jwt.SigningMethodHS512, key, claims(func(c *jwt.RegisteredClaims) {})),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "other key",
+			header: signed(t, jwt.SigningMethodHS256, []byte("other"), claims(func(c *jwt.RegisteredClaims) {})),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "legacy id claim",
+			header: signed(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"id": "12454161464", "exp": jwt.NewNumericDate(now.Add(time.Minute))}),
+			want:   http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := serve(jwtEng.RequireAuth(), tt.header)
+			assert.Equal(t, tt.want, code)
+		})
+	}
+}
+
+func newTestEngine(t *testing.T, cfg *config.Config) *jwtTokenEngine {
+	j, err := NewJwtEngine(cfg)
+	require.NoError(t, err)
+	return j
+}
+
+// writeKey stores the key in PEM form in dir and returns the file path.
+func writeKey(t *testing.T, dir, name string, k interface{}) string {
+	var block *pem.Block
+	switch k.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(dir, name+".pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	return path
+}
+
+func keysConfig(keys map[string]string, signingId string) *config.Config {
+	cfg := testConfig
+	cfg.JwtSecret = ""
+	cfg.JwtKeys = keys
+	cfg.JwtSigningKeyId = signingId
+	return &cfg
+}
+
+func Test_AsymmetricKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  interface{}
+		alg  string
+	}{
+		{name: "rsa", key: rsaKey, alg: "RS256"},
+		{name: "ed25519", key: edKey, alg: "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeKey(t, dir, tt.name, tt.key)
+			jwtEng := newTestEngine(t, keysConfig(map[string]string{"k1": path}, "k1"))
+
+			token, err := jwtEng.GenAccessToken("12454161464")
+			require.NoError(t, err)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Header["alg"])
+			assert.Equal(t, "k1", parsed.Header["kid"])
+
+			code, user := serve(jwtEng.RequireAuth(), "Bearer "+token)
+			assert.Equal(t, http.StatusOK, code)
+			require.NotNil(t, user)
+			assert.Equal(t, "12454161464", user.Id)
+		})
+	}
+}
+
+func Test_KeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	oldPrivate := writeKey(t, dir, "old", oldKey)
+	oldPublic := writeKey(t, dir, "old-public", &oldKey.PublicKey)
+	newPrivate := writeKey(t, dir, "new", newKey)
+
+	before := newTestEngine(t, keysConfig(map[string]string{"old": oldPrivate}, "old"))
+	oldToken, err := before.GenAccessToken("12454161464")
+	require.NoError(t, err)
+
+	// the old key is kept for verification only
+	during := newTestEngine(t, keysConfig(map[string]string{"old": oldPublic, "new": newPrivate}, "new"))
+	newToken, err := during.GenAccessToken("12454161464")
+	require.NoError(t, err)
+
+	after := newTestEngine(t, keysConfig(map[string]string{"new": newPrivate}, "new"))
+
+	code, _ := serve(during.RequireAuth(), "Bearer "+oldToken)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serve(during.RequireAuth(), "Bearer "+newToken)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serve(before.RequireAuth(), "Bearer "+newToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = serve(after.RequireAuth(), "Bearer "+oldToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func Test_KeysWithLegacySecret(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	path := writeKey(t, dir, "k1", rsaKey)
+	publicPEM, err := os.ReadFile(writeKey(t, dir, "k1-public", &rsaKey.PublicKey))
+	require.NoError(t, err)
+
+	legacy, err := newTestEngine(t, &testConfig).GenAccessToken("12454161464")
+	require.NoError(t, err)
+
+	withSecret := keysConfig(map[string]string{"k1": path}, "k1")
+	withSecret.JwtSecret = testConfig.JwtSecret
+	code, _ := serve(newTestEngine(t, withSecret).RequireAuth(), "Bearer "+legacy)
+	assert.Equal(t, http.StatusOK, code)
+
+	withoutSecret := newTestEngine(t, keysConfig(map[string]string{"k1": path}, "k1"))
+	code, _ = serve(withoutSecret.RequireAuth(), "Bearer "+legacy)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// the public key must not be accepted as an HMAC secret
+	claims, err := withoutSecret.newClaims(time.Minute)
+	require.NoError(t, err)
+	claims.Subject = "12454161464"
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "k1"
+	forgedString, err := forged.SignedString(publicPEM)
+	require.NoError(t, err)
+	code, _ = serve(newTestEngine(t, withSecret).RequireAuth(), "Bearer "+forgedString)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func Test_LoadKeys_Errors(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	private := writeKey(t, dir, "private", rsaKey)
+	public := writeKey(t, dir, "public", &rsaKey.PublicKey)
+	weak := writeKey(t, dir, "weak", weakKey)
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a key"), 0o600))
+
+	tests := []struct {
+		name      string
+		keys      map[string]string
+		signingId string
+	}{
+		{name: "unknown signing key", keys: map[string]string{"k1": private}, signingId: "k2"},
+		{name: "signing key without private part", keys: map[string]string{"k1": public}, signingId: "k1"},
+		{name: "missing file", keys: map[string]string{"k1": filepath.Join(dir, "nope.pem")}, signingId: "k1"},
+		{name: "not a pem file", keys: map[string]string{"k1": private, "k2": garbage}, signingId: "k1"},
+		{name: "weak rsa key", keys: map[string]string{"k1": weak}, signingId: "k1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJwtEngine(keysConfig(tt.keys, tt.signingId))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_JWKSHandler(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwtEng := newTestEngine(t, keysConfig(map[string]string{
+		"a": writeKey(t, dir, "rsa", rsaKey),
+		"b": writeKey(t, dir, "ed", edKey),
+	}, "b"))
+
+	get := func(j *jwtTokenEngine) JWKS {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil), rec)
+		require.NoError(t, j.JWKSHandler(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var set JWKS
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &set))
+		return set
+	}
+
+	set := get(jwtEng)
+	require.Len(t, set.Keys, 2)
+
+	assert.Equal(t, "a", set.Keys[0].Kid)
+	assert.Equal(t, "RSA", set.Keys[0].Kty)
+	assert.Equal(t, "RS256", set.Keys[0].Alg)
+	n, err := base64.RawURLEncoding.DecodeString(set.Keys[0].N)
+	require.NoError(t, err)
+	assert.Equal(t, rsaKey.N.Bytes(), n)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+
+	assert.Equal(t, "b", set.Keys[1].Kid)
+	assert.Equal(t, "OKP", set.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[1].Crv)
+	assert.Equal(t, "EdDSA", set.Keys[1].Alg)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(edPublic), set.Keys[1].X)
+
+	assert.Empty(t, get(newTestEngine(t, &testConfig)).Keys)
+}
+
+// cheapArgon2 keeps the tests fast, the default parameters need 64 MiB.
+var cheapArgon2 = argon2Params{memory: 1024, time: 1, threads: 1}
+
+func Test_HashEngine(t *testing.T) {
+	const password = "41uijaksjd"
+
+	bcryptEng := NewHashEngine(&config.Config{PasswordHashAlgorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+	argonEng := NewHashEngine(&config.Config{PasswordHashAlgorithm: AlgorithmArgon2id, BcryptCost: bcrypt.MinCost})
+	argonEng.argon2 = cheapArgon2
+
+	for _, eng := range []*hashEngine{bcryptEng, argonEng} {
+		t.Run(eng.algorithm, func(t *testing.T) {
+			hash, err := eng.GetNewHash(password)
+			require.NoError(t, err)
+
+			assert.NoError(t, eng.CompareHashWithPassword(password, hash))
+			assert.Error(t, eng.CompareHashWithPassword("wrong", hash))
+			assert.False(t, eng.NeedsRehash(hash))
+
+			// either engine verifies the hashes of the other while migrating
+			assert.NoError(t, bcryptEng.CompareHashWithPassword(password, hash))
+			assert.NoError(t, argonEng.CompareHashWithPassword(password, hash))
+		})
+	}
+}
+
+func Test_HashEngine_NeedsRehash(t *testing.T) {
+	const password = "41uijaksjd"
+
+	weakBcrypt, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	strongBcrypt, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost+1)
+	require.NoError(t, err)
+
+	weakArgonEng := &hashEngine{algorithm: AlgorithmArgon2id, argon2: cheapArgon2}
+	weakArgon, err := weakArgonEng.GetNewHash(password)
+	require.NoError(t, err)
+
+	bcryptEng := &hashEngine{algorithm: AlgorithmBcrypt, bcryptCost: bcrypt.MinCost + 1}
+	argonEng := &hashEngine{algorithm: AlgorithmArgon2id, argon2: argon2Params{memory: 2048, time: 1, threads: 1}}
+
+	tests := []struct {
+		name   string
+		engine *hashEngine
+		hash   string
+		want   bool
+	}{
+		{name: "bcrypt cost below configured", engine: bcryptEng, hash: string(weakBcrypt), want: true},
+		{name: "bcrypt cost as configured", engine: bcryptEng, hash: string(strongBcrypt), want: false},
+		{name: "bcrypt cost above configured", engine: &hashEngine{algorithm: AlgorithmBcrypt, bcryptCost: bcrypt.MinCost}, hash: string(strongBcrypt), want: false},
+		{name: "argon2 hash with bcrypt configured", engine: bcryptEng, hash: weakArgon, want: true},
+		{name: "bcrypt hash with argon2 configured", engine: argonEng, hash: string(strongBcrypt), want: true},
+		{name: "argon2 memory below configured", engine: argonEng, hash: weakArgon, want: true},
+		{name: "argon2 as configured", engine: weakArgonEng, hash: weakArgon, want: false},
+		{name: "unknown format", engine: bcryptEng, hash: "plain", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.engine.NeedsRehash(tt.hash))
+		})
+	}
+}
+
+func Test_CompareArgon2_Malformed(t *testing.T) {
+	eng := &hashEngine{algorithm: AlgorithmArgon2id, argon2: cheapArgon2}
+	hash, err := eng.GetNewHash("41uijaksjd")
+	require.NoError(t, err)
+
+	for _, bad := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$salt",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5",
+		hash[:len(hash)-2] + "!!",
+	} {
+		assert.Error(t, eng.CompareHashWithPassword("41uijaksjd", bad), bad)
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Claims are the claims of the tokens issued by the app. The subject of an
+// access token is the user id; refresh tokens have no subject.
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// User is the authenticated user of a request.
+type User struct {
+	Id      string
+	TokenId string
+}
+
+type userCtxKey struct{}
+
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userCtxKey{}, user)
+}
+
+// CurrentUser returns the user authenticated by the auth middleware, ok is
+// false for anonymous requests.
+func CurrentUser(ctx context.Context) (user User, ok bool) {
+	user, ok = ctx.Value(userCtxKey{}).(User)
+	return user, ok
+}
+
+// validate checks the claims of an access token at now, tolerating clocks
+// that are off by up to leeway.
+func (c Claims) validate(now time.Time, issuer, audience string, leeway time.Duration) error {
+	if !c.VerifyExpiresAt(now.Add(-leeway), true) {
+		return errors.New("token is expired")
+	}
+	if !c.VerifyNotBefore(now.Add(leeway), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !c.VerifyIssuedAt(now.Add(leeway), false) {
+		return errors.New("token used before issued")
+	}
+	if !c.VerifyIssuer(issuer, true) {
+		return fmt.Errorf("unexpected token issuer %q", c.Issuer)
+	}
+	if !c.VerifyAudience(audience, true) {
+		return errors.New("token isn't meant for this audience")
+	}
+	if c.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	return nil
+}
+
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating token id failed, error: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,15 +1,53 @@
 package auth
 
 import (
+	"crud-books/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type hashEngine struct{}
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// argon2Params are the argon2id settings recommended by RFC 9106 for memory
+// constrained environments.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+var defaultArgon2Params = argon2Params{memory: 64 * 1024, time: 3, threads: 4}
+
+// hashEngine hashes new passwords with the configured algorithm and checks
+// passwords against hashes made by any supported one, so users can be moved
+// to another algorithm or cost as they sign in.
+type hashEngine struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+}
 
 func (h hashEngine) GetNewHash(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if h.algorithm == AlgorithmArgon2id {
+		return h.argon2Hash(password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
 	if err != nil {
 		return "", fmt.Errorf("failed generate hash, error: %w", err)
 	}
@@ -17,9 +55,93 @@ func (h hashEngine) GetNewHash(password string) (string, error) {
 }
 
 func (h hashEngine) CompareHashWithPassword(password, hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return compareArgon2(password, hash)
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func NewHashEngine() *hashEngine {
-	return &hashEngine{}
+func (h hashEngine) NeedsRehash(hash string) bool {
+	if h.algorithm == AlgorithmArgon2id {
+		params, _, _, err := parseArgon2(hash)
+		if err != nil {
+			return true
+		}
+		return params.memory < h.argon2.memory || params.time < h.argon2.time || params.threads < h.argon2.threads
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < h.bcryptCost
+}
+
+func (h hashEngine) argon2Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed generate salt, error: %w", err)
+	}
+
+	p := h.argon2
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+
+	// PHC string format, as produced by the reference implementation
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func compareArgon2(password, hash string) error {
+	p, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errors.New("password doesn't match the hash")
+	}
+	return nil
+}
+
+func parseArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return p, nil, nil, errUnknownHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("parsing argon2 parameters failed, error: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("decoding argon2 salt failed, error: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("decoding argon2 key failed, error: %w", err)
+	}
+	return p, salt, key, nil
+}
+
+func NewHashEngine(cfg *config.Config) *hashEngine {
+	return &hashEngine{
+		algorithm:  cfg.PasswordHashAlgorithm,
+		bcryptCost: cfg.BcryptCost,
+		argon2:     defaultArgon2Params,
+	}
 }
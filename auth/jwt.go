@@ -3,7 +3,6 @@ package auth
 import (
 	"crud-books/config"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -13,32 +12,48 @@ import (
 )
 
 type jwtTokenEngine struct {
-	signingKey      []byte
+	// secret signs HS256 tokens when no keys are configured. With keys it
+	// only verifies the tokens issued before the switch.
+	secret          []byte
+	keys            *keySet
+	issuer          string
+	audience        string
+	leeway          time.Duration
+	now             func() time.Time
 	AccessTokenTTL  time.Duration
 	RefreshTokenTTL time.Duration
 }
 
-func NewJwtEngine(cfg *config.Config) *jwtTokenEngine {
+func NewJwtEngine(cfg *config.Config) (*jwtTokenEngine, error) {
+	var keys *keySet
+	if len(cfg.JwtKeys) > 0 {
+		var err error
+		keys, err = loadKeys(cfg.JwtKeys, cfg.JwtSigningKeyId)
+		if err != nil {
+			return nil, fmt.Errorf("loading jwt keys failed, error: %w", err)
+		}
+	}
+
 	return &jwtTokenEngine{
-		signingKey:      []byte(cfg.JwtSecret),
+		secret:          []byte(cfg.JwtSecret),
+		keys:            keys,
+		issuer:          cfg.JwtIssuer,
+		audience:        cfg.JwtAudience,
+		leeway:          cfg.JwtLeeway,
+		now:             time.Now,
 		AccessTokenTTL:  cfg.AccessTokenTTL,
 		RefreshTokenTTL: cfg.RefreshTokenTTL,
-	}
+	}, nil
 }
 
 func (j jwtTokenEngine) GenAccessToken(userId string) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("getting access token claims failed")
+	claims, err := j.newClaims(j.AccessTokenTTL)
+	if err != nil {
+		return "", err
 	}
+	claims.Subject = userId
 
-	t := time.Time.Add(time.Now(), j.AccessTokenTTL)
-	claims["id"] = userId
-	claims["exp"] = jwt.NewNumericDate(t)
-
-	signedToken, err := token.SignedString(j.signingKey)
+	signedToken, err := j.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("singing token failed, error: %w", err)
 	}
@@ -47,17 +62,12 @@ func (j jwtTokenEngine) GenAccessToken(userId string) (string, error) {
 }
 
 func (j jwtTokenEngine) GenRefreshToken() (string, error) {
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-
-	claims, ok := refreshToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("getting refresh token claims falied")
+	claims, err := j.newClaims(j.RefreshTokenTTL)
+	if err != nil {
+		return "", err
 	}
 
-	t := time.Time.Add(time.Now(), j.RefreshTokenTTL)
-	claims["exp"] = jwt.NewNumericDate(t)
-
-	signedToken, err := refreshToken.SignedString(j.signingKey)
+	signedToken, err := j.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("refresh token signing failed, error: %w", err)
 	}
@@ -65,46 +75,126 @@ func (j jwtTokenEngine) GenRefreshToken() (string, error) {
 	return signedToken, nil
 }
 
-func (j jwtTokenEngine) GetMiddleware() echo.MiddlewareFunc {
+func (j jwtTokenEngine) newClaims(ttl time.Duration) (Claims, error) {
+	id, err := newTokenId()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	now := j.now()
+	return Claims{jwt.RegisteredClaims{
+		Issuer:    j.issuer,
+		Audience:  jwt.ClaimStrings{j.audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        id,
+	}}, nil
+}
+
+// sign signs the claims with the signing key, naming it in the kid header.
+func (j jwtTokenEngine) sign(claims Claims) (string, error) {
+	if j.keys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.secret)
+	}
+
+	token := jwt.NewWithClaims(j.keys.signing.method, claims)
+	token.Header["kid"] = j.keys.signing.id
+	return token.SignedString(j.keys.signing.private)
+}
+
+// verificationKey picks the key a token was signed with. The algorithm must
+// be the one of the key, so a public key can't be used as an HMAC secret.
+func (j jwtTokenEngine) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, hasKid := t.Header["kid"].(string)
+	if !hasKid || j.keys == nil {
+		if t.Method != jwt.SigningMethodHS256 || len(j.secret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return j.secret, nil
+	}
+
+	k, ok := j.keys.byId[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", t.Header["alg"], kid)
+	}
+	return k.public, nil
+}
+
+func (j jwtTokenEngine) validMethods() []string {
+	var methods []string
+	if len(j.secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if j.keys != nil {
+		methods = append(methods, j.keys.methods()...)
+	}
+	return methods
+}
+
+// JWKSHandler serves the public keys tokens are verified with, so other
+// services can check them without sharing a secret.
+func (j jwtTokenEngine) JWKSHandler(c echo.Context) error {
+	if j.keys == nil {
+		return c.JSON(http.StatusOK, JWKS{Keys: []JWK{}})
+	}
+	return c.JSON(http.StatusOK, j.keys.jwks())
+}
+
+// RequireAuth rejects requests without a valid access token and puts the
+// user into the request context, see CurrentUser.
+func (j jwtTokenEngine) RequireAuth() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
-			rPath := c.Request().URL.Path
-
-			log.Println(rPath)
-
-			if rPath == "/login" || rPath == "/register" {
-				return next(c)
+			if authHeader == "" {
+				return c.String(http.StatusUnauthorized, "missing token")
 			}
-			if rPath == "/books" && authHeader == "" {
+			return j.authenticate(c, authHeader, next)
+		}
+	}
+}
+
+// OptionalAuth lets anonymous requests through and authenticates the others
+// like RequireAuth. A token that was sent but is invalid is still rejected,
+// so a client never gets anonymous results by mistake.
+func (j jwtTokenEngine) OptionalAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" {
 				return next(c)
 			}
+			return j.authenticate(c, authHeader, next)
+		}
+	}
+}
 
-			tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-
-			tokenParts := strings.Split(tokenString, ".")
-			if len(tokenParts) != 3 {
-				return c.String(http.StatusUnauthorized, "malformed token")
-			}
+func (j jwtTokenEngine) authenticate(c echo.Context, authHeader string, next echo.HandlerFunc) error {
+	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
-			token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-				_, ok := t.Method.(*jwt.SigningMethodHMAC)
-				if !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-				}
-				return []byte(j.signingKey), nil
-			})
-			if err != nil {
-				return c.String(http.StatusUnauthorized, err.Error())
-			}
+	tokenParts := strings.Split(tokenString, ".")
+	if len(tokenParts) != 3 {
+		return c.String(http.StatusUnauthorized, "malformed token")
+	}
 
-			_, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				return c.String(http.StatusUnauthorized, "JWT claims invalid")
-			}
+	// time based claims are checked by validate, which allows for clock skew
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, j.verificationKey,
+		jwt.WithValidMethods(j.validMethods()), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
 
-			c.Set("user", token)
-			return next(c)
-		}
+	err = claims.validate(j.now(), j.issuer, j.audience, j.leeway)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, err.Error())
 	}
+
+	ctx := WithUser(c.Request().Context(), User{Id: claims.Subject, TokenId: claims.ID})
+	c.SetRequest(c.Request().WithContext(ctx))
+	return next(c)
 }
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minRSABits = 2048
+
+// key is a key tokens are verified with, identified by the kid header. Only
+// the signing key needs the private part.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// keySet holds every key accepted for verification. Rotating means adding a
+// new key, making it the signing one and dropping the old key once the tokens
+// it signed have expired.
+type keySet struct {
+	signing *key
+	byId    map[string]*key
+}
+
+// loadKeys reads PEM encoded keys from the files, indexed by key id.
+func loadKeys(files map[string]string, signingId string) (*keySet, error) {
+	set := keySet{byId: make(map[string]*key, len(files))}
+	for id, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading key %q failed, error: %w", id, err)
+		}
+		k, err := parseKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key %q failed, error: %w", id, err)
+		}
+		set.byId[id] = k
+	}
+
+	signing, ok := set.byId[signingId]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q isn't configured", signingId)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("signing key %q has no private part", signingId)
+	}
+	set.signing = signing
+	return &set, nil
+}
+
+func parseKey(id string, data []byte) (*key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := key{id: id}
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.private, k.public = v, &v.PublicKey
+	case *rsa.PublicKey:
+		k.public = v
+	case ed25519.PrivateKey:
+		k.private, k.public = v, v.Public()
+	case ed25519.PublicKey:
+		k.public = v
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is shorter than %d bits", minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	}
+	return &k, nil
+}
+
+// methods returns the algorithms of the keys in the set.
+func (s keySet) methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, k := range s.byId {
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK is the public part of a key as described in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (s keySet) jwks() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(s.byId))}
+	for _, k := range s.byId {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -1,58 +1,175 @@
 package main
 
 import (
+	"context"
 	"crud-books/auth"
 	"crud-books/config"
 	"crud-books/handlers"
+	"crud-books/logging"
 	"crud-books/mongodb"
 	"crud-books/server"
 	"crud-books/services"
 	"crud-books/storage"
-	"log"
+	"crud-books/thumbnail"
+	"crud-books/tracing"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
-	cfg, err := config.New()
-	if err != nil {
-		log.Fatalf("config initializing: %v", err)
-	}
-	err = cfg.Validate()
-	if err != nil {
-		log.Fatalf("config validation: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(os.Args[2:])
+		return
 	}
 
-	db := mongodb.New()
-	err = db.Connect(cfg)
-	if err != nil {
-		log.Fatalf("database init: %v", err)
-	}
-	err = db.Ping()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg := loadConfig()
+	logger := newLogger(cfg, os.Stdout)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
 	if err != nil {
-		log.Fatalf("database ping: %v", err)
+		fatal(logger, "tracing init", err)
 	}
 
-	storage := storage.New(cfg)
+	db := connectDB(cfg, logger)
 
-	jwtEngine := auth.NewJwtEngine(cfg)
-	hashEngine := auth.NewHashEngine()
+	storage := storage.New(cfg, logger)
 
-	services := services.New(db, jwtEngine, storage, hashEngine)
-
-	handlers := handlers.New(services)
+	jwtEngine, err := auth.NewJwtEngine(cfg)
 	if err != nil {
-		log.Fatalf("handlers init: %v", err)
+		fatal(logger, "jwt engine init", err)
 	}
+	hashEngine := auth.NewHashEngine(cfg)
+	thumbnailer := thumbnail.New(cfg)
+
+	services := services.New(db, jwtEngine, storage, hashEngine, thumbnailer, logger)
+	services.UseUserFolders(cfg.StorageUserFolders)
+
+	// workers outlive the signal so requests being drained can still hand
+	// them work, and are stopped once the server is down
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workersCtx)
+		}()
+	}
+	runWorker(func(ctx context.Context) {
+		services.RunContentIndexer(ctx, cfg.ContentIndexInterval)
+	})
+	runWorker(func(ctx context.Context) {
+		services.RunFileDeletions(ctx, cfg.FileGCInterval)
+	})
+	runWorker(func(ctx context.Context) {
+		services.RunOrphanFilesGC(ctx, cfg.FileGCInterval, cfg.OrphanFileMaxAge)
+	})
+	runWorker(func(ctx context.Context) {
+		services.RunTrashPurge(ctx, cfg.FileGCInterval, cfg.TrashRetention)
+	})
+
+	handlers := handlers.New(services, logger)
 
 	srv := server.New(
 		cfg.ServerPort,
 		cfg.JwtSecret,
-		jwtEngine.GetMiddleware(),
+		jwtEngine,
+		cfg.RequestTimeout,
+		logger,
 	)
 	srv.InitMiddlewares()
 	srv.UseRouters(handlers)
 
-	err = srv.Start()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.Start()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			logger.Error("server isn't started", "error", err)
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		logger.Info("shutting down, draining requests", "timeout", cfg.ShutdownTimeout)
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Error("server shutdown", "error", err)
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	err = db.Disconnect(shutdownCtx)
+	if err != nil {
+		logger.Error("database disconnect", "error", err)
+	}
+
+	err = shutdownTracing(shutdownCtx)
 	if err != nil {
-		log.Fatalf("server isn't started: %v", err)
+		logger.Error("tracing shutdown", "error", err)
+	}
+	logger.Info("stopped")
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
+
+func loadConfig() *config.Config {
+	cfg, err := config.New()
+	if err != nil {
+		fatal(slog.Default(), "config initializing", err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		fatal(slog.Default(), "config validation", err)
+	}
+	return cfg
+}
+
+func connectDB(cfg *config.Config, logger *slog.Logger) *mongodb.MongoDB {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	db := mongodb.New()
+	err := db.Connect(ctx, cfg)
+	if err != nil {
+		fatal(logger, "database init", err)
+	}
+	err = db.Ping(ctx)
+	if err != nil {
+		fatal(logger, "database ping", err)
+	}
+	return db
+}
+
+func newLogger(cfg *config.Config, w io.Writer) *slog.Logger {
+	logger, err := logging.New(w, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fatal(slog.Default(), "logger init", err)
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"crud-books/models"
+	"crud-books/services"
+	"crud-books/storage"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+)
+
+// runReconcile checks the database against the storage, prints the report as
+// JSON and exits with status 1 when something is left unrepaired.
+func runReconcile(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "repair what can be repaired")
+	flags.Parse(args)
+
+	cfg := loadConfig()
+	// stdout is reserved for the report
+	logger := newLogger(cfg, os.Stderr)
+	db := connectDB(cfg, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	services := services.New(db, nil, storage.New(cfg, logger), nil, nil, logger)
+	report, err := services.Reconcile(ctx, *fix)
+	if err != nil {
+		fatal(logger, "reconcile", err)
+	}
+
+	err = db.Disconnect(context.Background())
+	if err != nil {
+		logger.Error("database disconnect", "error", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		fatal(logger, "writing report", err)
+	}
+
+	if !resolved(report.Missing) || !resolved(report.Dangling) || !resolved(report.Orphans) {
+		os.Exit(1)
+	}
+}
+
+func resolved(entries []models.ReconcileEntry) bool {
+	for _, e := range entries {
+		if !e.Fixed {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,8 +18,36 @@ type Config struct {
 	DatabaseLogin       string
 	DatabasePwd         string
 	JwtSecret           string
+	JwtIssuer           string
+	JwtAudience         string
+	JwtLeeway           time.Duration
+	JwtKeys             map[string]string
+	JwtSigningKeyId     string
 	AccessTokenTTL      time.Duration
 	RefreshTokenTTL     time.Duration
+	RequestTimeout      time.Duration
+	ShutdownTimeout     time.Duration
+	PdftoppmPath        string
+	LogLevel            string
+	LogFormat           string
+	FileGCInterval      time.Duration
+	OrphanFileMaxAge    time.Duration
+	TrashRetention      time.Duration
+
+	StorageTimeout       time.Duration
+	StorageUploadTimeout time.Duration
+	StorageMaxRetries    int
+	StorageUserFolders   bool
+
+	TracingExporter    string
+	TracingEndpoint    string
+	TracingInsecure    bool
+	TracingSampleRatio float64
+
+	ContentIndexInterval time.Duration
+
+	PasswordHashAlgorithm string
+	BcryptCost            int
 }
 
 func New() (*Config, error) {
@@ -31,6 +61,81 @@ func New() (*Config, error) {
 		return nil, fmt.Errorf("parse refresh token duration: %w", err)
 	}
 
+	RequestTimeout, err := durationOrDefault("REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("parse request timeout: %w", err)
+	}
+
+	JwtLeeway, err := durationOrDefault("JWT_LEEWAY", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt leeway: %w", err)
+	}
+
+	JwtKeys, err := keyValueList("JWT_KEYS")
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt keys: %w", err)
+	}
+
+	ShutdownTimeout, err := durationOrDefault("SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("parse shutdown timeout: %w", err)
+	}
+
+	FileGCInterval, err := durationOrDefault("FILE_GC_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("parse file gc interval: %w", err)
+	}
+
+	OrphanFileMaxAge, err := durationOrDefault("ORPHAN_FILE_MAX_AGE", 24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("parse orphan file max age: %w", err)
+	}
+
+	TrashRetention, err := durationOrDefault("TRASH_RETENTION", 30*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("parse trash retention: %w", err)
+	}
+
+	ContentIndexInterval, err := durationOrDefault("CONTENT_INDEX_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("parse content index interval: %w", err)
+	}
+
+	StorageTimeout, err := durationOrDefault("GOFILE_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("parse gofile timeout: %w", err)
+	}
+
+	StorageUploadTimeout, err := durationOrDefault("GOFILE_UPLOAD_TIMEOUT", 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("parse gofile upload timeout: %w", err)
+	}
+
+	StorageMaxRetries, err := intOrDefault("GOFILE_MAX_RETRIES", 3)
+	if err != nil {
+		return nil, fmt.Errorf("parse gofile max retries: %w", err)
+	}
+
+	StorageUserFolders, err := boolOrDefault("GOFILE_USER_FOLDERS", false)
+	if err != nil {
+		return nil, fmt.Errorf("parse gofile user folders: %w", err)
+	}
+
+	TracingInsecure, err := boolOrDefault("TRACING_OTLP_INSECURE", false)
+	if err != nil {
+		return nil, fmt.Errorf("parse tracing otlp insecure: %w", err)
+	}
+
+	TracingSampleRatio, err := floatOrDefault("TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, fmt.Errorf("parse tracing sample ratio: %w", err)
+	}
+
+	BcryptCost, err := intOrDefault("BCRYPT_COST", 12)
+	if err != nil {
+		return nil, fmt.Errorf("parse bcrypt cost: %w", err)
+	}
+
 	cfg := Config{
 		ServerPort:          os.Getenv("SERVER_PORT"),
 		GoFileServiceApiKey: os.Getenv("GOFILE_SERVICE_API_KEY"),
@@ -41,13 +146,49 @@ func New() (*Config, error) {
 		DatabaseLogin:       os.Getenv("DB_LOGIN"),
 		DatabasePwd:         os.Getenv("DB_PWD"),
 		JwtSecret:           os.Getenv("JWT_SECRET"),
+		JwtIssuer:           stringOrDefault("JWT_ISSUER", "crud-books"),
+		JwtAudience:         stringOrDefault("JWT_AUDIENCE", "crud-books"),
+		JwtLeeway:           JwtLeeway,
+		JwtKeys:             JwtKeys,
+		JwtSigningKeyId:     os.Getenv("JWT_SIGNING_KEY_ID"),
 		AccessTokenTTL:      AccessTokenTTL,
 		RefreshTokenTTL:     RefreshTokenTTL,
+		RequestTimeout:      RequestTimeout,
+		ShutdownTimeout:     ShutdownTimeout,
+		PdftoppmPath:        os.Getenv("PDFTOPPM_PATH"),
+		LogLevel:            stringOrDefault("LOG_LEVEL", "info"),
+		LogFormat:           stringOrDefault("LOG_FORMAT", "json"),
+		FileGCInterval:      FileGCInterval,
+		OrphanFileMaxAge:    OrphanFileMaxAge,
+		TrashRetention:      TrashRetention,
+
+		StorageTimeout:       StorageTimeout,
+		StorageUploadTimeout: StorageUploadTimeout,
+		StorageMaxRetries:    StorageMaxRetries,
+		StorageUserFolders:   StorageUserFolders,
+
+		TracingExporter:    stringOrDefault("TRACING_EXPORTER", "none"),
+		TracingEndpoint:    stringOrDefault("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		TracingInsecure:    TracingInsecure,
+		TracingSampleRatio: TracingSampleRatio,
+
+		ContentIndexInterval: ContentIndexInterval,
+
+		PasswordHashAlgorithm: stringOrDefault("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		BcryptCost:            BcryptCost,
 	}
 
 	return &cfg, nil
 }
 
+func durationOrDefault(env string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
+
 func (c *Config) Validate() error {
 	if c.ServerPort == "" {
 		return fmt.Errorf("serverport env is empty")
@@ -70,11 +211,16 @@ func (c *Config) Validate() error {
 	if c.DatabaseLogin == "" {
 		return fmt.Errorf("databaseLogin env is empty")
 	}
-	if c.JwtSecret == "" {
+	if c.DatabasePwd == "" {
 		return fmt.Errorf("databasePwd env is empty")
 	}
-	if c.DatabaseHost == "" {
-		return fmt.Errorf("jwtSecret env is empty")
+	if c.JwtSecret == "" && len(c.JwtKeys) == 0 {
+		return fmt.Errorf("jwtSecret env is empty and no jwt keys are configured")
+	}
+	if len(c.JwtKeys) > 0 {
+		if _, ok := c.JwtKeys[c.JwtSigningKeyId]; !ok {
+			return fmt.Errorf("jwtSigningKeyId env must name one of jwtKeys")
+		}
 	}
 	if c.AccessTokenTTL == 0 {
 		return fmt.Errorf("accessTokenTTL env is empty or null")
@@ -82,5 +228,94 @@ func (c *Config) Validate() error {
 	if c.RefreshTokenTTL == 0 {
 		return fmt.Errorf("refreshTokenTTL env is empty or null")
 	}
+	if c.JwtLeeway < 0 {
+		return fmt.Errorf("jwtLeeway env must not be negative")
+	}
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("requestTimeout env must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdownTimeout env must be positive")
+	}
+	if c.FileGCInterval <= 0 {
+		return fmt.Errorf("fileGCInterval env must be positive")
+	}
+	if c.OrphanFileMaxAge <= 0 {
+		return fmt.Errorf("orphanFileMaxAge env must be positive")
+	}
+	if c.TrashRetention <= 0 {
+		return fmt.Errorf("trashRetention env must be positive")
+	}
+	if c.ContentIndexInterval <= 0 {
+		return fmt.Errorf("contentIndexInterval env must be positive")
+	}
+	if c.StorageTimeout <= 0 || c.StorageUploadTimeout <= 0 {
+		return fmt.Errorf("gofile timeouts must be positive")
+	}
+	if c.StorageMaxRetries < 0 {
+		return fmt.Errorf("gofileMaxRetries env must not be negative")
+	}
+	if c.TracingExporter != "none" && c.TracingExporter != "otlp" {
+		return fmt.Errorf("tracingExporter env must be none or otlp")
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return fmt.Errorf("tracingSampleRatio env must be between 0 and 1")
+	}
+	if c.PasswordHashAlgorithm != "bcrypt" && c.PasswordHashAlgorithm != "argon2id" {
+		return fmt.Errorf("passwordHashAlgorithm env must be bcrypt or argon2id")
+	}
+	if c.BcryptCost < 4 || c.BcryptCost > 31 {
+		return fmt.Errorf("bcryptCost env must be between 4 and 31")
+	}
 	return nil
 }
+
+func intOrDefault(env string, def int) (int, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func boolOrDefault(env string, def bool) (bool, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func floatOrDefault(env string, def float64) (float64, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// keyValueList parses "key=value,key=value" pairs.
+func keyValueList(env string) (map[string]string, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil, nil
+	}
+
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%q isn't a key=value pair", pair)
+		}
+		pairs[k] = v
+	}
+	return pairs, nil
+}
+
+func stringOrDefault(env string, def string) string {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+	return value
+}
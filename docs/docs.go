@@ -0,0 +1,32 @@
+// Package docs serves the OpenAPI specification of the API and a Swagger UI
+// page rendering it. The specification is maintained by hand in
+// openapi.json, next to the routes in server.UseRouters.
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler serves the OpenAPI document.
+func SpecHandler(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, spec)
+}
+
+// UIHandler serves the Swagger UI page. Its assets are loaded from a CDN.
+func UIHandler(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, swaggerUI)
+}
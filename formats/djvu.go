@@ -0,0 +1,235 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const MimeDJVU = "image/vnd.djvu"
+
+var djvuFormat = Format{
+	Name:       "djvu",
+	MimeType:   MimeDJVU,
+	Extensions: []string{"djvu", "djv"},
+	Detect:     detectDjvu,
+	Validate: func(data []byte) error {
+		_, err := parseDjvu(data)
+		return err
+	},
+	ExtractMetadata: djvuMetadata,
+	ExtractText:     djvuText,
+}
+
+func detectDjvu(data []byte) bool {
+	if len(data) < 16 || !bytes.HasPrefix(data, []byte("AT&TFORM")) {
+		return false
+	}
+	kind := string(data[12:16])
+	return kind == "DJVU" || kind == "DJVM"
+}
+
+type iffChunk struct {
+	id       string
+	kind     string
+	data     []byte
+	children []iffChunk
+}
+
+// parseDjvu reads the IFF85 chunk tree that follows the "AT&T" magic.
+func parseDjvu(data []byte) (*iffChunk, error) {
+	if !detectDjvu(data) {
+		return nil, ErrUnsupported
+	}
+
+	chunks, err := parseIffChunks(data[4:], 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+	}
+	if len(chunks) == 0 || chunks[0].id != "FORM" {
+		return nil, fmt.Errorf("%w: root FORM chunk is missing", ErrCorrupted)
+	}
+	root := &chunks[0]
+
+	switch root.kind {
+	case "DJVU":
+		if len(root.children) == 0 || root.children[0].id != "INFO" {
+			return nil, fmt.Errorf("%w: page has no INFO chunk", ErrCorrupted)
+		}
+	case "DJVM":
+		if len(root.children) == 0 || root.children[0].id != "DIRM" {
+			return nil, fmt.Errorf("%w: document has no DIRM chunk", ErrCorrupted)
+		}
+	}
+
+	return root, nil
+}
+
+func parseIffChunks(data []byte, depth int) ([]iffChunk, error) {
+	if depth > 8 {
+		return nil, fmt.Errorf("chunks are nested too deep")
+	}
+
+	var chunks []iffChunk
+	for pos := 0; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		start := pos + 8
+		if size < 0 || start+size > len(data) {
+			return nil, fmt.Errorf("chunk %s at offset %d exceeds file size", id, pos)
+		}
+
+		chunk := iffChunk{id: id, data: data[start : start+size]}
+		if id == "FORM" {
+			if size < 4 {
+				return nil, fmt.Errorf("FORM chunk at offset %d is too short", pos)
+			}
+			chunk.kind = string(chunk.data[:4])
+			children, err := parseIffChunks(chunk.data[4:], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			chunk.children = children
+		}
+		chunks = append(chunks, chunk)
+
+		pos = start + size
+		if pos%2 == 1 {
+			pos++
+		}
+	}
+	return chunks, nil
+}
+
+func (c *iffChunk) pages() []*iffChunk {
+	if c.kind == "DJVU" {
+		return []*iffChunk{c}
+	}
+	var pages []*iffChunk
+	for i := range c.children {
+		if c.children[i].id == "FORM" && c.children[i].kind == "DJVU" {
+			pages = append(pages, &c.children[i])
+		}
+	}
+	return pages
+}
+
+func (c *iffChunk) find(id string) *iffChunk {
+	for i := range c.children {
+		if c.children[i].id == id {
+			return &c.children[i]
+		}
+		if found := c.children[i].find(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func djvuMetadata(data []byte) (*Metadata, error) {
+	root, err := parseDjvu(data)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{
+		Pages: len(root.pages()),
+		Size:  int64(len(data)),
+	}
+	// Indirect multi-page documents keep the pages in separate files, the
+	// DIRM chunk still knows how many components there are.
+	if meta.Pages == 0 && root.kind == "DJVM" {
+		dirm := root.children[0].data
+		if len(dirm) >= 3 {
+			meta.Pages = int(binary.BigEndian.Uint16(dirm[1:3]))
+		}
+	}
+
+	if metaChunk := root.find("METa"); metaChunk != nil {
+		fields := parseDjvuMeta(metaChunk.data)
+		meta.Title = fields["title"]
+		meta.Author = fields["author"]
+		meta.Subject = fields["subject"]
+		meta.Keywords = fields["keywords"]
+		meta.CreationDate = parseLooseDate(fields["year"])
+	}
+
+	return meta, nil
+}
+
+// parseDjvuMeta reads the plain text "(metadata (key "value") ...)"
+// annotation. Compressed METz chunks aren't supported.
+func parseDjvuMeta(data []byte) map[string]string {
+	fields := map[string]string{}
+	s := string(data)
+	idx := strings.Index(s, "(metadata")
+	if idx < 0 {
+		return fields
+	}
+	s = s[idx+len("(metadata"):]
+
+	for {
+		open := strings.IndexByte(s, '(')
+		if open < 0 {
+			break
+		}
+		s = s[open+1:]
+		key := strings.TrimSpace(s[:strings.IndexAny(s+" ", " \t\n\"")])
+		quote := strings.IndexByte(s, '"')
+		if quote < 0 {
+			break
+		}
+		value, rest, ok := readQuoted(s[quote:])
+		if !ok {
+			break
+		}
+		fields[strings.ToLower(key)] = value
+		s = rest
+	}
+	return fields
+}
+
+func readQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '"' {
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				value = s[1:i]
+			}
+			return value, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func djvuText(data []byte) ([]string, error) {
+	root, err := parseDjvu(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := root.pages()
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		txt := page.find("TXTa")
+		if txt == nil || len(txt.data) < 3 {
+			continue
+		}
+		length := int(txt.data[0])<<16 | int(txt.data[1])<<8 | int(txt.data[2])
+		if 3+length > len(txt.data) {
+			continue
+		}
+		text := txt.data[3 : 3+length]
+		if utf8.Valid(text) {
+			texts[i] = strings.TrimSpace(string(text))
+		}
+	}
+	return texts, nil
+}
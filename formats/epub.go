@@ -0,0 +1,265 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	MimeEPUB = "application/epub+zip"
+
+	epubContainerPath  = "META-INF/container.xml"
+	epubEncryptionPath = "META-INF/encryption.xml"
+	maxEpubEntrySize   = 16 << 20
+)
+
+// Font obfuscation algorithms are allowed in encryption.xml of books without
+// DRM, any other algorithm means the content can't be read.
+var epubObfuscationAlgorithms = map[string]bool{
+	"http://www.idpf.org/2008/embedding": true,
+	"http://ns.adobe.com/pdf/enc#RC":     true,
+}
+
+var epubFormat = Format{
+	Name:       "epub",
+	MimeType:   MimeEPUB,
+	Extensions: []string{"epub"},
+	Detect:     detectEpub,
+	Validate: func(data []byte) error {
+		_, err := openEpub(data)
+		return err
+	},
+	ExtractMetadata: epubMetadata,
+	ExtractText:     epubText,
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubEncryption struct {
+	Methods []struct {
+		Algorithm string `xml:"Algorithm,attr"`
+	} `xml:"EncryptedData>EncryptionMethod"`
+}
+
+type epubPackage struct {
+	Metadata struct {
+		Titles       []string `xml:"title"`
+		Creators     []string `xml:"creator"`
+		Subjects     []string `xml:"subject"`
+		Descriptions []string `xml:"description"`
+		Dates        []string `xml:"date"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Id   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IdRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type epubBook struct {
+	zip     *zip.Reader
+	opfPath string
+	pkg     epubPackage
+}
+
+// detectEpub checks that the first zip entry is an uncompressed "mimetype"
+// file with the EPUB media type, as the OCF specification requires.
+func detectEpub(data []byte) bool {
+	if len(data) < 30 || !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return false
+	}
+	nameLen := int(binary.LittleEndian.Uint16(data[26:28]))
+	extraLen := int(binary.LittleEndian.Uint16(data[28:30]))
+	if len(data) < 30+nameLen+extraLen {
+		return false
+	}
+	if string(data[30:30+nameLen]) != "mimetype" {
+		return false
+	}
+	return bytes.HasPrefix(data[30+nameLen+extraLen:], []byte(MimeEPUB))
+}
+
+func openEpub(data []byte) (*epubBook, error) {
+	if !detectEpub(data) {
+		return nil, ErrUnsupported
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+	}
+	book := &epubBook{zip: zr}
+
+	encryption, err := book.read(epubEncryptionPath)
+	if err == nil {
+		var enc epubEncryption
+		if xml.Unmarshal(encryption, &enc) == nil {
+			for _, m := range enc.Methods {
+				if !epubObfuscationAlgorithms[m.Algorithm] {
+					return nil, ErrEncrypted
+				}
+			}
+		}
+	}
+
+	containerData, err := book.read(epubContainerPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+	}
+	var container epubContainer
+	err = xml.Unmarshal(containerData, &container)
+	if err != nil || len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("%w: container.xml has no rootfile", ErrCorrupted)
+	}
+
+	book.opfPath = container.Rootfiles[0].FullPath
+	opf, err := book.read(book.opfPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+	}
+	err = xml.Unmarshal(opf, &book.pkg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: package document: %s", ErrCorrupted, err.Error())
+	}
+	if len(book.pkg.Spine) == 0 {
+		return nil, fmt.Errorf("%w: package document has empty spine", ErrCorrupted)
+	}
+
+	return book, nil
+}
+
+func (b *epubBook) read(name string) ([]byte, error) {
+	f, err := b.zip.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxEpubEntrySize))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func epubMetadata(data []byte) (*Metadata, error) {
+	book, err := openEpub(data)
+	if err != nil {
+		return nil, err
+	}
+	m := book.pkg.Metadata
+
+	meta := &Metadata{
+		Pages:    len(book.pkg.Spine),
+		Title:    first(m.Titles),
+		Author:   strings.Join(trimAll(m.Creators), ", "),
+		Subject:  first(m.Descriptions),
+		Keywords: strings.Join(trimAll(m.Subjects), ", "),
+		Size:     int64(len(data)),
+	}
+	meta.CreationDate = parseLooseDate(first(m.Dates))
+
+	return meta, nil
+}
+
+func epubText(data []byte) ([]string, error) {
+	book, err := openEpub(data)
+	if err != nil {
+		return nil, err
+	}
+
+	hrefs := map[string]string{}
+	for _, item := range book.pkg.Manifest {
+		hrefs[item.Id] = item.Href
+	}
+
+	dir := path.Dir(book.opfPath)
+	pages := make([]string, 0, len(book.pkg.Spine))
+	for _, ref := range book.pkg.Spine {
+		href, err := url.PathUnescape(hrefs[ref.IdRef])
+		if err != nil || href == "" {
+			pages = append(pages, "")
+			continue
+		}
+		content, err := book.read(path.Join(dir, href))
+		if err != nil {
+			pages = append(pages, "")
+			continue
+		}
+		pages = append(pages, htmlText(content))
+	}
+	return pages, nil
+}
+
+func htmlText(content []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var parts []string
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "script" || t.Name.Local == "style" || t.Name.Local == "head" {
+				skip++
+			}
+		case xml.EndElement:
+			if (t.Name.Local == "script" || t.Name.Local == "style" || t.Name.Local == "head") && skip > 0 {
+				skip--
+			}
+		case xml.CharData:
+			if skip == 0 {
+				parts = append(parts, string(t))
+			}
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func trimAll(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func parseLooseDate(s string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,53 @@
+package formats
+
+import (
+	"bytes"
+	"crud-books/pdf"
+	"errors"
+	"fmt"
+)
+
+const MimePDF = "application/pdf"
+
+var pdfFormat = Format{
+	Name:       "pdf",
+	MimeType:   MimePDF,
+	Extensions: []string{"pdf"},
+	Detect: func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("%PDF-"))
+	},
+	Validate: func(data []byte) error {
+		return pdfError(pdf.Validate(data))
+	},
+	ExtractMetadata: func(data []byte) (*Metadata, error) {
+		meta, err := pdf.ExtractMetadata(data)
+		if err != nil {
+			return nil, pdfError(err)
+		}
+		return &Metadata{
+			Pages:        meta.Pages,
+			Title:        meta.Title,
+			Author:       meta.Author,
+			Subject:      meta.Subject,
+			Keywords:     meta.Keywords,
+			CreationDate: meta.CreationDate,
+			Size:         meta.Size,
+		}, nil
+	},
+	ExtractText: func(data []byte) ([]string, error) {
+		pages, err := pdf.ExtractText(data)
+		return pages, pdfError(err)
+	},
+}
+
+func pdfError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pdf.ErrNotPDF):
+		return fmt.Errorf("%w: %s", ErrUnsupported, err.Error())
+	case errors.Is(err, pdf.ErrEncrypted):
+		return fmt.Errorf("%w: %s", ErrEncrypted, err.Error())
+	}
+	return fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+}
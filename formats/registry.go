@@ -0,0 +1,81 @@
+package formats
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document format")
+	ErrCorrupted   = errors.New("document is corrupted")
+	ErrEncrypted   = errors.New("document is encrypted")
+)
+
+type Metadata struct {
+	Pages        int
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	CreationDate time.Time
+	Size         int64
+}
+
+// Format describes a supported document type. Detect only sniffs the content
+// signature, Validate checks the whole structure. ExtractText is optional and
+// returns the text split by pages.
+type Format struct {
+	Name            string
+	MimeType        string
+	Extensions      []string
+	Detect          func(data []byte) bool
+	Validate        func(data []byte) error
+	ExtractMetadata func(data []byte) (*Metadata, error)
+	ExtractText     func(data []byte) ([]string, error)
+}
+
+var registry []Format
+
+// Register adds a format. Formats are probed in registration order, so
+// formats with loose signatures have to be registered last.
+func Register(f Format) {
+	registry = append(registry, f)
+}
+
+func init() {
+	Register(pdfFormat)
+	Register(epubFormat)
+	Register(djvuFormat)
+	Register(textFormat)
+}
+
+func Detect(data []byte) (*Format, error) {
+	for i := range registry {
+		if registry[i].Detect(data) {
+			return &registry[i], nil
+		}
+	}
+	return nil, ErrUnsupported
+}
+
+// Lookup finds a format by its name, MIME type or file extension.
+func Lookup(key string) (*Format, bool) {
+	key = strings.ToLower(strings.TrimPrefix(key, "."))
+	for i := range registry {
+		f := &registry[i]
+		if f.Name == key || f.MimeType == key {
+			return f, true
+		}
+		for _, ext := range f.Extensions {
+			if ext == key {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func All() []Format {
+	return append([]Format(nil), registry...)
+}
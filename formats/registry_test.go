@@ -0,0 +1,113 @@
+package formats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFixture(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+func Test_Detect(t *testing.T) {
+	cases := map[string]string{
+		"../pdf/testsData/valid.pdf": MimePDF,
+		"./testsData/book.epub":      MimeEPUB,
+		"./testsData/book.djvu":      MimeDJVU,
+		"./testsData/book.txt":       MimeText,
+	}
+	for path, mime := range cases {
+		f, err := Detect(readFixture(t, path))
+		require.NoError(t, err, path)
+		assert.Equal(t, mime, f.MimeType, path)
+		assert.NoError(t, f.Validate(readFixture(t, path)), path)
+	}
+
+	_, err := Detect([]byte("MZ\x90\x00\x03\x00\x00\x00"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func Test_Lookup(t *testing.T) {
+	for _, key := range []string{"epub", "application/epub+zip", ".EPUB"} {
+		f, ok := Lookup(key)
+		require.True(t, ok, key)
+		assert.Equal(t, "epub", f.Name)
+	}
+
+	_, ok := Lookup("docx")
+	assert.False(t, ok)
+}
+
+func Test_PDF_Errors(t *testing.T) {
+	err := pdfFormat.Validate(readFixture(t, "../pdf/testsData/encrypted.pdf"))
+	assert.ErrorIs(t, err, ErrEncrypted)
+
+	err = pdfFormat.Validate(readFixture(t, "../pdf/testsData/corrupted.pdf"))
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func Test_EPUB(t *testing.T) {
+	data := readFixture(t, "./testsData/book.epub")
+
+	meta, err := epubFormat.ExtractMetadata(data)
+	require.NoError(t, err)
+	assert.Equal(t, &Metadata{
+		Pages:        2,
+		Title:        "The Adventures of Tom Sawyer",
+		Author:       "Mark Twain",
+		Subject:      "A boy growing up along the Mississippi River",
+		Keywords:     "Adventure, Classics",
+		CreationDate: time.Date(1876, 6, 1, 0, 0, 0, 0, time.UTC),
+		Size:         int64(len(data)),
+	}, meta)
+
+	pages, err := epubFormat.ExtractText(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Chapter 1 “Tom!” No answer.", "Saturday morning was come."}, pages)
+
+	t.Run("drm", func(t *testing.T) {
+		err := epubFormat.Validate(readFixture(t, "./testsData/drm.epub"))
+		assert.ErrorIs(t, err, ErrEncrypted)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		err := epubFormat.Validate(data[:len(data)/2])
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+}
+
+func Test_DJVU(t *testing.T) {
+	data := readFixture(t, "./testsData/book.djvu")
+
+	meta, err := djvuFormat.ExtractMetadata(data)
+	require.NoError(t, err)
+	assert.Equal(t, 2, meta.Pages)
+	assert.Equal(t, "Tom Sawyer", meta.Title)
+	assert.Equal(t, "Mark Twain", meta.Author)
+	assert.Equal(t, 1876, meta.CreationDate.Year())
+
+	pages, err := djvuFormat.ExtractText(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"First page text", "Second page text"}, pages)
+
+	err = djvuFormat.Validate(data[:len(data)-10])
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func Test_Text(t *testing.T) {
+	data := readFixture(t, "./testsData/book.txt")
+
+	meta, err := textFormat.ExtractMetadata(data)
+	require.NoError(t, err)
+	assert.Equal(t, 2, meta.Pages)
+	assert.Equal(t, "The Adventures of Tom Sawyer", meta.Title)
+
+	assert.False(t, textFormat.Detect([]byte("binary\x00data")))
+	assert.False(t, textFormat.Detect([]byte("\xff\xfe")))
+}
@@ -0,0 +1,82 @@
+package formats
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MimeText = "text/plain"
+
+	maxTextTitleLength = 120
+)
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+var textFormat = Format{
+	Name:       "txt",
+	MimeType:   MimeText,
+	Extensions: []string{"txt", "text"},
+	Detect:     isPlainText,
+	Validate: func(data []byte) error {
+		if !isPlainText(data) {
+			return ErrUnsupported
+		}
+		return nil
+	},
+	ExtractMetadata: func(data []byte) (*Metadata, error) {
+		if !isPlainText(data) {
+			return nil, ErrUnsupported
+		}
+		pages := textPages(data)
+		meta := &Metadata{
+			Pages: len(pages),
+			Size:  int64(len(data)),
+		}
+		for _, line := range strings.Split(pages[0], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				meta.Title = truncateRunes(line, maxTextTitleLength)
+				break
+			}
+		}
+		return meta, nil
+	},
+	ExtractText: func(data []byte) ([]string, error) {
+		if !isPlainText(data) {
+			return nil, ErrUnsupported
+		}
+		return textPages(data), nil
+	},
+}
+
+// isPlainText accepts UTF-8 content without NUL bytes and other control
+// characters which never appear in text files but are common in binaries.
+func isPlainText(data []byte) bool {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if len(bytes.TrimSpace(data)) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' && r != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+// textPages splits the text by form feed characters which are used as page
+// breaks in plain text documents.
+func textPages(data []byte) []string {
+	text := string(bytes.TrimPrefix(data, utf8BOM))
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\f")
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
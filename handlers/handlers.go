@@ -2,16 +2,20 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"crud-books/auth"
+	"crud-books/formats"
 	"crud-books/models"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
-	"path/filepath"
 	"strconv"
+	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/gommon/log"
 )
 
 const (
@@ -20,52 +24,84 @@ const (
 	offsetParam    = "offset"
 	sortParam      = "sort"
 	directionParam = "direction"
+	contentParam   = "content"
+	formatParam    = "format"
+	versionParam   = "n"
+	widthParam     = "width"
 
 	fileFieldKey = "file"
 
-	bindingError              = "binding request body error: %s"
-	getUserIdFromCtxError     = "getting user id error: %s"
-	createBookError           = "create book error: %s"
-	parseMultipartError       = "read multipart error: %s"
-	extensionCheckError       = "provided file should be PDF"
-	readFileContentError      = "reading file content error: %s"
-	serviceUploadFileError    = "upload file error: %s"
-	serviceGetUserByIdError   = "get user by id failed, err: %s"
-	getBookError              = "bookdata error: %s"
-	getBooksParamsError       = "get books params error: %s"
-	getBooksServiceError      = "get books service error: %s"
-	getBooksParamsFillerError = "get books params filler error: %s"
-	getBooksPrivateError      = "get books private error: %s"
-	getBooksPublicError       = "get books public error: %s"
-	serviceSignUpError        = "service signup error: %s"
-	serviceSignInError        = "service signin error: %s"
-	serviceUpdateBookError    = "service layer updatebook error: %s"
-	serviceDeleteBookError    = "service delete book error: %s"
+	bindingError               = "binding request body error: %s"
+	getUserIdFromCtxError      = "getting user id error: %s"
+	createBookError            = "create book error: %s"
+	parseMultipartError        = "read multipart error: %s"
+	unsupportedFileError       = "provided file format isn't supported: %s"
+	unprocessableFileError     = "provided file can't be processed: %s"
+	unknownFormatError         = "unknown format: %s"
+	readFileContentError       = "reading file content error: %s"
+	serviceUploadFileError     = "upload file error: %s"
+	serviceGetUserByIdError    = "get user by id failed, err: %s"
+	getBookError               = "bookdata error: %s"
+	getBooksParamsError        = "get books params error: %s"
+	getBooksServiceError       = "get books service error: %s"
+	getBooksParamsFillerError  = "get books params filler error: %s"
+	getBooksPrivateError       = "get books private error: %s"
+	getBooksPublicError        = "get books public error: %s"
+	serviceSignUpError         = "service signup error: %s"
+	serviceSignInError         = "service signin error: %s"
+	serviceUpdateBookError     = "service layer updatebook error: %s"
+	serviceDeleteBookError     = "service delete book error: %s"
+	searchContentEmptyError    = "search param is required to search in books content"
+	searchContentError         = "search in books content error: %s"
+	unsupportedCoverError      = "cover should be a PNG or JPEG image"
+	serviceUpdateCoverError    = "service update book cover error: %s"
+	widthParamError            = "width should be a positive number: %s"
+	getCoverError              = "get book cover error: %s"
+	serviceGetTrashError       = "service get trash error: %s"
+	serviceRestoreBookError    = "service restore book error: %s"
+	versionParamError          = "version should be a positive number: %s"
+	serviceGetVersionsError    = "service get book versions error: %s"
+	serviceGetVersionError     = "service get book version error: %s"
+	downloadBookError          = "download book error: %s"
+	serviceRestoreVersionError = "service restore book version error: %s"
 )
 
 type Handlers struct {
 	Services Service
+	logger   *slog.Logger
 }
 
 //go:generate mockgen -source=handlers.go -destination=./mocks/handlers_mock.go
 type Service interface {
-	SignIn(user models.UserDataInput) (string, error)
-	SignUp(user models.UserDataInput) (string, error)
-
-	UploadFile(file []byte, fileName string) (string, error)
-
-	GetBooks(filter models.Filter, sorting models.Sort) (*[]models.BookData, error)
-	GetBook(bookToken string) (*models.GetBookResponse, error)
-	CreateBook(title, description, fileToken, userEmail string) (string, error)
-	UpdateBook(bookFileToken string, updater models.BookDataUpdater) error
-	DeleteBook(tokenBook string) error
-
-	GetUserById(userId string) (*models.UserData, error)
+	SignIn(ctx context.Context, user models.UserDataInput) (string, error)
+	SignUp(ctx context.Context, user models.UserDataInput) (string, error)
+
+	UploadFile(ctx context.Context, file []byte, fileName, userEmail string) (string, error)
+
+	GetBooks(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.BookData, error)
+	SearchBooksContent(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.ContentHit, error)
+	GetBook(ctx context.Context, bookToken, userEmail string) (*models.GetBookResponse, error)
+	OpenBookFile(ctx context.Context, bookToken, userEmail string) (*models.BookFile, error)
+	CreateBook(ctx context.Context, title, description, fileToken, userEmail string) (string, error)
+	UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editorEmail string) error
+	GetBookVersions(ctx context.Context, bookToken, userEmail string) (*[]models.BookVersion, error)
+	GetBookVersion(ctx context.Context, bookToken string, version int, userEmail string) (*models.BookVersion, error)
+	RestoreBookVersion(ctx context.Context, bookToken string, version int, editorEmail string) (string, error)
+	UpdateBookCover(ctx context.Context, bookToken string, image []byte, fileName, userEmail string) (string, error)
+	OpenBookCover(ctx context.Context, bookToken string, width int, userEmail string) (*models.BookFile, error)
+	DeleteBook(ctx context.Context, tokenBook, userEmail string) error
+	GetTrash(ctx context.Context, userEmail string) (*[]models.BookData, error)
+	RestoreBook(ctx context.Context, bookToken, userEmail string) error
+
+	GetUserById(ctx context.Context, userId string) (*models.UserData, error)
+
+	Readiness(ctx context.Context) *models.Readiness
 }
 
-func New(serviceLayer Service) *Handlers {
+func New(serviceLayer Service, logger *slog.Logger) *Handlers {
 	return &Handlers{
 		Services: serviceLayer,
+		logger:   logger,
 	}
 }
 
@@ -78,11 +114,6 @@ func (e *Handlers) UploadFile(c echo.Context) error {
 
 	fileName := fileHeader.Filename
 
-	ext := filepath.Ext(fileName)
-	if ext != ".pdf" {
-		return c.String(http.StatusBadRequest, extensionCheckError)
-	}
-
 	buf := bytes.NewBuffer(nil)
 	byteCont, err := io.ReadAll(file)
 	if err != nil {
@@ -90,7 +121,24 @@ func (e *Handlers) UploadFile(c echo.Context) error {
 	}
 	buf.Write(byteCont)
 
-	fileToken, err := e.Services.UploadFile(buf.Bytes(), fileName)
+	format, err := formats.Detect(byteCont)
+	if err != nil {
+		return c.String(http.StatusUnsupportedMediaType, fmt.Sprintf(unsupportedFileError, err.Error()))
+	}
+	err = format.Validate(byteCont)
+	if errors.Is(err, formats.ErrUnsupported) {
+		return c.String(http.StatusUnsupportedMediaType, fmt.Sprintf(unsupportedFileError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, fmt.Sprintf(unprocessableFileError, err.Error()))
+	}
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	fileToken, err := e.Services.UploadFile(c.Request().Context(), buf.Bytes(), fileName, userEmail)
 	if err != nil {
 		return c.String(http.StatusBadRequest, fmt.Sprintf(serviceUploadFileError, err.Error()))
 	}
@@ -101,23 +149,11 @@ func (e *Handlers) UploadFile(c echo.Context) error {
 }
 
 func getUserIdFromCtx(c echo.Context) (string, error) {
-	uCtx := c.Get("user")
-	if uCtx == nil {
-		return "", fmt.Errorf("user context is null")
-	}
-	user, ok := uCtx.(*jwt.Token)
+	user, ok := auth.CurrentUser(c.Request().Context())
 	if !ok {
-		return "", fmt.Errorf("convert user item to jwt format failed")
-	}
-	claims, ok := user.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("claims type assertion failed")
-	}
-	userId := claims["id"].(string)
-	if userId == "" {
-		return "", fmt.Errorf("userId is empty")
+		return "", fmt.Errorf("user context is null")
 	}
-	return userId, nil
+	return user.Id, nil
 }
 
 func (e *Handlers) CreateBook(c echo.Context) error {
@@ -132,12 +168,12 @@ func (e *Handlers) CreateBook(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(getUserIdFromCtxError, err.Error()))
 	}
 
-	userData, err := e.Services.GetUserById(userId)
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
 	}
 
-	fileToken, err := e.Services.CreateBook(reqBody.Title, reqBody.Description, reqBody.FileToken, userData.Email)
+	fileToken, err := e.Services.CreateBook(c.Request().Context(), reqBody.Title, reqBody.Description, reqBody.FileToken, userData.Email)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(createBookError, err.Error()))
 	}
@@ -146,7 +182,16 @@ func (e *Handlers) CreateBook(c echo.Context) error {
 
 func (e *Handlers) GetBook(c echo.Context) error {
 	bookToken := c.Param("id")
-	bookData, err := e.Services.GetBook(bookToken)
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	bookData, err := e.Services.GetBook(c.Request().Context(), bookToken, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(getBookError, err.Error()))
+	}
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(getBookError, err.Error()))
 	}
@@ -154,6 +199,57 @@ func (e *Handlers) GetBook(c echo.Context) error {
 	return c.JSON(http.StatusOK, bookData)
 }
 
+// getUserEmail returns the email of the authorized user, or an empty string
+// for anonymous requests.
+func (e *Handlers) getUserEmail(c echo.Context) (string, error) {
+	userId, err := getUserIdFromCtx(c)
+	if err != nil {
+		return "", nil
+	}
+
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return "", err
+	}
+	return userData.Email, nil
+}
+
+func (e *Handlers) DownloadBook(c echo.Context) error {
+	bookToken := c.Param("id")
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	file, err := e.Services.OpenBookFile(c.Request().Context(), bookToken, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(downloadBookError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(downloadBookError, err.Error()))
+	}
+	defer file.Content.Close()
+
+	// text files are any valid UTF-8, including HTML and scripts, so they are
+	// never rendered by the browser on the app origin
+	disposition, contentType := "inline", file.MimeType
+	if file.MimeType == formats.MimeText {
+		disposition, contentType = "attachment", echo.MIMETextPlainCharsetUTF8
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	if file.ETag != "" {
+		header.Set("ETag", fmt.Sprintf("%q", file.ETag))
+	}
+
+	http.ServeContent(c.Response(), c.Request(), file.Name, time.Time{}, file.Content)
+	return nil
+}
+
 func getBooksParamsFieldFiller(c echo.Context, userEmail string) (*models.Filter, *models.Sort, error) {
 	defaultLimit := 10
 	defaultOffset := 0
@@ -163,6 +259,14 @@ func getBooksParamsFieldFiller(c echo.Context, userEmail string) (*models.Filter
 		Search: c.QueryParams().Get(searchParam),
 	}
 
+	if formatKey := c.QueryParams().Get(formatParam); formatKey != "" {
+		format, ok := formats.Lookup(formatKey)
+		if !ok {
+			return nil, nil, fmt.Errorf(unknownFormatError, formatKey)
+		}
+		filter.Format = format.MimeType
+	}
+
 	intLimit, err := strconv.Atoi(c.QueryParams().Get(limitParam))
 	if err != nil {
 		intLimit = defaultLimit
@@ -189,7 +293,7 @@ func (e Handlers) getBooksPublic(c echo.Context) (*[]models.BookData, error) {
 		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksParamsError, err.Error()))
 	}
 
-	books, err := e.Services.GetBooks(*filter, *sort)
+	books, err := e.Services.GetBooks(c.Request().Context(), *filter, *sort)
 	if err != nil {
 		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksServiceError, err.Error()))
 	}
@@ -199,7 +303,7 @@ func (e Handlers) getBooksPublic(c echo.Context) (*[]models.BookData, error) {
 }
 
 func (e Handlers) getBooksPrivate(c echo.Context, userId string) (*[]models.BookData, error) {
-	userData, err := e.Services.GetUserById(userId)
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
 	if err != nil {
 		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
 	}
@@ -209,7 +313,7 @@ func (e Handlers) getBooksPrivate(c echo.Context, userId string) (*[]models.Book
 		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksParamsFillerError, err.Error()))
 	}
 
-	books, err := e.Services.GetBooks(*filter, *sort)
+	books, err := e.Services.GetBooks(c.Request().Context(), *filter, *sort)
 	if err != nil {
 		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksServiceError, err.Error()))
 	}
@@ -218,10 +322,47 @@ func (e Handlers) getBooksPrivate(c echo.Context, userId string) (*[]models.Book
 
 }
 
+func (e Handlers) searchBooksContent(c echo.Context) error {
+	userEmail := ""
+	userId, err := getUserIdFromCtx(c)
+	if err == nil {
+		userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+		}
+		userEmail = userData.Email
+	}
+
+	filter, sort, err := getBooksParamsFieldFiller(c, userEmail)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksParamsFillerError, err.Error()))
+	}
+	if filter.Search == "" {
+		return c.String(http.StatusBadRequest, searchContentEmptyError)
+	}
+
+	hits, err := e.Services.SearchBooksContent(c.Request().Context(), *filter, *sort)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(searchContentError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, hits)
+}
+
 func (e Handlers) GetBooks(c echo.Context) error {
+	if formatKey := c.QueryParams().Get(formatParam); formatKey != "" {
+		if _, ok := formats.Lookup(formatKey); !ok {
+			return c.String(http.StatusBadRequest, fmt.Sprintf(unknownFormatError, formatKey))
+		}
+	}
+
+	if c.QueryParams().Get(contentParam) == "true" {
+		return e.searchBooksContent(c)
+	}
+
 	userId, err := getUserIdFromCtx(c)
 	if err != nil {
-		log.Errorf("error: %w", err)
+		e.logger.DebugContext(c.Request().Context(), "listing public books", "reason", err)
 		books, err := e.getBooksPublic(c)
 		if err != nil {
 			return c.String(http.StatusInternalServerError, fmt.Sprintf(getBooksPublicError, err.Error()))
@@ -244,7 +385,7 @@ func (e *Handlers) SignUp(c echo.Context) error {
 		return c.String(http.StatusBadRequest, fmt.Sprintf(bindingError, err.Error()))
 	}
 
-	jwtTok, err := e.Services.SignUp(signUpData)
+	jwtTok, err := e.Services.SignUp(c.Request().Context(), signUpData)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceSignUpError, err.Error()))
 	}
@@ -262,7 +403,7 @@ func (e *Handlers) SignIn(c echo.Context) error {
 	if err != nil {
 		return c.String(http.StatusBadRequest, fmt.Sprintf(bindingError, err.Error()))
 	}
-	jwtTok, err := e.Services.SignIn(signInData)
+	jwtTok, err := e.Services.SignIn(c.Request().Context(), signInData)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceSignInError, err.Error()))
 	}
@@ -283,7 +424,20 @@ func (e *Handlers) UpdateBook(c echo.Context) error {
 		return c.String(http.StatusBadRequest, fmt.Sprintf(bindingError, err.Error()))
 	}
 
-	err = e.Services.UpdateBook(bookToken, updater)
+	userId, err := getUserIdFromCtx(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(getUserIdFromCtxError, err.Error()))
+	}
+
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	err = e.Services.UpdateBook(c.Request().Context(), bookToken, updater, userData.Email)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceUpdateBookError, err.Error()))
+	}
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceUpdateBookError, err.Error()))
 	}
@@ -291,13 +445,234 @@ func (e *Handlers) UpdateBook(c echo.Context) error {
 	return c.String(http.StatusOK, "")
 }
 
+func (e *Handlers) GetBookVersions(c echo.Context) error {
+	bookToken := c.Param("id")
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	versions, err := e.Services.GetBookVersions(c.Request().Context(), bookToken, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceGetVersionsError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetVersionsError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+func getVersionParam(c echo.Context) (int, error) {
+	version, err := strconv.Atoi(c.Param(versionParam))
+	if err != nil {
+		return 0, err
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("got %d", version)
+	}
+	return version, nil
+}
+
+func (e *Handlers) GetBookVersion(c echo.Context) error {
+	bookToken := c.Param("id")
+	version, err := getVersionParam(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(versionParamError, err.Error()))
+	}
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	v, err := e.Services.GetBookVersion(c.Request().Context(), bookToken, version, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceGetVersionError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusNotFound, fmt.Sprintf(serviceGetVersionError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, v)
+}
+
+func (e *Handlers) RestoreBookVersion(c echo.Context) error {
+	bookToken := c.Param("id")
+	version, err := getVersionParam(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(versionParamError, err.Error()))
+	}
+
+	userId, err := getUserIdFromCtx(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(getUserIdFromCtxError, err.Error()))
+	}
+
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	fileToken, err := e.Services.RestoreBookVersion(c.Request().Context(), bookToken, version, userData.Email)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceRestoreVersionError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(serviceRestoreVersionError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"fileToken": fileToken,
+	})
+}
+
 func (e *Handlers) DeleteBook(c echo.Context) error {
 	bookToken := c.Param("id")
 
-	err := e.Services.DeleteBook(bookToken)
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	err = e.Services.DeleteBook(c.Request().Context(), bookToken, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceDeleteBookError, err.Error()))
+	}
 	if err != nil {
 		return c.String(http.StatusBadRequest, fmt.Sprintf(serviceDeleteBookError, err.Error()))
 	}
 
 	return c.JSON(http.StatusOK, "")
 }
+
+func (e *Handlers) GetTrash(c echo.Context) error {
+	userId, err := getUserIdFromCtx(c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, fmt.Sprintf(getUserIdFromCtxError, err.Error()))
+	}
+
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	books, err := e.Services.GetTrash(c.Request().Context(), userData.Email)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetTrashError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, books)
+}
+
+func (e *Handlers) RestoreBook(c echo.Context) error {
+	bookToken := c.Param("id")
+
+	userId, err := getUserIdFromCtx(c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, fmt.Sprintf(getUserIdFromCtxError, err.Error()))
+	}
+
+	userData, err := e.Services.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	err = e.Services.RestoreBook(c.Request().Context(), bookToken, userData.Email)
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(serviceRestoreBookError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, "")
+}
+
+func (e *Handlers) UpdateBookCover(c echo.Context) error {
+	bookToken := c.Param("id")
+
+	c.Request().ParseMultipartForm(32 << 20)
+	file, fileHeader, err := c.Request().FormFile(fileFieldKey)
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(parseMultipartError, err.Error()))
+	}
+
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(readFileContentError, err.Error()))
+	}
+
+	contentType := http.DetectContentType(image)
+	if contentType != "image/png" && contentType != "image/jpeg" {
+		return c.String(http.StatusUnsupportedMediaType, unsupportedCoverError)
+	}
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	coverUrl, err := e.Services.UpdateBookCover(c.Request().Context(), bookToken, image, fileHeader.Filename, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(serviceUpdateCoverError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceUpdateCoverError, err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"coverUrl": coverUrl,
+	})
+}
+
+func (e *Handlers) GetBookCover(c echo.Context) error {
+	bookToken := c.Param("id")
+
+	width := 0
+	if raw := c.QueryParam(widthParam); raw != "" {
+		var err error
+		width, err = strconv.Atoi(raw)
+		if err != nil || width <= 0 {
+			return c.String(http.StatusBadRequest, fmt.Sprintf(widthParamError, raw))
+		}
+	}
+
+	userEmail, err := e.getUserEmail(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(serviceGetUserByIdError, err.Error()))
+	}
+
+	cover, err := e.Services.OpenBookCover(c.Request().Context(), bookToken, width, userEmail)
+	if errors.Is(err, models.ErrAccessDenied) {
+		return c.String(http.StatusForbidden, fmt.Sprintf(getCoverError, err.Error()))
+	}
+	if errors.Is(err, models.ErrNoCover) {
+		return c.String(http.StatusNotFound, fmt.Sprintf(getCoverError, err.Error()))
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf(getCoverError, err.Error()))
+	}
+	defer cover.Content.Close()
+
+	// no Content-Type is set, ServeContent sniffs PNG and JPEG covers
+	c.Response().Header().Set("ETag", fmt.Sprintf("%q", cover.ETag))
+	http.ServeContent(c.Response(), c.Request(), cover.Name, time.Time{}, cover.Content)
+	return nil
+}
+
+// Healthz reports that the process is alive. It touches no dependency, so a
+// slow database doesn't get the app restarted.
+func (e *Handlers) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+	})
+}
+
+// Readyz reports whether the app can serve traffic, with the state of every
+// dependency.
+func (e *Handlers) Readyz(c echo.Context) error {
+	readiness := e.Services.Readiness(c.Request().Context())
+	if readiness.Status != "ok" {
+		return c.JSON(http.StatusServiceUnavailable, readiness)
+	}
+	return c.JSON(http.StatusOK, readiness)
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"crud-books/auth"
 	mock_handlers "crud-books/handlers/mocks"
 	"crud-books/models"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -16,7 +18,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -35,6 +36,8 @@ type mocks struct {
 	serviceLayer *mock_handlers.MockService
 }
 
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
 func getMocks(t *testing.T) mocks {
 	ctrl := gomock.NewController(t)
 	return mocks{
@@ -42,17 +45,19 @@ func getMocks(t *testing.T) mocks {
 	}
 }
 
-func getReqWithJson(path, method string, buf *bytes.Buffer) (httptest.ResponseRecorder, echo.Context) {
+func setUser(c echo.Context, userId string) {
+	ctx := auth.WithUser(c.Request().Context(), auth.User{Id: userId})
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+func getReqWithJson(path, method string, buf *bytes.Buffer) (*httptest.ResponseRecorder, echo.Context) {
 	serv := echo.New()
 	req := httptest.NewRequest(method, path, buf)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec := httptest.NewRecorder()
 	c := serv.NewContext(req, rec)
-	auth := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id": defaultUserId,
-	})
-	c.Set("user", auth)
-	return *rec, c
+	setUser(c, defaultUserId)
+	return rec, c
 }
 
 func getHeaderForFile(fileName string) textproto.MIMEHeader {
@@ -67,7 +72,7 @@ func getHeaderForFile(fileName string) textproto.MIMEHeader {
 	return h
 }
 
-func getReqWithFormFile(path, method string, file []byte, fileName string) (httptest.ResponseRecorder, echo.Context) {
+func getReqWithFormFile(path, method string, file []byte, fileName string) (*httptest.ResponseRecorder, echo.Context) {
 	serv := echo.New()
 	multipartCore := &bytes.Buffer{}
 	writer := multipart.NewWriter(multipartCore)
@@ -83,7 +88,7 @@ func getReqWithFormFile(path, method string, file []byte, fileName string) (http
 	rec := httptest.NewRecorder()
 	writer.Close()
 
-	return *rec, serv.NewContext(req, rec)
+	return rec, serv.NewContext(req, rec)
 }
 
 func Test_EchoHandlers_SignUp(t *testing.T) {
@@ -99,9 +104,9 @@ func Test_EchoHandlers_SignUp(t *testing.T) {
 	buf := bytes.NewBuffer(body)
 	rec, c := getReqWithJson("/register", http.MethodPost, buf)
 	mocks := getMocks(t)
-	mocks.serviceLayer.EXPECT().SignUp(inp).Return(jwtTok, nil)
+	mocks.serviceLayer.EXPECT().SignUp(gomock.Any(), inp).Return(jwtTok, nil)
 
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 	err := h.SignUp(c)
 	require.NoError(t, err)
 
@@ -126,8 +131,8 @@ func TestEchoHandlers_SignIn(t *testing.T) {
 	mocks := getMocks(t)
 	jwtToken := "41351adas"
 
-	h := New(mocks.serviceLayer)
-	mocks.serviceLayer.EXPECT().SignIn(inp).Return(jwtToken, nil)
+	h := New(mocks.serviceLayer, testLogger)
+	mocks.serviceLayer.EXPECT().SignIn(gomock.Any(), inp).Return(jwtToken, nil)
 
 	err := h.SignIn(c)
 
@@ -149,27 +154,49 @@ func Test_UploadFile(t *testing.T) {
 
 	fileFromForm, fileHeader, _ := c.Request().FormFile("file")
 	bytesOfFileForm, _ := io.ReadAll(fileFromForm)
-	mocks.serviceLayer.EXPECT().UploadFile(bytesOfFileForm, fileHeader.Filename).Return(fileToken, nil)
+	mocks.serviceLayer.EXPECT().UploadFile(gomock.Any(), bytesOfFileForm, fileHeader.Filename, "").Return(fileToken, nil)
 
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 
 	err := h.UploadFile(c)
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
 
+func Test_UploadFile_Rejected(t *testing.T) {
+	t.Run("unsupported", func(t *testing.T) {
+		mocks := getMocks(t)
+		content := []byte("MZ\x90\x00 renamed executable")
+
+		rec, c := getReqWithFormFile("/files", http.MethodPost, content, "file.pdf")
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.UploadFile(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		mocks := getMocks(t)
+		content, err := os.ReadFile("./testsData/file.pdf")
+		require.NoError(t, err)
+
+		rec, c := getReqWithFormFile("/files", http.MethodPost, content[:len(content)-64], "file.pdf")
+
+		h := New(mocks.serviceLayer, testLogger)
+		err = h.UploadFile(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
+
 func Test_GetUserIdFromCtx(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		srv := echo.New()
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		rec := httptest.NewRecorder()
-		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":  defaultUserId,
-			"exp": jwt.NewNumericDate(time.Now().Add(time.Minute * 15)),
-		},
-		)
 		c := srv.NewContext(req, rec)
-		c.Set("user", tok)
+		setUser(c, defaultUserId)
 
 		usId, err := getUserIdFromCtx(c)
 		require.NoError(t, err)
@@ -204,10 +231,10 @@ func Test_CreateBook(t *testing.T) {
 	b, _ := json.Marshal(&reqBody)
 	buf.Write(b)
 	rec, c := getReqWithJson("/books", http.MethodPost, buf)
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 
-	mocks.serviceLayer.EXPECT().GetUserById(defaultUserId).Return(&userData, nil)
-	mocks.serviceLayer.EXPECT().CreateBook(reqBody.Title, reqBody.Description, reqBody.FileToken, userData.Email).Return(reqBody.FileToken, nil)
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().CreateBook(gomock.Any(), reqBody.Title, reqBody.Description, reqBody.FileToken, userData.Email).Return(reqBody.FileToken, nil)
 
 	err := h.CreateBook(c)
 	require.NoError(t, err)
@@ -229,9 +256,11 @@ func Test_GetBook(t *testing.T) {
 	c.SetParamValues(bookId)
 	mocks := getMocks(t)
 
-	mocks.serviceLayer.EXPECT().GetBook(bookId).Return(&bookResp, nil)
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().GetBook(gomock.Any(), bookId, userData.Email).Return(&bookResp, nil)
 
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 
 	err := h.GetBook(c)
 	require.NoError(t, err)
@@ -274,10 +303,7 @@ func getReqForGetBooksParams(wantFilt models.Filter, wantSort models.Sort, isAut
 	rec := httptest.NewRecorder()
 	c := echo.New().NewContext(req, rec)
 	if isAuth {
-		auth := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id": defaultUserId,
-		})
-		c.Set("user", auth)
+		setUser(c, defaultUserId)
 	}
 
 	return rec, &c
@@ -316,8 +342,8 @@ func Test_GetBooksPublic(t *testing.T) {
 	rec, c := getReqForGetBooksParams(wantFilt, wantSort, false)
 
 	mocks := getMocks(t)
-	mocks.serviceLayer.EXPECT().GetBooks(wantFilt, wantSort).Return(&wantBooks, nil)
-	h := New(mocks.serviceLayer)
+	mocks.serviceLayer.EXPECT().GetBooks(gomock.Any(), wantFilt, wantSort).Return(&wantBooks, nil)
+	h := New(mocks.serviceLayer, testLogger)
 	err := h.GetBooks(*c)
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
@@ -363,9 +389,9 @@ func TestGetBooksOfUser(t *testing.T) {
 		},
 	}
 	rec, c := getReqForGetBooksParams(wantFilt, wantSort, true)
-	h := New(mocks.serviceLayer)
-	mocks.serviceLayer.EXPECT().GetUserById(defaultUserId).Return(&userData, nil)
-	mocks.serviceLayer.EXPECT().GetBooks(wantFilt, wantSort).Return(&booksResponse, nil)
+	h := New(mocks.serviceLayer, testLogger)
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().GetBooks(gomock.Any(), wantFilt, wantSort).Return(&booksResponse, nil)
 
 	err := h.GetBooks(*c)
 	require.NoError(t, err)
@@ -391,8 +417,8 @@ func Test_SignUp(t *testing.T) {
 	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	c := echo.New().NewContext(req, rec)
 
-	h := New(mocks.serviceLayer)
-	mocks.serviceLayer.EXPECT().SignUp(usInp).Return(jwtTok, nil)
+	h := New(mocks.serviceLayer, testLogger)
+	mocks.serviceLayer.EXPECT().SignUp(gomock.Any(), usInp).Return(jwtTok, nil)
 
 	err := h.SignUp(c)
 	require.NoError(t, err)
@@ -417,9 +443,9 @@ func Test_SignIn(t *testing.T) {
 	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	c := echo.New().NewContext(req, rec)
 
-	mocks.serviceLayer.EXPECT().SignIn(usInp).Return(jwtTok, nil)
+	mocks.serviceLayer.EXPECT().SignIn(gomock.Any(), usInp).Return(jwtTok, nil)
 
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 
 	err := h.SignIn(c)
 	require.NoError(t, err)
@@ -429,22 +455,38 @@ func Test_SignIn(t *testing.T) {
 }
 
 func Test_DeleteBook(t *testing.T) {
-	mocks := getMocks(t)
 	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
 
-	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/books/%s", bookId), &bytes.Buffer{})
-	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	c := echo.New().NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues(bookId)
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s", bookId), http.MethodDelete, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
 
-	mocks.serviceLayer.EXPECT().DeleteBook(bookId).Return(nil)
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().DeleteBook(gomock.Any(), bookId, userData.Email).Return(nil)
 
-	h := New(mocks.serviceLayer)
-	err := h.DeleteBook(c)
-	require.NoError(t, err)
-	assert.Equal(t, http.StatusOK, rec.Code)
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DeleteBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("not_owner", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s", bookId), http.MethodDelete, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().DeleteBook(gomock.Any(), bookId, userData.Email).Return(models.ErrAccessDenied)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DeleteBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
 }
 
 func Test_UpdateBook(t *testing.T) {
@@ -465,13 +507,507 @@ func Test_UpdateBook(t *testing.T) {
 	c.SetPath(fmt.Sprintf("/books/%s", bookId))
 	c.SetParamNames("id")
 	c.SetParamValues(bookId)
+	setUser(c, defaultUserId)
+	userData := models.UserData{Id: defaultUserId, Email: "editor@gmail.com"}
 
-	mocks.serviceLayer.EXPECT().UpdateBook(bookId, updater).Return(nil)
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().UpdateBook(gomock.Any(), bookId, updater, userData.Email).Return(nil)
 
-	h := New(mocks.serviceLayer)
+	h := New(mocks.serviceLayer, testLogger)
 	err := h.UpdateBook(c)
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
 
 	assert.Equal(t, "", rec.Body.String())
 }
+
+func Test_GetBooks_ContentSearch(t *testing.T) {
+	wantFilt := models.Filter{
+		Email:  "",
+		Search: "island",
+	}
+	wantSort := models.Sort{
+		SortField: "",
+		Limit:     10,
+		Direction: "",
+		Offset:    0,
+	}
+	hits := []models.ContentHit{
+		{BookId: "FileToken1", Page: 4, Snippet: "a story about an island"},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		req := httptest.NewRequest(http.MethodGet, "/books?search=island&content=true", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		mocks.serviceLayer.EXPECT().SearchBooksContent(gomock.Any(), wantFilt, wantSort).Return(&hits, nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBooks(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var received []models.ContentHit
+		err = json.Unmarshal(rec.Body.Bytes(), &received)
+		require.NoError(t, err)
+		assert.Equal(t, hits, received)
+	})
+
+	t.Run("empty_search", func(t *testing.T) {
+		mocks := getMocks(t)
+		req := httptest.NewRequest(http.MethodGet, "/books?content=true", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBooks(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_UpdateBookCover(t *testing.T) {
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		img := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+		rec, c := getReqWithFormFile(fmt.Sprintf("/books/%s/cover", bookId), http.MethodPut, img, "cover.png")
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+		setUser(c, defaultUserId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().UpdateBookCover(gomock.Any(), bookId, img, "cover.png", userData.Email).Return("http://cover.url", nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.UpdateBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"coverUrl":"http://cover.url"}`, rec.Body.String())
+	})
+
+	t.Run("not_owner", func(t *testing.T) {
+		mocks := getMocks(t)
+		img := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+		rec, c := getReqWithFormFile(fmt.Sprintf("/books/%s/cover", bookId), http.MethodPut, img, "cover.png")
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+		setUser(c, defaultUserId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().UpdateBookCover(gomock.Any(), bookId, img, "cover.png", userData.Email).Return("", models.ErrAccessDenied)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.UpdateBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("not_image", func(t *testing.T) {
+		mocks := getMocks(t)
+
+		rec, c := getReqWithFormFile(fmt.Sprintf("/books/%s/cover", bookId), http.MethodPut, []byte("%PDF-1.4"), "cover.png")
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.UpdateBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+}
+
+func Test_GetBooks_UnknownFormat(t *testing.T) {
+	mocks := getMocks(t)
+	req := httptest.NewRequest(http.MethodGet, "/books?format=docx", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	h := New(mocks.serviceLayer, testLogger)
+	err := h.GetBooks(c)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func Test_GetBooksParamsFieldFiller_Format(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/books?format=epub", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	filter, _, err := getBooksParamsFieldFiller(c, "")
+	require.NoError(t, err)
+	assert.Equal(t, "application/epub+zip", filter.Format)
+}
+
+func Test_GetTrash(t *testing.T) {
+	mocks := getMocks(t)
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	trash := []models.BookData{{Title: "Deleted", FileToken: "FileToken1", DeletedAt: &deletedAt}}
+
+	rec, c := getReqWithJson("/me/trash", http.MethodGet, &bytes.Buffer{})
+
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().GetTrash(gomock.Any(), userData.Email).Return(&trash, nil)
+
+	h := New(mocks.serviceLayer, testLogger)
+	err := h.GetTrash(c)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var received []models.BookData
+	err = json.Unmarshal(rec.Body.Bytes(), &received)
+	require.NoError(t, err)
+	assert.Equal(t, trash, received)
+}
+
+func Test_RestoreBook(t *testing.T) {
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/restore", bookId), http.MethodPost, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().RestoreBook(gomock.Any(), bookId, userData.Email).Return(nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.RestoreBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("not_in_trash", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/restore", bookId), http.MethodPost, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().RestoreBook(gomock.Any(), bookId, userData.Email).Return(fmt.Errorf("book isn't in the trash"))
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.RestoreBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_GetBookVersions(t *testing.T) {
+	mocks := getMocks(t)
+	bookId := "123"
+	versions := []models.BookVersion{
+		{Version: 1, Title: "Draft", FileToken: "old", Editor: "owner@gmail.com", CreatedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{Version: 2, Title: "Final", FileToken: bookId, Editor: "owner@gmail.com", CreatedAt: time.Date(2023, 5, 2, 12, 0, 0, 0, time.UTC)},
+	}
+
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+
+	rec, c := getReqWithJson(fmt.Sprintf("/books/%s/versions", bookId), http.MethodGet, &bytes.Buffer{})
+	c.SetParamNames("id")
+	c.SetParamValues(bookId)
+
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().GetBookVersions(gomock.Any(), bookId, userData.Email).Return(&versions, nil)
+
+	h := New(mocks.serviceLayer, testLogger)
+	err := h.GetBookVersions(c)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var received []models.BookVersion
+	err = json.Unmarshal(rec.Body.Bytes(), &received)
+	require.NoError(t, err)
+	assert.Equal(t, versions, received)
+}
+
+func Test_GetBookVersion(t *testing.T) {
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "reader@gmail.com"}
+
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		version := models.BookVersion{Version: 2, Title: "Final", FileToken: bookId}
+
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/versions/2", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id", "n")
+		c.SetParamValues(bookId, "2")
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().GetBookVersion(gomock.Any(), bookId, 2, userData.Email).Return(&version, nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookVersion(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("private_book", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/versions/2", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id", "n")
+		c.SetParamValues(bookId, "2")
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().GetBookVersion(gomock.Any(), bookId, 2, userData.Email).Return(nil, models.ErrAccessDenied)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookVersion(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("invalid_number", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/versions/0", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id", "n")
+		c.SetParamValues(bookId, "0")
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookVersion(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_RestoreBookVersion(t *testing.T) {
+	mocks := getMocks(t)
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "editor@gmail.com"}
+
+	rec, c := getReqWithJson(fmt.Sprintf("/books/%s/versions/1/restore", bookId), http.MethodPost, &bytes.Buffer{})
+	c.SetParamNames("id", "n")
+	c.SetParamValues(bookId, "1")
+
+	mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+	mocks.serviceLayer.EXPECT().RestoreBookVersion(gomock.Any(), bookId, 1, userData.Email).Return("old", nil)
+
+	h := New(mocks.serviceLayer, testLogger)
+	err := h.RestoreBookVersion(c)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"fileToken":"old"}`, rec.Body.String())
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func Test_DownloadBook(t *testing.T) {
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+	content := []byte("%PDF-1.4 book content")
+
+	getFile := func() *models.BookFile {
+		return &models.BookFile{
+			Name:     "Book.pdf",
+			MimeType: "application/pdf",
+			Size:     int64(len(content)),
+			ETag:     "abc",
+			Content:  nopSeekCloser{bytes.NewReader(content)},
+		}
+	}
+
+	t.Run("full", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/download", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookFile(gomock.Any(), bookId, userData.Email).Return(getFile(), nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DownloadBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/pdf", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `inline; filename=Book.pdf`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "nosniff", rec.Header().Get(echo.HeaderXContentTypeOptions))
+		assert.Equal(t, fmt.Sprint(len(content)), rec.Header().Get(echo.HeaderContentLength))
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.Equal(t, content, rec.Body.Bytes())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/download", bookId), http.MethodGet, &bytes.Buffer{})
+		c.Request().Header.Set("Range", "bytes=4-7")
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookFile(gomock.Any(), bookId, userData.Email).Return(getFile(), nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DownloadBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, fmt.Sprintf("bytes 4-7/%d", len(content)), rec.Header().Get("Content-Range"))
+		assert.Equal(t, content[4:8], rec.Body.Bytes())
+	})
+
+	t.Run("text_as_attachment", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/download", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		html := []byte("<script>alert(document.cookie)</script>")
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookFile(gomock.Any(), bookId, userData.Email).Return(&models.BookFile{
+			Name:     "Book.txt",
+			MimeType: "text/plain",
+			Size:     int64(len(html)),
+			Content:  nopSeekCloser{bytes.NewReader(html)},
+		}, nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DownloadBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename=Book.txt`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "nosniff", rec.Header().Get(echo.HeaderXContentTypeOptions))
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/download", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookFile(gomock.Any(), bookId, userData.Email).Return(nil, models.ErrAccessDenied)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.DownloadBook(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func Test_GetBookCover(t *testing.T) {
+	bookId := "123"
+	userData := models.UserData{Id: defaultUserId, Email: "owner@gmail.com"}
+	png := []byte("\x89PNG\r\n\x1a\n cover")
+
+	t.Run("served", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/cover?width=160", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookCover(gomock.Any(), bookId, 160, userData.Email).Return(&models.BookFile{
+			Name:    "cover-160",
+			Size:    int64(len(png)),
+			ETag:    "small",
+			Content: nopSeekCloser{bytes.NewReader(png)},
+		}, nil)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `"small"`, rec.Header().Get("ETag"))
+		assert.Equal(t, png, rec.Body.Bytes())
+	})
+
+	t.Run("invalid_width", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/cover?width=big", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("no_cover", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/cover", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookCover(gomock.Any(), bookId, 0, userData.Email).Return(nil, models.ErrNoCover)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		mocks := getMocks(t)
+		rec, c := getReqWithJson(fmt.Sprintf("/books/%s/cover", bookId), http.MethodGet, &bytes.Buffer{})
+		c.SetParamNames("id")
+		c.SetParamValues(bookId)
+
+		mocks.serviceLayer.EXPECT().GetUserById(gomock.Any(), defaultUserId).Return(&userData, nil)
+		mocks.serviceLayer.EXPECT().OpenBookCover(gomock.Any(), bookId, 0, userData.Email).Return(nil, models.ErrAccessDenied)
+
+		h := New(mocks.serviceLayer, testLogger)
+		err := h.GetBookCover(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func Test_Healthz(t *testing.T) {
+	mocks := getMocks(t)
+	rec, c := getReqWithJson("/healthz", http.MethodGet, &bytes.Buffer{})
+
+	h := New(mocks.serviceLayer, testLogger)
+	err := h.Healthz(c)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func Test_Readyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		wantCode int
+	}{
+		{"ready", "ok", http.StatusOK},
+		{"not ready", "fail", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := getMocks(t)
+			readiness := models.Readiness{
+				Status: tt.status,
+				Checks: map[string]models.HealthCheck{"mongodb": {Status: tt.status}},
+			}
+			rec, c := getReqWithJson("/readyz", http.MethodGet, &bytes.Buffer{})
+
+			mocks.serviceLayer.EXPECT().Readiness(gomock.Any()).Return(&readiness)
+
+			h := New(mocks.serviceLayer, testLogger)
+			err := h.Readyz(c)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCode, rec.Code)
+
+			var received models.Readiness
+			err = json.Unmarshal(rec.Body.Bytes(), &received)
+			require.NoError(t, err)
+			assert.Equal(t, readiness.Checks, received.Checks)
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package mock_handlers
 
 import (
+	context "context"
 	models "crud-books/models"
 	reflect "reflect"
 
@@ -35,134 +36,282 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 }
 
 // CreateBook mocks base method.
-func (m *MockService) CreateBook(title, description, fileToken, userEmail string) (string, error) {
+func (m *MockService) CreateBook(ctx context.Context, title, description, fileToken, userEmail string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBook", title, description, fileToken, userEmail)
+	ret := m.ctrl.Call(m, "CreateBook", ctx, title, description, fileToken, userEmail)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateBook indicates an expected call of CreateBook.
-func (mr *MockServiceMockRecorder) CreateBook(title, description, fileToken, userEmail interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) CreateBook(ctx, title, description, fileToken, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBook", reflect.TypeOf((*MockService)(nil).CreateBook), title, description, fileToken, userEmail)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBook", reflect.TypeOf((*MockService)(nil).CreateBook), ctx, title, description, fileToken, userEmail)
 }
 
 // DeleteBook mocks base method.
-func (m *MockService) DeleteBook(tokenBook string) error {
+func (m *MockService) DeleteBook(ctx context.Context, tokenBook, userEmail string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteBook", tokenBook)
+	ret := m.ctrl.Call(m, "DeleteBook", ctx, tokenBook, userEmail)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteBook indicates an expected call of DeleteBook.
-func (mr *MockServiceMockRecorder) DeleteBook(tokenBook interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) DeleteBook(ctx, tokenBook, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBook", reflect.TypeOf((*MockService)(nil).DeleteBook), tokenBook)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBook", reflect.TypeOf((*MockService)(nil).DeleteBook), ctx, tokenBook, userEmail)
 }
 
 // GetBook mocks base method.
-func (m *MockService) GetBook(bookToken string) (*models.GetBookResponse, error) {
+func (m *MockService) GetBook(ctx context.Context, bookToken, userEmail string) (*models.GetBookResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBook", bookToken)
+	ret := m.ctrl.Call(m, "GetBook", ctx, bookToken, userEmail)
 	ret0, _ := ret[0].(*models.GetBookResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBook indicates an expected call of GetBook.
-func (mr *MockServiceMockRecorder) GetBook(bookToken interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetBook(ctx, bookToken, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBook", reflect.TypeOf((*MockService)(nil).GetBook), bookToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBook", reflect.TypeOf((*MockService)(nil).GetBook), ctx, bookToken, userEmail)
+}
+
+// GetBookVersion mocks base method.
+func (m *MockService) GetBookVersion(ctx context.Context, bookToken string, version int, userEmail string) (*models.BookVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookVersion", ctx, bookToken, version, userEmail)
+	ret0, _ := ret[0].(*models.BookVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookVersion indicates an expected call of GetBookVersion.
+func (mr *MockServiceMockRecorder) GetBookVersion(ctx, bookToken, version, userEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookVersion", reflect.TypeOf((*MockService)(nil).GetBookVersion), ctx, bookToken, version, userEmail)
+}
+
+// GetBookVersions mocks base method.
+func (m *MockService) GetBookVersions(ctx context.Context, bookToken, userEmail string) (*[]models.BookVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookVersions", ctx, bookToken, userEmail)
+	ret0, _ := ret[0].(*[]models.BookVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookVersions indicates an expected call of GetBookVersions.
+func (mr *MockServiceMockRecorder) GetBookVersions(ctx, bookToken, userEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookVersions", reflect.TypeOf((*MockService)(nil).GetBookVersions), ctx, bookToken, userEmail)
 }
 
 // GetBooks mocks base method.
-func (m *MockService) GetBooks(filter models.Filter, sorting models.Sort) (*[]models.BookData, error) {
+func (m *MockService) GetBooks(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.BookData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBooks", filter, sorting)
+	ret := m.ctrl.Call(m, "GetBooks", ctx, filter, sorting)
 	ret0, _ := ret[0].(*[]models.BookData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBooks indicates an expected call of GetBooks.
-func (mr *MockServiceMockRecorder) GetBooks(filter, sorting interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetBooks(ctx, filter, sorting interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooks", reflect.TypeOf((*MockService)(nil).GetBooks), filter, sorting)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooks", reflect.TypeOf((*MockService)(nil).GetBooks), ctx, filter, sorting)
+}
+
+// GetTrash mocks base method.
+func (m *MockService) GetTrash(ctx context.Context, userEmail string) (*[]models.BookData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", ctx, userEmail)
+	ret0, _ := ret[0].(*[]models.BookData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockServiceMockRecorder) GetTrash(ctx, userEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockService)(nil).GetTrash), ctx, userEmail)
 }
 
 // GetUserById mocks base method.
-func (m *MockService) GetUserById(userId string) (*models.UserData, error) {
+func (m *MockService) GetUserById(ctx context.Context, userId string) (*models.UserData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserById", userId)
+	ret := m.ctrl.Call(m, "GetUserById", ctx, userId)
 	ret0, _ := ret[0].(*models.UserData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserById indicates an expected call of GetUserById.
-func (mr *MockServiceMockRecorder) GetUserById(userId interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetUserById(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserById", reflect.TypeOf((*MockService)(nil).GetUserById), ctx, userId)
+}
+
+// OpenBookCover mocks base method.
+func (m *MockService) OpenBookCover(ctx context.Context, bookToken string, width int, userEmail string) (*models.BookFile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenBookCover", ctx, bookToken, width, userEmail)
+	ret0, _ := ret[0].(*models.BookFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenBookCover indicates an expected call of OpenBookCover.
+func (mr *MockServiceMockRecorder) OpenBookCover(ctx, bookToken, width, userEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenBookCover", reflect.TypeOf((*MockService)(nil).OpenBookCover), ctx, bookToken, width, userEmail)
+}
+
+// OpenBookFile mocks base method.
+func (m *MockService) OpenBookFile(ctx context.Context, bookToken, userEmail string) (*models.BookFile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenBookFile", ctx, bookToken, userEmail)
+	ret0, _ := ret[0].(*models.BookFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenBookFile indicates an expected call of OpenBookFile.
+func (mr *MockServiceMockRecorder) OpenBookFile(ctx, bookToken, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserById", reflect.TypeOf((*MockService)(nil).GetUserById), userId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenBookFile", reflect.TypeOf((*MockService)(nil).OpenBookFile), ctx, bookToken, userEmail)
+}
+
+// Readiness mocks base method.
+func (m *MockService) Readiness(ctx context.Context) *models.Readiness {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Readiness", ctx)
+	ret0, _ := ret[0].(*models.Readiness)
+	return ret0
+}
+
+// Readiness indicates an expected call of Readiness.
+func (mr *MockServiceMockRecorder) Readiness(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Readiness", reflect.TypeOf((*MockService)(nil).Readiness), ctx)
+}
+
+// RestoreBook mocks base method.
+func (m *MockService) RestoreBook(ctx context.Context, bookToken, userEmail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreBook", ctx, bookToken, userEmail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreBook indicates an expected call of RestoreBook.
+func (mr *MockServiceMockRecorder) RestoreBook(ctx, bookToken, userEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreBook", reflect.TypeOf((*MockService)(nil).RestoreBook), ctx, bookToken, userEmail)
+}
+
+// RestoreBookVersion mocks base method.
+func (m *MockService) RestoreBookVersion(ctx context.Context, bookToken string, version int, editorEmail string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreBookVersion", ctx, bookToken, version, editorEmail)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreBookVersion indicates an expected call of RestoreBookVersion.
+func (mr *MockServiceMockRecorder) RestoreBookVersion(ctx, bookToken, version, editorEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreBookVersion", reflect.TypeOf((*MockService)(nil).RestoreBookVersion), ctx, bookToken, version, editorEmail)
+}
+
+// SearchBooksContent mocks base method.
+func (m *MockService) SearchBooksContent(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.ContentHit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchBooksContent", ctx, filter, sorting)
+	ret0, _ := ret[0].(*[]models.ContentHit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchBooksContent indicates an expected call of SearchBooksContent.
+func (mr *MockServiceMockRecorder) SearchBooksContent(ctx, filter, sorting interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchBooksContent", reflect.TypeOf((*MockService)(nil).SearchBooksContent), ctx, filter, sorting)
 }
 
 // SignIn mocks base method.
-func (m *MockService) SignIn(user models.UserDataInput) (string, error) {
+func (m *MockService) SignIn(ctx context.Context, user models.UserDataInput) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SignIn", user)
+	ret := m.ctrl.Call(m, "SignIn", ctx, user)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SignIn indicates an expected call of SignIn.
-func (mr *MockServiceMockRecorder) SignIn(user interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) SignIn(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignIn", reflect.TypeOf((*MockService)(nil).SignIn), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignIn", reflect.TypeOf((*MockService)(nil).SignIn), ctx, user)
 }
 
 // SignUp mocks base method.
-func (m *MockService) SignUp(user models.UserDataInput) (string, error) {
+func (m *MockService) SignUp(ctx context.Context, user models.UserDataInput) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SignUp", user)
+	ret := m.ctrl.Call(m, "SignUp", ctx, user)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SignUp indicates an expected call of SignUp.
-func (mr *MockServiceMockRecorder) SignUp(user interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) SignUp(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignUp", reflect.TypeOf((*MockService)(nil).SignUp), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignUp", reflect.TypeOf((*MockService)(nil).SignUp), ctx, user)
 }
 
 // UpdateBook mocks base method.
-func (m *MockService) UpdateBook(bookFileToken string, updater models.BookDataUpdater) error {
+func (m *MockService) UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editorEmail string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBook", bookFileToken, updater)
+	ret := m.ctrl.Call(m, "UpdateBook", ctx, bookFileToken, updater, editorEmail)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateBook indicates an expected call of UpdateBook.
-func (mr *MockServiceMockRecorder) UpdateBook(bookFileToken, updater interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) UpdateBook(ctx, bookFileToken, updater, editorEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBook", reflect.TypeOf((*MockService)(nil).UpdateBook), ctx, bookFileToken, updater, editorEmail)
+}
+
+// UpdateBookCover mocks base method.
+func (m *MockService) UpdateBookCover(ctx context.Context, bookToken string, image []byte, fileName, userEmail string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBookCover", ctx, bookToken, image, fileName, userEmail)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateBookCover indicates an expected call of UpdateBookCover.
+func (mr *MockServiceMockRecorder) UpdateBookCover(ctx, bookToken, image, fileName, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBook", reflect.TypeOf((*MockService)(nil).UpdateBook), bookFileToken, updater)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBookCover", reflect.TypeOf((*MockService)(nil).UpdateBookCover), ctx, bookToken, image, fileName, userEmail)
 }
 
 // UploadFile mocks base method.
-func (m *MockService) UploadFile(file []byte, fileName string) (string, error) {
+func (m *MockService) UploadFile(ctx context.Context, file []byte, fileName, userEmail string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadFile", file, fileName)
+	ret := m.ctrl.Call(m, "UploadFile", ctx, file, fileName, userEmail)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UploadFile indicates an expected call of UploadFile.
-func (mr *MockServiceMockRecorder) UploadFile(file, fileName interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) UploadFile(ctx, file, fileName, userEmail interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockService)(nil).UploadFile), file, fileName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockService)(nil).UploadFile), ctx, file, fileName, userEmail)
 }
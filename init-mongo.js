@@ -3,11 +3,24 @@ db = db.getSiblingDB('crudbooks');
 db.createCollection('books');
 db.createCollection('files');
 db.createCollection('users');
+db.createCollection('pages');
+db.createCollection('fileDeletions');
+db.createCollection('blobs');
+db.createCollection('bookVersions');
 
 db.books.createIndex({ title: "text" })
 db.books.createIndex({ fileToken: 1 }, { unique: true })
 db.files.createIndex({ token: 1 }, { unique: true })
 db.users.createIndex({ email: 1 }, { unique: true })
+db.pages.createIndex({ text: "text" })
+db.pages.createIndex({ fileToken: 1, page: 1 }, { unique: true })
+db.fileDeletions.createIndex({ token: 1 }, { unique: true })
+db.fileDeletions.createIndex({ nextAttemptAt: 1 })
+db.blobs.createIndex({ storageToken: 1 })
+db.bookVersions.createIndex({ bookId: 1, version: 1 }, { unique: true })
+db.bookVersions.createIndex({ fileToken: 1 })
+db.books.createIndex({ "covers.token": 1 })
+db.books.createIndex({ owner: 1, deletedAt: 1 })
 
 db.createUser(
 	{
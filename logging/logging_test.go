@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func Test_New(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{name: "json", level: "info", format: "json"},
+		{name: "text", level: "debug", format: "TEXT"},
+		{name: "bad level", level: "loud", format: "json", wantErr: true},
+		{name: "bad format", level: "info", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := New(&bytes.Buffer{}, tt.level, tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, logger)
+		})
+	}
+}
+
+func Test_New_Level(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, "warn", FormatJSON)
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	records := decodeLines(t, buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "shown", records[0]["msg"])
+}
+
+func Test_Redact(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, "info", FormatJSON)
+	require.NoError(t, err)
+
+	logger.Info("sign in",
+		"email", "user@mail.com",
+		"password", "qwerty",
+		"accessToken", "abc.def.ghi",
+		"header", "Bearer abc.def.ghi",
+		"file_token", "gofile-id",
+	)
+
+	records := decodeLines(t, buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "user@mail.com", records[0]["email"])
+	assert.Equal(t, redacted, records[0]["password"])
+	assert.Equal(t, redacted, records[0]["accessToken"])
+	assert.Equal(t, redacted, records[0]["header"])
+	assert.Equal(t, "gofile-id", records[0]["file_token"])
+	assert.NotContains(t, buf.String(), "qwerty")
+	assert.NotContains(t, buf.String(), "abc.def.ghi")
+}
+
+func Test_RequestIDInRecords(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, "info", FormatJSON)
+	require.NoError(t, err)
+
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "with id")
+	logger.With("component", "test").InfoContext(context.Background(), "without id")
+
+	records := decodeLines(t, buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "req-1", records[0][requestIDKey])
+	assert.NotContains(t, records[1], requestIDKey)
+	assert.Equal(t, "test", records[1]["component"])
+}
+
+func Test_Middleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, "info", FormatJSON)
+	require.NoError(t, err)
+
+	var seen string
+	e := echo.New()
+	e.Use(Middleware(logger))
+	e.GET("/books/:id", func(c echo.Context) error {
+		seen = RequestID(c.Request().Context())
+		logger.InfoContext(c.Request().Context(), "inside handler")
+		if c.Param("id") == "broken" {
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		return c.String(http.StatusOK, "")
+	})
+
+	t.Run("client id", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/books/1", nil)
+		req.Header.Set(echo.HeaderXRequestID, "client-id")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, "client-id", rec.Header().Get(echo.HeaderXRequestID))
+		assert.Equal(t, "client-id", seen)
+
+		records := decodeLines(t, buf)
+		require.Len(t, records, 2)
+		assert.Equal(t, "client-id", records[0][requestIDKey])
+		assert.Equal(t, "request served", records[1]["msg"])
+		assert.Equal(t, "client-id", records[1][requestIDKey])
+		assert.Equal(t, "/books/:id", records[1]["route"])
+		assert.Equal(t, float64(http.StatusOK), records[1]["status"])
+		assert.Equal(t, "INFO", records[1]["level"])
+	})
+
+	t.Run("generated id", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/books/broken", nil)
+		req.Header.Set(echo.HeaderXRequestID, strings.Repeat("x", maxRequestIDLen+1))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(echo.HeaderXRequestID)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, seen)
+
+		records := decodeLines(t, buf)
+		require.Len(t, records, 2)
+		assert.Equal(t, id, records[1][requestIDKey])
+		assert.Equal(t, float64(http.StatusInternalServerError), records[1]["status"])
+		assert.Equal(t, "ERROR", records[1]["level"])
+	})
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware)
+	e.GET("/books/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.String(http.StatusOK, "")
+	})
+
+	for _, path := range []string{"/books/1", "/books/2", "/books/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/books/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/books/:id", "404")))
+}
+
+func Test_ObserveStorage(t *testing.T) {
+	ObserveStorage("deleteContent", time.Now(), nil)
+	ObserveStorage("deleteContent", time.Now(), errors.New("unavailable"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(storageFailures.WithLabelValues("deleteContent")))
+}
+
+func Test_IncLogins(t *testing.T) {
+	IncLogins(true)
+	IncLogins(false)
+	IncLogins(false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(logins.WithLabelValues("success")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(logins.WithLabelValues("failure")))
+}
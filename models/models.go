@@ -1,24 +1,57 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrAccessDenied = errors.New("access denied")
+	ErrNoCover      = errors.New("book has no cover")
+)
+
 type UserData struct {
 	Id           string `bson:"_id,omitempty"`
 	Email        string `bson:"email"`
 	PasswordHash string `bson:"passwordHash"`
+	FolderId     string `bson:"folderId,omitempty"`
 }
 
 type BookData struct {
-	Id          string `bson:"_id,omitempty"`
-	Title       string `bson:"title"`
-	Description string `bson:"description"`
-	FileToken   string `bson:"fileToken"`
-	Url         string `bson:"url"`
-	OwnerEmail  string `bson:"owner"`
+	Id          string     `bson:"_id,omitempty"`
+	Title       string     `bson:"title"`
+	Description string     `bson:"description"`
+	FileToken   string     `bson:"fileToken"`
+	Url         string     `bson:"url"`
+	OwnerEmail  string     `bson:"owner"`
+	CoverUrl    string     `bson:"coverUrl" json:"coverUrl"`
+	Covers      []Cover    `bson:"covers" json:"covers"`
+	CustomCover bool       `bson:"customCover,omitempty" json:"-"`
+	MimeType    string     `bson:"mimeType" json:"mimeType"`
+	DeletedAt   *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	Private     bool       `bson:"private,omitempty" json:"private"`
+}
+
+type BookVersion struct {
+	Id           string    `bson:"_id,omitempty" json:"-"`
+	BookId       string    `bson:"bookId" json:"-"`
+	Version      int       `bson:"version" json:"version"`
+	Title        string    `bson:"title" json:"title"`
+	Description  string    `bson:"description" json:"description"`
+	FileToken    string    `bson:"fileToken" json:"fileToken"`
+	Editor       string    `bson:"editor" json:"editor,omitempty"`
+	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+	RestoredFrom int       `bson:"restoredFrom,omitempty" json:"restoredFrom,omitempty"`
 }
 
 type BookDataUpdater struct {
 	FileToken   string `json:"fileToken"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	Private     *bool  `json:"private,omitempty"`
 }
 
 type UserDataInput struct {
@@ -27,14 +60,65 @@ type UserDataInput struct {
 }
 
 type FileData struct {
-	Id           string `bson:"_id,omitempty" json:"id"`
-	Token        string `bson:"token" json:"token"`
-	DownloadPage string `bson:"downloadPage" json:"downloadPage"`
+	Id            string       `bson:"_id,omitempty" json:"id"`
+	Token         string       `bson:"token" json:"token"`
+	DownloadPage  string       `bson:"downloadPage" json:"downloadPage"`
+	MimeType      string       `bson:"mimeType" json:"mimeType"`
+	Metadata      FileMetadata `bson:"metadata" json:"metadata"`
+	Covers        []Cover      `bson:"covers" json:"covers"`
+	StorageToken  string       `bson:"storageToken,omitempty" json:"-"`
+	Sha256        string       `bson:"sha256,omitempty" json:"sha256"`
+	Md5           string       `bson:"md5,omitempty" json:"md5"`
+	Released      bool         `bson:"released,omitempty" json:"-"`
+	FolderId      string       `bson:"folderId,omitempty" json:"-"`
+	Indexed       bool         `bson:"indexed,omitempty" json:"-"`
+	IndexAttempts int          `bson:"indexAttempts,omitempty" json:"-"`
+}
+
+// Blob is a stored object shared by every file with the same content.
+type Blob struct {
+	Sha256       string `bson:"_id"`
+	StorageToken string `bson:"storageToken"`
+	DownloadPage string `bson:"downloadPage"`
+	FolderId     string `bson:"folderId,omitempty"`
+	RefCount     int    `bson:"refCount"`
+}
+
+// StoredFile is a file as listed by the storage backend.
+type StoredFile struct {
+	Token    string
+	Name     string
+	FolderId string
+	Size     int64
+	Md5      string
+}
+
+type Cover struct {
+	Width int    `bson:"width" json:"width"`
+	Token string `bson:"token" json:"token"`
+	Url   string `bson:"url" json:"url"`
+}
+
+// CoverUrl is the route the app serves a cover of a book from. Stored files
+// only have a download page, which can't be used as an image source.
+func CoverUrl(bookToken string, width int) string {
+	return fmt.Sprintf("/api/v1/books/%s/cover?width=%d", url.PathEscape(bookToken), width)
+}
+
+type FileMetadata struct {
+	Pages        int       `bson:"pages" json:"pages"`
+	Title        string    `bson:"title" json:"title"`
+	Author       string    `bson:"author" json:"author"`
+	Subject      string    `bson:"subject" json:"subject"`
+	Keywords     string    `bson:"keywords" json:"keywords"`
+	CreationDate time.Time `bson:"creationDate,omitempty" json:"creationDate,omitempty"`
+	Size         int64     `bson:"size" json:"size"`
 }
 
 type Filter struct {
 	Email  string
 	Search string
+	Format string
 }
 
 type Sort struct {
@@ -47,6 +131,7 @@ type Sort struct {
 type ParamsAfterValidation struct {
 	Email  string
 	Search string
+	Format string
 
 	SortField string
 	Direction int
@@ -61,8 +146,75 @@ type CreateBookRequest struct {
 	Description string `json:"description"`
 }
 
+type FileDeletion struct {
+	Id            string    `bson:"_id,omitempty"`
+	Token         string    `bson:"token"`
+	CreatedAt     time.Time `bson:"createdAt"`
+	Attempts      int       `bson:"attempts"`
+	LastError     string    `bson:"lastError"`
+	NextAttemptAt time.Time `bson:"nextAttemptAt"`
+}
+
+type PageText struct {
+	FileToken string `bson:"fileToken"`
+	Page      int    `bson:"page"`
+	Text      string `bson:"text"`
+}
+
+type ContentHit struct {
+	BookId  string `json:"bookId"`
+	Page    int    `json:"page"`
+	Snippet string `json:"snippet"`
+}
+
+// BookFile is the content of a book opened for download.
+type BookFile struct {
+	Name     string
+	MimeType string
+	Size     int64
+	ETag     string
+	Content  io.ReadSeekCloser
+}
+
 type GetBookResponse struct {
 	FileURL     string `json:"fileURL"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	CoverURL    string `json:"coverUrl"`
+	MimeType    string `json:"mimeType"`
+}
+
+// ReconcileReport lists disagreements between the database and the storage.
+type ReconcileReport struct {
+	CheckedFiles int              `json:"checkedFiles"`
+	CheckedBooks int              `json:"checkedBooks"`
+	StoredFiles  int              `json:"storedFiles"`
+	Missing      []ReconcileEntry `json:"missing"`
+	Dangling     []ReconcileEntry `json:"dangling"`
+	Orphans      []ReconcileEntry `json:"orphans"`
+}
+
+type ReconcileEntry struct {
+	Token  string `json:"token"`
+	Detail string `json:"detail"`
+	Fixed  bool   `json:"fixed"`
+}
+
+type HealthCheck struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+}
+
+type WorkerStatus struct {
+	Running   bool       `json:"running"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// Readiness is the state of every dependency the app needs to serve traffic.
+type Readiness struct {
+	Status  string                  `json:"status"`
+	Checks  map[string]HealthCheck  `json:"checks"`
+	Workers map[string]WorkerStatus `json:"workers"`
 }
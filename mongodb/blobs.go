@@ -0,0 +1,164 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AcquireBlob takes a reference to already stored content. It returns nil
+// when nothing with this hash is stored or the object is being deleted.
+func (m *MongoDB) AcquireBlob(ctx context.Context, sha256 string) (*models.Blob, error) {
+	defer metrics.ObserveMongo("AcquireBlob", time.Now())
+
+	filter := bson.M{"_id": sha256, "refCount": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"refCount": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	res := m.blobsCollection.FindOneAndUpdate(ctx, filter, update, opts)
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if res.Err() != nil {
+		return nil, fmt.Errorf("acquiring blob error: %w", res.Err())
+	}
+
+	var blob models.Blob
+	err := res.Decode(&blob)
+	if err != nil {
+		return nil, fmt.Errorf("decoding blob error: %w", err)
+	}
+
+	return &blob, nil
+}
+
+func (m *MongoDB) CreateBlob(ctx context.Context, blob models.Blob) error {
+	defer metrics.ObserveMongo("CreateBlob", time.Now())
+
+	_, err := m.blobsCollection.InsertOne(ctx, blob)
+	if err != nil {
+		return fmt.Errorf("inserting blob error: %w", err)
+	}
+	return nil
+}
+
+// ReleaseBlob drops a reference taken for an upload which failed before its
+// file was recorded, and reports how many references are left. Content whose
+// blob wasn't registered has no other references.
+func (m *MongoDB) ReleaseBlob(ctx context.Context, sha256, storageToken string) (int, error) {
+	defer metrics.ObserveMongo("ReleaseBlob", time.Now())
+
+	filter := bson.M{"_id": sha256, "storageToken": storageToken}
+	update := bson.M{"$inc": bson.M{"refCount": -1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	res := m.blobsCollection.FindOneAndUpdate(ctx, filter, update, opts)
+	if res.Err() == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if res.Err() != nil {
+		return 0, fmt.Errorf("releasing blob error: %w", res.Err())
+	}
+
+	var blob models.Blob
+	err := res.Decode(&blob)
+	if err != nil {
+		return 0, fmt.Errorf("decoding blob error: %w", err)
+	}
+	if blob.RefCount < 0 {
+		return 0, nil
+	}
+
+	return blob.RefCount, nil
+}
+
+// ReleaseFile drops the reference a file holds on its stored object and
+// reports how many references are left. Releasing is recorded on the file, so
+// retrying after a failed storage deletion doesn't decrement twice.
+func (m *MongoDB) ReleaseFile(ctx context.Context, token string) (string, int, error) {
+	defer metrics.ObserveMongo("ReleaseFile", time.Now())
+
+	res := m.filesCollection.FindOne(ctx, bson.M{"token": token})
+	if res.Err() == mongo.ErrNoDocuments {
+		// covers are stored without a file record
+		return token, 0, nil
+	}
+	if res.Err() != nil {
+		return "", 0, fmt.Errorf("find file error: %w", res.Err())
+	}
+
+	var f models.FileData
+	err := res.Decode(&f)
+	if err != nil {
+		return "", 0, fmt.Errorf("decoding filedata error: %w", err)
+	}
+
+	storageToken := f.StorageToken
+	if storageToken == "" {
+		storageToken = f.Token
+	}
+	if f.Sha256 == "" {
+		return storageToken, 0, nil
+	}
+
+	blobFilter := bson.M{"_id": f.Sha256, "storageToken": storageToken}
+
+	if !f.Released {
+		marked, err := m.filesCollection.UpdateOne(ctx,
+			bson.M{"token": token, "released": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"released": true}})
+		if err != nil {
+			return "", 0, fmt.Errorf("marking file released error: %w", err)
+		}
+		if marked.ModifiedCount == 1 {
+			_, err = m.blobsCollection.UpdateOne(ctx, blobFilter, bson.M{"$inc": bson.M{"refCount": -1}})
+			if err != nil {
+				return "", 0, fmt.Errorf("releasing blob error: %w", err)
+			}
+		}
+	}
+
+	var blob models.Blob
+	err = m.blobsCollection.FindOne(ctx, blobFilter).Decode(&blob)
+	if err == mongo.ErrNoDocuments {
+		// the upload lost a race for the blob and owns its object alone
+		return storageToken, 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("find blob error: %w", err)
+	}
+	if blob.RefCount < 0 {
+		return storageToken, 0, nil
+	}
+
+	return storageToken, blob.RefCount, nil
+}
+
+func (m *MongoDB) DeleteBlob(ctx context.Context, storageToken string) error {
+	defer metrics.ObserveMongo("DeleteBlob", time.Now())
+
+	filter := bson.M{"storageToken": storageToken, "refCount": bson.M{"$lte": 0}}
+	_, err := m.blobsCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("deleting blob error: %w", err)
+	}
+	return nil
+}
+
+// ForgetBlob removes the blob of a lost stored object regardless of its
+// references, so the same content is uploaded again instead of shared.
+func (m *MongoDB) ForgetBlob(ctx context.Context, storageToken string) error {
+	defer metrics.ObserveMongo("ForgetBlob", time.Now())
+
+	_, err := m.blobsCollection.DeleteOne(ctx, bson.M{"storageToken": storageToken})
+	if err != nil {
+		return fmt.Errorf("forgetting blob error: %w", err)
+	}
+	return nil
+}
@@ -4,20 +4,26 @@ import (
 	"context"
 	"crud-books/config"
 	"fmt"
-	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 const (
 	usersCollectionName = "users"
 	booksCollectionName = "books"
 	filesCollectionName = "files"
+	pagesCollectionName = "pages"
+	blobsCollectionName = "blobs"
+
+	versionsCollectionName = "bookVersions"
+
+	deletionsCollectionName = "fileDeletions"
 )
 
-func (m *MongoDB) Connect(cfg *config.Config) error {
+func (m *MongoDB) Connect(ctx context.Context, cfg *config.Config) error {
 	credential := options.Credential{
 		AuthMechanism: "SCRAM-SHA-1",
 		AuthSource:    cfg.DatabaseName,
@@ -26,7 +32,8 @@ func (m *MongoDB) Connect(cfg *config.Config) error {
 	}
 	opts := options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s/", cfg.DatabaseHost, cfg.DatabasePort))
 	opts.SetAuth(credential)
-	client, err := mongo.Connect(context.TODO(), opts)
+	opts.SetMonitor(otelmongo.NewMonitor())
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return fmt.Errorf("connecting to db failed, error: %w", err)
 	}
@@ -35,16 +42,17 @@ func (m *MongoDB) Connect(cfg *config.Config) error {
 	m.booksCollection = db.Collection(booksCollectionName)
 	m.usersCollection = db.Collection(usersCollectionName)
 	m.filesCollection = db.Collection(filesCollectionName)
+	m.pagesCollection = db.Collection(pagesCollectionName)
+	m.deletionsCollection = db.Collection(deletionsCollectionName)
+	m.blobsCollection = db.Collection(blobsCollectionName)
+	m.versionsCollection = db.Collection(versionsCollectionName)
 	m.db = db
 
 	return nil
 }
 
-func (m MongoDB) Ping() error {
-	ctxPing, cancelPing := context.WithTimeout(context.Background(), time.Second*15)
-	defer cancelPing()
-
-	err := m.db.Client().Ping(ctxPing, readpref.Primary())
+func (m MongoDB) Ping(ctx context.Context) error {
+	err := m.db.Client().Ping(ctx, readpref.Primary())
 
 	if err != nil {
 		return fmt.Errorf("ping error: %w", err)
@@ -52,3 +60,14 @@ func (m MongoDB) Ping() error {
 
 	return nil
 }
+
+// Disconnect closes the connections of the client once in-flight operations
+// finish or ctx is done.
+func (m MongoDB) Disconnect(ctx context.Context) error {
+	err := m.db.Client().Disconnect(ctx)
+	if err != nil {
+		return fmt.Errorf("disconnect error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnqueueFileDeletions records the intent to remove stored objects. Entries are
+// unique per token so enqueueing the same object twice is a no-op.
+func (m *MongoDB) EnqueueFileDeletions(ctx context.Context, tokens ...string) error {
+	defer metrics.ObserveMongo("EnqueueFileDeletions", time.Now())
+
+	now := time.Now().UTC()
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		filter := bson.M{"token": token}
+		update := bson.M{
+			"$setOnInsert": bson.M{
+				"token":         token,
+				"createdAt":     now,
+				"attempts":      0,
+				"nextAttemptAt": now,
+			},
+		}
+		_, err := m.deletionsCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("enqueue deletion of %s error: %w", token, err)
+		}
+	}
+	return nil
+}
+
+func (m *MongoDB) GetFileDeletions(ctx context.Context, before time.Time, limit int) ([]models.FileDeletion, error) {
+	defer metrics.ObserveMongo("GetFileDeletions", time.Now())
+
+	filter := bson.M{"nextAttemptAt": bson.M{"$lte": before}}
+	opts := options.Find().SetSort(bson.M{"nextAttemptAt": 1}).SetLimit(int64(limit))
+
+	cursor, err := m.deletionsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find file deletions error: %w", err)
+	}
+
+	var deletions []models.FileDeletion
+	err = cursor.All(ctx, &deletions)
+	if err != nil {
+		return nil, fmt.Errorf("decoding file deletions error: %w", err)
+	}
+
+	return deletions, nil
+}
+
+func (m *MongoDB) PostponeFileDeletion(ctx context.Context, token string, attempts int, lastError string, next time.Time) error {
+	defer metrics.ObserveMongo("PostponeFileDeletion", time.Now())
+
+	filter := bson.M{"token": token}
+	update := bson.M{
+		"$set": bson.M{
+			"attempts":      attempts,
+			"lastError":     lastError,
+			"nextAttemptAt": next,
+		}}
+
+	_, err := m.deletionsCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("postpone file deletion error: %w", err)
+	}
+	return nil
+}
+
+// CompleteFileDeletion removes every record of an object that was deleted
+// from the storage backend.
+func (m *MongoDB) CompleteFileDeletion(ctx context.Context, token string) error {
+	defer metrics.ObserveMongo("CompleteFileDeletion", time.Now())
+
+	_, err := m.filesCollection.DeleteOne(ctx, bson.M{"token": token})
+	if err != nil {
+		return fmt.Errorf("deleting file data error: %w", err)
+	}
+	_, err = m.pagesCollection.DeleteMany(ctx, bson.M{"fileToken": token})
+	if err != nil {
+		return fmt.Errorf("deleting file pages error: %w", err)
+	}
+	return m.DropFileDeletion(ctx, token)
+}
+
+func (m *MongoDB) DropFileDeletion(ctx context.Context, token string) error {
+	defer metrics.ObserveMongo("DropFileDeletion", time.Now())
+
+	_, err := m.deletionsCollection.DeleteOne(ctx, bson.M{"token": token})
+	if err != nil {
+		return fmt.Errorf("deleting file deletion entry error: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoDB) IsFileReferenced(ctx context.Context, token string) (bool, error) {
+	defer metrics.ObserveMongo("IsFileReferenced", time.Now())
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"fileToken": token},
+		bson.M{"covers.token": token},
+	}}
+	count, err := m.booksCollection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("count books referencing file error: %w", err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	// earlier versions keep their files restorable
+	count, err = m.versionsCollection.CountDocuments(ctx, bson.M{"fileToken": token}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("count versions referencing file error: %w", err)
+	}
+	return count > 0, nil
+}
+
+// EnqueueOrphanFiles schedules deletion of files which were uploaded before
+// createdBefore but never attached to a book, together with the covers
+// rendered for them. The upload time is taken from the ObjectID, so files
+// recorded before the GC existed are covered too.
+func (m *MongoDB) EnqueueOrphanFiles(ctx context.Context, createdBefore time.Time) (int, error) {
+	defer metrics.ObserveMongo("EnqueueOrphanFiles", time.Now())
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(createdBefore)}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         booksCollectionName,
+			"localField":   "token",
+			"foreignField": "fileToken",
+			"as":           "books",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         versionsCollectionName,
+			"localField":   "token",
+			"foreignField": "fileToken",
+			"as":           "versions",
+		}}},
+		{{Key: "$match", Value: bson.M{"books": bson.M{"$size": 0}, "versions": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"token": 1, "covers": 1}}},
+	}
+
+	cursor, err := m.filesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("find orphan files error: %w", err)
+	}
+
+	var orphans []models.FileData
+	err = cursor.All(ctx, &orphans)
+	if err != nil {
+		return 0, fmt.Errorf("decoding orphan files error: %w", err)
+	}
+
+	var tokens []string
+	for i := range orphans {
+		tokens = append(tokens, fileDataTokens(&orphans[i])...)
+	}
+	err = m.EnqueueFileDeletions(ctx, tokens...)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(orphans), nil
+}
+
+// fileDataTokens lists the stored objects of a file record: the file itself
+// and the covers rendered for it, which have no file record of their own.
+func fileDataTokens(f *models.FileData) []string {
+	tokens := []string{f.Token}
+	for _, c := range f.Covers {
+		tokens = append(tokens, c.Token)
+	}
+	return tokens
+}
+
+func bookFileTokens(book *models.BookData) []string {
+	tokens := []string{book.FileToken}
+	for _, c := range book.Covers {
+		tokens = append(tokens, c.Token)
+	}
+	return tokens
+}
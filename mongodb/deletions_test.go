@@ -0,0 +1,18 @@
+package mongodb
+
+import (
+	"crud-books/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileDataTokens(t *testing.T) {
+	f := models.FileData{
+		Token:  "file",
+		Covers: []models.Cover{{Width: 160, Token: "small"}, {Width: 480, Token: "large"}},
+	}
+	assert.Equal(t, []string{"file", "small", "large"}, fileDataTokens(&f))
+
+	assert.Equal(t, []string{"file"}, fileDataTokens(&models.FileData{Token: "file"}))
+}
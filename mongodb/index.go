@@ -3,10 +3,14 @@ package mongodb
 import "go.mongodb.org/mongo-driver/mongo"
 
 type MongoDB struct {
-	booksCollection *mongo.Collection
-	usersCollection *mongo.Collection
-	filesCollection *mongo.Collection
-	db              *mongo.Database
+	booksCollection     *mongo.Collection
+	usersCollection     *mongo.Collection
+	filesCollection     *mongo.Collection
+	pagesCollection     *mongo.Collection
+	deletionsCollection *mongo.Collection
+	blobsCollection     *mongo.Collection
+	versionsCollection  *mongo.Collection
+	db                  *mongo.Database
 }
 
 func New() *MongoDB {
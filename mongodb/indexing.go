@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetUnindexedFiles returns files whose content isn't searchable yet and which
+// are due for an attempt at now. Files stored before indexing was tracked
+// have no flag and are picked up as well.
+func (m *MongoDB) GetUnindexedFiles(ctx context.Context, now time.Time, limit int) ([]models.FileData, error) {
+	defer metrics.ObserveMongo("GetUnindexedFiles", time.Now())
+
+	filter := bson.M{
+		"indexed":     bson.M{"$ne": true},
+		"released":    bson.M{"$ne": true},
+		"nextIndexAt": bson.M{"$not": bson.M{"$gt": now}},
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit))
+
+	cursor, err := m.filesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find unindexed files error: %w", err)
+	}
+
+	var files []models.FileData
+	err = cursor.All(ctx, &files)
+	if err != nil {
+		return nil, fmt.Errorf("decoding unindexed files error: %w", err)
+	}
+
+	return files, nil
+}
+
+// MarkFileIndexed stops further indexing attempts for a file. indexError
+// records why the content couldn't be indexed, if it couldn't.
+func (m *MongoDB) MarkFileIndexed(ctx context.Context, token, indexError string) error {
+	defer metrics.ObserveMongo("MarkFileIndexed", time.Now())
+
+	filter := bson.M{"token": token}
+	update := bson.M{
+		"$set":   bson.M{"indexed": true, "indexError": indexError},
+		"$unset": bson.M{"nextIndexAt": ""},
+	}
+
+	_, err := m.filesCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("marking file indexed error: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoDB) PostponeIndexing(ctx context.Context, token string, attempts int, lastError string, next time.Time) error {
+	defer metrics.ObserveMongo("PostponeIndexing", time.Now())
+
+	filter := bson.M{"token": token}
+	update := bson.M{
+		"$set": bson.M{
+			"indexAttempts": attempts,
+			"indexError":    lastError,
+			"nextIndexAt":   next,
+		}}
+
+	_, err := m.filesCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("postpone indexing error: %w", err)
+	}
+	return nil
+}
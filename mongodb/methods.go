@@ -2,8 +2,11 @@ package mongodb
 
 import (
 	"context"
+	"crud-books/formats"
+	"crud-books/metrics"
 	"crud-books/models"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,9 +14,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (m *MongoDB) GetBook(bookToken string) (*models.BookData, error) {
-	searchByFileToken := bson.M{"fileToken": bookToken}
-	result := m.booksCollection.FindOne(context.TODO(), searchByFileToken)
+func (m *MongoDB) GetBook(ctx context.Context, bookToken string) (*models.BookData, error) {
+	defer metrics.ObserveMongo("GetBook", time.Now())
+
+	searchByFileToken := bson.M{"fileToken": bookToken, "deletedAt": nil}
+	result := m.booksCollection.FindOne(ctx, searchByFileToken)
 	if result.Err() == mongo.ErrNoDocuments {
 		return nil, mongo.ErrNoDocuments
 	}
@@ -26,10 +31,12 @@ func (m *MongoDB) GetBook(bookToken string) (*models.BookData, error) {
 	return &bookData, nil
 }
 
-func (m *MongoDB) CreateUser(email, passwordHash string) (string, error) {
+func (m *MongoDB) CreateUser(ctx context.Context, email, passwordHash string) (string, error) {
+	defer metrics.ObserveMongo("CreateUser", time.Now())
+
 	doc := bson.M{"email": email, "passwordHash": passwordHash, "booksIds": []bson.M{}}
 
-	cur, err := m.usersCollection.InsertOne(context.TODO(), doc)
+	cur, err := m.usersCollection.InsertOne(ctx, doc)
 	if err != nil {
 		return "", fmt.Errorf("insert user error: %w", err)
 	}
@@ -42,8 +49,10 @@ func (m *MongoDB) CreateUser(email, passwordHash string) (string, error) {
 	return id.Hex(), nil
 }
 
-func (m *MongoDB) CreateBook(title, description, fileToken, emailOwner string) (string, error) {
-	fileData, err := m.GetFileData(fileToken)
+func (m *MongoDB) CreateBook(ctx context.Context, title, description, fileToken, emailOwner string) (string, error) {
+	defer metrics.ObserveMongo("CreateBook", time.Now())
+
+	fileData, err := m.GetFileData(ctx, fileToken)
 	if err != nil {
 		return "", fmt.Errorf("getting file data error: %w", err)
 	}
@@ -54,34 +63,54 @@ func (m *MongoDB) CreateBook(title, description, fileToken, emailOwner string) (
 		FileToken:   fileToken,
 		OwnerEmail:  emailOwner,
 		Url:         fileData.DownloadPage,
+		CoverUrl:    largestCoverUrl(fileData.Covers),
+		Covers:      fileData.Covers,
+		MimeType:    fileData.MimeType,
 	}
 
-	_, err = m.booksCollection.InsertOne(context.TODO(), dBook)
+	res, err := m.booksCollection.InsertOne(ctx, dBook)
 	if err != nil {
 		return "", fmt.Errorf("inserting book error: %w", err)
 	}
 
+	id, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("converting book id error")
+	}
+	err = m.appendBookVersion(ctx, models.BookVersion{
+		BookId:      id.Hex(),
+		Title:       dBook.Title,
+		Description: dBook.Description,
+		FileToken:   dBook.FileToken,
+		Editor:      emailOwner,
+	})
+	if err != nil {
+		return "", err
+	}
+
 	return dBook.FileToken, nil
 }
 
-func (m *MongoDB) GetListBooks(filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+func (m *MongoDB) GetListBooks(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+	defer metrics.ObserveMongo("GetListBooks", time.Now())
 
 	params := ValidateParams(filter, sort)
 
-	search := bson.M{}
+	search := bson.M{"deletedAt": nil, "private": bson.M{"$ne": true}}
 	opts := getFindOptions(params)
 
 	if params.Search != "" {
-		search = bson.M{"$text": bson.M{"$search": params.Search}}
+		search["$text"] = bson.M{"$search": params.Search}
 	}
+	addFormatFilter(search, params.Format)
 
-	cursor, err := m.booksCollection.Find(context.TODO(), search, opts)
+	cursor, err := m.booksCollection.Find(ctx, search, opts)
 	if err != nil {
 		return nil, fmt.Errorf("find books error: %w", err)
 	}
 
 	var res []models.BookData
-	err = cursor.All(context.TODO(), &res)
+	err = cursor.All(ctx, &res)
 	if err != nil {
 		return nil, fmt.Errorf("decoding bookData's error: %w", err)
 	}
@@ -89,32 +118,35 @@ func (m *MongoDB) GetListBooks(filter models.Filter, sort models.Sort) ([]models
 	return res, nil
 }
 
-func (m *MongoDB) GetListBooksUser(filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+func (m *MongoDB) GetListBooksUser(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+	defer metrics.ObserveMongo("GetListBooksUser", time.Now())
+
 	params := ValidateParams(filter, sort)
 
-	userData, err := m.GetUserData(params.Email)
+	userData, err := m.GetUserData(ctx, params.Email)
 	if err != nil {
 		return nil, err
 	}
 
 	var bookFilter bson.M
 
-	bookFilter = bson.M{"owner": userData.Email, "$text": bson.M{"$search": params.Search}}
+	bookFilter = bson.M{"owner": userData.Email, "deletedAt": nil, "$text": bson.M{"$search": params.Search}}
 
 	if params.Search == "" {
-		bookFilter = bson.M{"owner": userData.Email}
+		bookFilter = bson.M{"owner": userData.Email, "deletedAt": nil}
 	}
+	addFormatFilter(bookFilter, params.Format)
 
 	opts := getFindOptions(params)
 
-	booksCur, err := m.booksCollection.Find(context.TODO(), bookFilter, opts)
+	booksCur, err := m.booksCollection.Find(ctx, bookFilter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("book find error: %w", err)
 	}
 
 	var books []models.BookData
 
-	err = booksCur.All(context.TODO(), &books)
+	err = booksCur.All(ctx, &books)
 	if err != nil {
 		return nil, fmt.Errorf("decoding bookData's error: %w", err)
 	}
@@ -122,34 +154,90 @@ func (m *MongoDB) GetListBooksUser(filter models.Filter, sort models.Sort) ([]mo
 	return books, nil
 }
 
-func (m *MongoDB) UpdateBook(bookFileToken string, updater models.BookDataUpdater) error {
-	_, err := m.GetFileData(updater.FileToken)
+func (m *MongoDB) UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editor string) error {
+	defer metrics.ObserveMongo("UpdateBook", time.Now())
+
+	fileData, err := m.GetFileData(ctx, updater.FileToken)
 	if err != nil {
 		return fmt.Errorf("filetoken should be only as existed fileTokens")
 	}
-	filter := bson.M{"fileToken": bookFileToken}
+
+	return m.reviseBook(ctx, bookFileToken, updater, fileData, editor, 0)
+}
+
+func (m *MongoDB) UpdateBookCover(ctx context.Context, bookFileToken string, cover models.Cover) error {
+	defer metrics.ObserveMongo("UpdateBookCover", time.Now())
+
+	filter := bson.M{"fileToken": bookFileToken, "deletedAt": nil}
 	update := bson.M{
 		"$set": bson.M{
-			"title":       updater.Title,
-			"description": updater.Description,
-			"fileToken":   updater.FileToken,
+			"coverUrl":    cover.Url,
+			"covers":      []models.Cover{cover},
+			"customCover": true,
 		}}
 
-	res := m.booksCollection.FindOneAndUpdate(context.TODO(), filter, update)
+	res := m.booksCollection.FindOneAndUpdate(ctx, filter, update)
 	if res.Err() == mongo.ErrNoDocuments {
 		return fmt.Errorf("book doesn't exist")
 	}
+	if res.Err() != nil {
+		return fmt.Errorf("updating book cover error: %w", res.Err())
+	}
+
+	var previous models.BookData
+	err := res.Decode(&previous)
+	if err != nil {
+		return fmt.Errorf("decoding previous book error: %w", err)
+	}
+	for _, c := range previous.Covers {
+		err = m.EnqueueFileDeletions(ctx, c.Token)
+		if err != nil {
+			return fmt.Errorf("enqueue previous cover deletion error: %w", err)
+		}
+	}
 
 	return nil
 }
 
-func (m *MongoDB) UploadFileData(fileData *models.FileData) error {
+// addFormatFilter narrows a books query to one MIME type. Books created before
+// formats were introduced have no mimeType and are always PDFs.
+func addFormatFilter(filter bson.M, format string) {
+	if format == "" {
+		return
+	}
+	if format == formats.MimePDF {
+		filter["mimeType"] = bson.M{"$in": bson.A{format, nil}}
+		return
+	}
+	filter["mimeType"] = format
+}
+
+func largestCoverUrl(covers []models.Cover) string {
+	url, width := "", 0
+	for _, c := range covers {
+		if c.Width > width {
+			url, width = c.Url, c.Width
+		}
+	}
+	return url
+}
+
+func (m *MongoDB) UploadFileData(ctx context.Context, fileData *models.FileData) error {
+	defer metrics.ObserveMongo("UploadFileData", time.Now())
+
 	doc := bson.M{
 		"token":        fileData.Token,
 		"downloadPage": fileData.DownloadPage,
+		"mimeType":     fileData.MimeType,
+		"metadata":     fileData.Metadata,
+		"covers":       fileData.Covers,
+		"storageToken": fileData.StorageToken,
+		"sha256":       fileData.Sha256,
+		"md5":          fileData.Md5,
+		"folderId":     fileData.FolderId,
 	}
 
-	_, err := m.filesCollection.InsertOne(context.TODO(), doc)
+	_, err := m.filesCollection.InsertOne(ctx, doc)
 	if err != nil {
 		return fmt.Errorf("upload file error: %w", err)
 	}
@@ -157,11 +245,13 @@ func (m *MongoDB) UploadFileData(fileData *models.FileData) error {
 	return nil
 }
 
-func (m *MongoDB) GetFileData(fileToken string) (*models.FileData, error) {
+func (m *MongoDB) GetFileData(ctx context.Context, fileToken string) (*models.FileData, error) {
+	defer metrics.ObserveMongo("GetFileData", time.Now())
+
 	filter := bson.M{"token": fileToken}
 
 	var f models.FileData
-	cur := m.filesCollection.FindOne(context.TODO(), filter)
+	cur := m.filesCollection.FindOne(ctx, filter)
 	if cur.Err() != nil {
 		return nil, fmt.Errorf("find files error: %w", cur.Err())
 	}
@@ -171,13 +261,27 @@ func (m *MongoDB) GetFileData(fileToken string) (*models.FileData, error) {
 		return nil, fmt.Errorf("decoding filedata error: %w", err)
 	}
 
-	return &models.FileData{Id: f.Id, Token: f.Token, DownloadPage: f.DownloadPage}, nil
+	return &models.FileData{
+		Id:           f.Id,
+		Token:        f.Token,
+		DownloadPage: f.DownloadPage,
+		MimeType:     f.MimeType,
+		Metadata:     f.Metadata,
+		Covers:       f.Covers,
+		StorageToken: f.StorageToken,
+		Sha256:       f.Sha256,
+		Md5:          f.Md5,
+		Released:     f.Released,
+		FolderId:     f.FolderId,
+	}, nil
 }
 
-func (m *MongoDB) GetUserData(email string) (*models.UserData, error) {
+func (m *MongoDB) GetUserData(ctx context.Context, email string) (*models.UserData, error) {
+	defer metrics.ObserveMongo("GetUserData", time.Now())
+
 	searchByEmail := bson.M{"email": email}
 
-	userData, err := m.getUserData(searchByEmail)
+	userData, err := m.getUserData(ctx, searchByEmail)
 	if err != nil {
 		return nil, fmt.Errorf("getUserData error: %w", err)
 	}
@@ -185,13 +289,15 @@ func (m *MongoDB) GetUserData(email string) (*models.UserData, error) {
 	return userData, nil
 }
 
-func (m *MongoDB) GetUserDataById(userId string) (*models.UserData, error) {
+func (m *MongoDB) GetUserDataById(ctx context.Context, userId string) (*models.UserData, error) {
+	defer metrics.ObserveMongo("GetUserDataById", time.Now())
+
 	objId, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return nil, fmt.Errorf("convert userId from hex failed: %w", err)
 	}
 	searchById := bson.M{"_id": objId}
-	userData, err := m.getUserData(searchById)
+	userData, err := m.getUserData(ctx, searchById)
 	if err != nil {
 		return nil, fmt.Errorf("getting uData error: %w", err)
 	}
@@ -199,18 +305,69 @@ func (m *MongoDB) GetUserDataById(userId string) (*models.UserData, error) {
 	return userData, nil
 }
 
-func (m MongoDB) DeleteBook(bookId string) error {
-	filter := bson.M{"fileToken": bookId}
-	res := m.booksCollection.FindOneAndDelete(context.TODO(), filter)
+// SetUserFolder records the storage folder of a user unless one is already
+// set, and returns the folder the user ends up with. When two uploads race to
+// create the folder, the first recorded one wins.
+func (m *MongoDB) SetUserFolder(ctx context.Context, email, folderId string) (string, error) {
+	defer metrics.ObserveMongo("SetUserFolder", time.Now())
+
+	filter := bson.M{"email": email, "folderId": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"folderId": folderId}}
+
+	res, err := m.usersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return "", fmt.Errorf("setting user folder error: %w", err)
+	}
+	if res.ModifiedCount == 1 {
+		return folderId, nil
+	}
+
+	userData, err := m.GetUserData(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if userData.FolderId == "" {
+		return "", fmt.Errorf("setting user folder error: user doesn't exist")
+	}
+	return userData.FolderId, nil
+}
+
+// UpdatePasswordHash replaces the password hash of a user if it is still
+// oldHash, so a password changed in the meantime isn't overwritten.
+func (m *MongoDB) UpdatePasswordHash(ctx context.Context, email, oldHash, newHash string) error {
+	defer metrics.ObserveMongo("UpdatePasswordHash", time.Now())
+
+	filter := bson.M{"email": email, "passwordHash": oldHash}
+	update := bson.M{"$set": bson.M{"passwordHash": newHash}}
+
+	_, err := m.usersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("updating password hash error: %w", err)
+	}
+	return nil
+}
+
+// DeleteBook moves a book of ownerEmail to the trash. Trashed books keep their
+// files until they are purged.
+func (m MongoDB) DeleteBook(ctx context.Context, bookId, ownerEmail string) error {
+	defer metrics.ObserveMongo("DeleteBook", time.Now())
+
+	filter := bson.M{"fileToken": bookId, "owner": ownerEmail, "deletedAt": nil}
+	update := bson.M{"$set": bson.M{"deletedAt": time.Now().UTC()}}
+
+	res := m.booksCollection.FindOneAndUpdate(ctx, filter, update)
 	if res.Err() == mongo.ErrNoDocuments {
 		return fmt.Errorf("deleting file failed, file doesn't exist")
 	}
+	if res.Err() != nil {
+		return fmt.Errorf("moving book to trash error: %w", res.Err())
+	}
 
 	return nil
 }
 
-func (m *MongoDB) getUserData(filter bson.M) (*models.UserData, error) {
-	userCur := m.usersCollection.FindOne(context.TODO(), filter)
+func (m *MongoDB) getUserData(ctx context.Context, filter bson.M) (*models.UserData, error) {
+	userCur := m.usersCollection.FindOne(ctx, filter)
 
 	if userCur.Err() == mongo.ErrNoDocuments {
 		return nil, mongo.ErrNoDocuments
@@ -232,3 +389,66 @@ func getFindOptions(params *models.ParamsAfterValidation) *options.FindOptions {
 
 	return fOpt
 }
+
+func (m *MongoDB) SavePages(ctx context.Context, fileToken string, pages []models.PageText) error {
+	defer metrics.ObserveMongo("SavePages", time.Now())
+
+	_, err := m.pagesCollection.DeleteMany(ctx, bson.M{"fileToken": fileToken})
+	if err != nil {
+		return fmt.Errorf("deleting previous pages error: %w", err)
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(pages))
+	for _, p := range pages {
+		docs = append(docs, p)
+	}
+	_, err = m.pagesCollection.InsertMany(ctx, docs)
+	if err != nil {
+		return fmt.Errorf("inserting pages error: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MongoDB) SearchPages(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.PageText, error) {
+	defer metrics.ObserveMongo("SearchPages", time.Now())
+
+	params := ValidateParams(filter, sort)
+
+	bookFilter := bson.M{"deletedAt": nil, "private": bson.M{"$ne": true}}
+	if params.Email != "" {
+		bookFilter = bson.M{"deletedAt": nil, "owner": params.Email}
+	}
+	bookMatch := bson.M{"book": bson.M{"$elemMatch": bookFilter}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$text": bson.M{"$search": params.Search}}}},
+		{{Key: "$sort", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         booksCollectionName,
+			"localField":   "fileToken",
+			"foreignField": "fileToken",
+			"as":           "book",
+		}}},
+		{{Key: "$match", Value: bookMatch}},
+		{{Key: "$skip", Value: params.Offset}},
+		{{Key: "$limit", Value: params.Limit}},
+		{{Key: "$project", Value: bson.M{"book": 0}}},
+	}
+
+	cursor, err := m.pagesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("search pages error: %w", err)
+	}
+
+	var pages []models.PageText
+	err = cursor.All(ctx, &pages)
+	if err != nil {
+		return nil, fmt.Errorf("decoding pages error: %w", err)
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,47 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetAllFileData returns every uploaded file record.
+func (m *MongoDB) GetAllFileData(ctx context.Context) ([]models.FileData, error) {
+	defer metrics.ObserveMongo("GetAllFileData", time.Now())
+
+	cursor, err := m.filesCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("find files error: %w", err)
+	}
+
+	var files []models.FileData
+	err = cursor.All(ctx, &files)
+	if err != nil {
+		return nil, fmt.Errorf("decoding files error: %w", err)
+	}
+
+	return files, nil
+}
+
+// GetAllBooks returns every book, trashed ones included.
+func (m *MongoDB) GetAllBooks(ctx context.Context) ([]models.BookData, error) {
+	defer metrics.ObserveMongo("GetAllBooks", time.Now())
+
+	cursor, err := m.booksCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("find books error: %w", err)
+	}
+
+	var books []models.BookData
+	err = cursor.All(ctx, &books)
+	if err != nil {
+		return nil, fmt.Errorf("decoding books error: %w", err)
+	}
+
+	return books, nil
+}
@@ -0,0 +1,96 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoDB) GetTrash(ctx context.Context, ownerEmail string) ([]models.BookData, error) {
+	defer metrics.ObserveMongo("GetTrash", time.Now())
+
+	filter := bson.M{"owner": ownerEmail, "deletedAt": bson.M{"$ne": nil}}
+	opts := options.Find().SetSort(bson.M{"deletedAt": -1})
+
+	cursor, err := m.booksCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find trashed books error: %w", err)
+	}
+
+	var books []models.BookData
+	err = cursor.All(ctx, &books)
+	if err != nil {
+		return nil, fmt.Errorf("decoding bookData's error: %w", err)
+	}
+
+	return books, nil
+}
+
+func (m *MongoDB) RestoreBook(ctx context.Context, bookToken, ownerEmail string) error {
+	defer metrics.ObserveMongo("RestoreBook", time.Now())
+
+	filter := bson.M{"fileToken": bookToken, "owner": ownerEmail, "deletedAt": bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}}
+
+	res := m.booksCollection.FindOneAndUpdate(ctx, filter, update)
+	if res.Err() == mongo.ErrNoDocuments {
+		return fmt.Errorf("book isn't in the trash")
+	}
+	if res.Err() != nil {
+		return fmt.Errorf("restoring book error: %w", res.Err())
+	}
+
+	return nil
+}
+
+// PurgeTrash permanently deletes books trashed before deletedBefore. Stored
+// files are enqueued for deletion before the book document is removed, so
+// the intent survives a failure between the two steps.
+func (m *MongoDB) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	defer metrics.ObserveMongo("PurgeTrash", time.Now())
+
+	filter := bson.M{"deletedAt": bson.M{"$lte": deletedBefore}}
+
+	cursor, err := m.booksCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("find expired trash error: %w", err)
+	}
+
+	var books []models.BookData
+	err = cursor.All(ctx, &books)
+	if err != nil {
+		return 0, fmt.Errorf("decoding bookData's error: %w", err)
+	}
+
+	purged := 0
+	for i := range books {
+		versionTokens, err := m.versionFileTokens(ctx, books[i].Id)
+		if err != nil {
+			return purged, err
+		}
+
+		err = m.EnqueueFileDeletions(ctx, append(bookFileTokens(&books[i]), versionTokens...)...)
+		if err != nil {
+			return purged, fmt.Errorf("enqueue book files deletion error: %w", err)
+		}
+
+		_, err = m.booksCollection.DeleteOne(ctx, bson.M{"fileToken": books[i].FileToken, "deletedAt": bson.M{"$lte": deletedBefore}})
+		if err != nil {
+			return purged, fmt.Errorf("deleting book error: %w", err)
+		}
+
+		_, err = m.versionsCollection.DeleteMany(ctx, bson.M{"bookId": books[i].Id})
+		if err != nil {
+			return purged, fmt.Errorf("deleting book versions error: %w", err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
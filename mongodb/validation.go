@@ -13,6 +13,7 @@ func ValidateParams(filter models.Filter, sort models.Sort) *models.ParamsAfterV
 	p := new(models.ParamsAfterValidation)
 	p.Email = filter.Email
 	p.Search = filter.Search
+	p.Format = filter.Format
 	p.Limit = sort.Limit
 	p.Offset = sort.Offset
 
@@ -0,0 +1,229 @@
+package mongodb
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoDB) GetBookVersions(ctx context.Context, bookToken string) ([]models.BookVersion, error) {
+	defer metrics.ObserveMongo("GetBookVersions", time.Now())
+
+	book, err := m.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("getting book error: %w", err)
+	}
+
+	filter := bson.M{"bookId": book.Id}
+	opts := options.Find().SetSort(bson.M{"version": 1})
+
+	cursor, err := m.versionsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find book versions error: %w", err)
+	}
+
+	var versions []models.BookVersion
+	err = cursor.All(ctx, &versions)
+	if err != nil {
+		return nil, fmt.Errorf("decoding book versions error: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (m *MongoDB) GetBookVersion(ctx context.Context, bookToken string, version int) (*models.BookVersion, error) {
+	defer metrics.ObserveMongo("GetBookVersion", time.Now())
+
+	book, err := m.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("getting book error: %w", err)
+	}
+
+	return m.getBookVersion(ctx, book.Id, version)
+}
+
+// RestoreBookVersion brings back the title, description and file of an earlier
+// version. The restore itself is recorded as a new version, so the history
+// stays append-only. The book is addressed by its file token, so the returned
+// token is the one to use from now on.
+func (m *MongoDB) RestoreBookVersion(ctx context.Context, bookToken string, version int, editor string) (string, error) {
+	defer metrics.ObserveMongo("RestoreBookVersion", time.Now())
+
+	book, err := m.GetBook(ctx, bookToken)
+	if err != nil {
+		return "", fmt.Errorf("getting book error: %w", err)
+	}
+
+	v, err := m.getBookVersion(ctx, book.Id, version)
+	if err != nil {
+		return "", err
+	}
+
+	fileData, err := m.GetFileData(ctx, v.FileToken)
+	if err != nil {
+		return "", fmt.Errorf("file of version %d isn't available: %w", version, err)
+	}
+
+	updater := models.BookDataUpdater{
+		FileToken:   v.FileToken,
+		Title:       v.Title,
+		Description: v.Description,
+	}
+	err = m.reviseBook(ctx, bookToken, updater, fileData, editor, version)
+	if err != nil {
+		return "", err
+	}
+
+	return v.FileToken, nil
+}
+
+// reviseBook updates a book and appends the result to its history. Books
+// created before the history existed get their current state recorded as the
+// first version beforehand.
+func (m *MongoDB) reviseBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, fileData *models.FileData, editor string, restoredFrom int) error {
+	book, err := m.GetBook(ctx, bookFileToken)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("book doesn't exist")
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.ensureInitialVersion(ctx, book)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"fileToken": bookFileToken, "deletedAt": nil}
+	fields := bson.M{
+		"title":       updater.Title,
+		"description": updater.Description,
+		"fileToken":   updater.FileToken,
+		"url":         fileData.DownloadPage,
+		"mimeType":    fileData.MimeType,
+	}
+	if updater.Private != nil {
+		fields["private"] = *updater.Private
+	}
+	if updater.FileToken != book.FileToken {
+		covers := coversForFile(book, fileData)
+		fields["covers"] = covers
+		fields["coverUrl"] = largestCoverUrl(covers)
+	}
+	update := bson.M{"$set": fields}
+
+	res := m.booksCollection.FindOneAndUpdate(ctx, filter, update)
+	if res.Err() == mongo.ErrNoDocuments {
+		return fmt.Errorf("book doesn't exist")
+	}
+	if res.Err() != nil {
+		return fmt.Errorf("updating book error: %w", res.Err())
+	}
+
+	return m.appendBookVersion(ctx, models.BookVersion{
+		BookId:       book.Id,
+		Title:        updater.Title,
+		Description:  updater.Description,
+		FileToken:    updater.FileToken,
+		Editor:       editor,
+		RestoredFrom: restoredFrom,
+	})
+}
+
+// coversForFile picks the covers of a book moved to another file: the ones
+// rendered for that file, or the custom cover set by the owner. Cover urls
+// contain the book token, which changes with the file.
+func coversForFile(book *models.BookData, fileData *models.FileData) []models.Cover {
+	if !book.CustomCover {
+		return fileData.Covers
+	}
+
+	covers := make([]models.Cover, 0, len(book.Covers))
+	for _, c := range book.Covers {
+		c.Url = models.CoverUrl(fileData.Token, c.Width)
+		covers = append(covers, c)
+	}
+	return covers
+}
+
+func (m *MongoDB) ensureInitialVersion(ctx context.Context, book *models.BookData) error {
+	count, err := m.versionsCollection.CountDocuments(ctx, bson.M{"bookId": book.Id}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("count book versions error: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	createdAt := time.Now().UTC()
+	if id, err := primitive.ObjectIDFromHex(book.Id); err == nil {
+		createdAt = id.Timestamp().UTC()
+	}
+
+	return m.appendBookVersion(ctx, models.BookVersion{
+		BookId:      book.Id,
+		Title:       book.Title,
+		Description: book.Description,
+		FileToken:   book.FileToken,
+		Editor:      book.OwnerEmail,
+		CreatedAt:   createdAt,
+	})
+}
+
+// appendBookVersion stores the next version number of a book. The unique
+// index on {bookId, version} rejects a concurrent writer that picked the same
+// number.
+func (m *MongoDB) appendBookVersion(ctx context.Context, v models.BookVersion) error {
+	var last models.BookVersion
+	opts := options.FindOne().SetSort(bson.M{"version": -1})
+	err := m.versionsCollection.FindOne(ctx, bson.M{"bookId": v.BookId}, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("find last book version error: %w", err)
+	}
+
+	v.Version = last.Version + 1
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = time.Now().UTC()
+	}
+
+	_, err = m.versionsCollection.InsertOne(ctx, v)
+	if err != nil {
+		return fmt.Errorf("inserting book version error: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoDB) getBookVersion(ctx context.Context, bookId string, version int) (*models.BookVersion, error) {
+	var v models.BookVersion
+	err := m.versionsCollection.FindOne(ctx, bson.M{"bookId": bookId, "version": version}).Decode(&v)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("version %d doesn't exist", version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find book version error: %w", err)
+	}
+	return &v, nil
+}
+
+// versionFileTokens lists every file a book's history refers to.
+func (m *MongoDB) versionFileTokens(ctx context.Context, bookId string) ([]string, error) {
+	values, err := m.versionsCollection.Distinct(ctx, "fileToken", bson.M{"bookId": bookId})
+	if err != nil {
+		return nil, fmt.Errorf("find version files error: %w", err)
+	}
+
+	tokens := make([]string, 0, len(values))
+	for _, v := range values {
+		if token, ok := v.(string); ok {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,34 @@
+package mongodb
+
+import (
+	"crud-books/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CoversForFile(t *testing.T) {
+	fileData := models.FileData{
+		Token:  "new",
+		Covers: []models.Cover{{Width: 160, Token: "new-small", Url: models.CoverUrl("new", 160)}},
+	}
+
+	t.Run("rendered", func(t *testing.T) {
+		book := models.BookData{
+			FileToken: "old",
+			Covers:    []models.Cover{{Width: 160, Token: "old-small", Url: models.CoverUrl("old", 160)}},
+		}
+		assert.Equal(t, fileData.Covers, coversForFile(&book, &fileData))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		book := models.BookData{
+			FileToken:   "old",
+			Covers:      []models.Cover{{Width: 300, Token: "custom", Url: models.CoverUrl("old", 300)}},
+			CustomCover: true,
+		}
+		assert.Equal(t, []models.Cover{
+			{Width: 300, Token: "custom", Url: "/api/v1/books/new/cover?width=300"},
+		}, coversForFile(&book, &fileData))
+	})
+}
@@ -0,0 +1,492 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	headerMagic     = "%PDF-"
+	startxrefWindow = 1024
+	maxXrefSections = 64
+)
+
+type xrefEntry struct {
+	compressed bool
+	offset     int
+	stream     int
+	index      int
+}
+
+type Document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	Trailer Dict
+
+	objStreams map[int][]Object
+}
+
+// Open parses the document structure: header, cross-reference sections and
+// trailer. Object bodies are parsed lazily when resolved.
+func Open(data []byte) (*Document, error) {
+	if !bytes.HasPrefix(data, []byte(headerMagic)) {
+		return nil, ErrNotPDF
+	}
+
+	d := &Document{
+		data:       data,
+		xref:       map[int]xrefEntry{},
+		objStreams: map[int][]Object{},
+	}
+
+	offset, err := d.findStartxref()
+	if err != nil {
+		return nil, corrupted(err)
+	}
+
+	err = d.readXrefChain(offset)
+	if err != nil {
+		return nil, corrupted(err)
+	}
+
+	if _, ok := d.Trailer["Root"]; !ok {
+		return nil, corrupted(fmt.Errorf("trailer has no /Root"))
+	}
+
+	return d, nil
+}
+
+func (d *Document) Encrypted() bool {
+	_, ok := d.Trailer["Encrypt"]
+	return ok
+}
+
+func (d *Document) findStartxref() (int, error) {
+	from := len(d.data) - startxrefWindow
+	if from < 0 {
+		from = 0
+	}
+	idx := bytes.LastIndex(d.data[from:], []byte("startxref"))
+	if idx < 0 {
+		return 0, fmt.Errorf("startxref not found")
+	}
+
+	l := newLexer(d.data, from+idx+len("startxref"))
+	obj, err := l.readObject()
+	if err != nil {
+		return 0, fmt.Errorf("reading startxref offset: %w", err)
+	}
+	offset, ok := toInt(obj)
+	if !ok || offset <= 0 || offset >= len(d.data) {
+		return 0, fmt.Errorf("startxref offset %v is out of file bounds", obj)
+	}
+
+	return offset, nil
+}
+
+func (d *Document) readXrefChain(offset int) error {
+	seen := map[int]bool{}
+	for i := 0; offset > 0; i++ {
+		if i >= maxXrefSections || seen[offset] {
+			return fmt.Errorf("cross-reference chain loops at offset %d", offset)
+		}
+		if offset >= len(d.data) {
+			return fmt.Errorf("cross-reference offset %d is out of file bounds", offset)
+		}
+		seen[offset] = true
+
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if d.Trailer == nil {
+			d.Trailer = trailer
+		}
+
+		if hybrid, ok := trailer.Int("XRefStm"); ok && !seen[hybrid] {
+			seen[hybrid] = true
+			_, err := d.readXrefStream(hybrid)
+			if err != nil {
+				return err
+			}
+		}
+
+		prev, ok := trailer.Int("Prev")
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	return nil
+}
+
+func (d *Document) readXrefSection(offset int) (Dict, error) {
+	l := newLexer(d.data, offset)
+	l.skipSpace()
+	if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		return d.readXrefTable(l)
+	}
+	return d.readXrefStream(offset)
+}
+
+func (d *Document) readXrefTable(l *lexer) (Dict, error) {
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return nil, fmt.Errorf("reading xref table: %w", err)
+		}
+		if obj == Keyword("trailer") {
+			break
+		}
+
+		start, ok := toInt(obj)
+		if !ok {
+			return nil, fmt.Errorf("xref subsection start expected, got %v", obj)
+		}
+		obj, err = l.readObject()
+		if err != nil {
+			return nil, fmt.Errorf("reading xref table: %w", err)
+		}
+		count, ok := toInt(obj)
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("xref subsection count expected, got %v", obj)
+		}
+
+		for i := 0; i < count; i++ {
+			offObj, err := l.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("reading xref entry: %w", err)
+			}
+			genObj, err := l.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("reading xref entry: %w", err)
+			}
+			kind, err := l.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("reading xref entry: %w", err)
+			}
+			off, okOff := toInt(offObj)
+			_, okGen := toInt(genObj)
+			if !okOff || !okGen || (kind != Keyword("n") && kind != Keyword("f")) {
+				return nil, fmt.Errorf("malformed xref entry for object %d", start+i)
+			}
+			if kind == Keyword("f") {
+				continue
+			}
+			if off <= 0 || off >= len(d.data) {
+				return nil, fmt.Errorf("object %d offset %d is out of file bounds", start+i, off)
+			}
+			if _, exists := d.xref[start+i]; !exists {
+				d.xref[start+i] = xrefEntry{offset: off}
+			}
+		}
+	}
+
+	obj, err := l.readObject()
+	if err != nil {
+		return nil, fmt.Errorf("reading trailer: %w", err)
+	}
+	trailer, ok := obj.(Dict)
+	if !ok {
+		return nil, fmt.Errorf("trailer should be a dictionary")
+	}
+	return trailer, nil
+}
+
+func (d *Document) readXrefStream(offset int) (Dict, error) {
+	_, obj, err := d.readIndirectAt(offset)
+	if err != nil {
+		return nil, fmt.Errorf("reading xref stream: %w", err)
+	}
+	stream, ok := obj.(Stream)
+	if !ok || stream.Dict.Name("Type") != "XRef" {
+		return nil, fmt.Errorf("no cross-reference data at offset %d", offset)
+	}
+
+	data, err := d.DecodeStream(stream)
+	if err != nil {
+		return nil, fmt.Errorf("decoding xref stream: %w", err)
+	}
+
+	wArr, ok := stream.Dict["W"].(Array)
+	if !ok || len(wArr) != 3 {
+		return nil, fmt.Errorf("xref stream has invalid /W")
+	}
+	var w [3]int
+	rowLen := 0
+	for i, v := range wArr {
+		n, ok := toInt(v)
+		if !ok || n < 0 || n > 8 {
+			return nil, fmt.Errorf("xref stream has invalid /W")
+		}
+		w[i] = n
+		rowLen += n
+	}
+	if rowLen == 0 {
+		return nil, fmt.Errorf("xref stream has invalid /W")
+	}
+
+	size, _ := stream.Dict.Int("Size")
+	index := Array{int64(0), int64(size)}
+	if idx, ok := stream.Dict["Index"].(Array); ok {
+		index = idx
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := toInt(index[i])
+		count, ok2 := toInt(index[i+1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("xref stream has invalid /Index")
+		}
+		for j := 0; j < count; j++ {
+			if pos+rowLen > len(data) {
+				return nil, fmt.Errorf("xref stream is truncated")
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+
+			typ := 1
+			if w[0] > 0 {
+				typ = readField(row[:w[0]])
+			}
+			f2 := readField(row[w[0] : w[0]+w[1]])
+			f3 := readField(row[w[0]+w[1]:])
+
+			num := start + j
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch typ {
+			case 1:
+				if f2 <= 0 || f2 >= len(d.data) {
+					return nil, fmt.Errorf("object %d offset %d is out of file bounds", num, f2)
+				}
+				d.xref[num] = xrefEntry{offset: f2}
+			case 2:
+				if f2 < 0 || f3 < 0 {
+					return nil, fmt.Errorf("object %d has invalid object stream reference", num)
+				}
+				d.xref[num] = xrefEntry{compressed: true, stream: f2, index: f3}
+			}
+		}
+	}
+
+	return stream.Dict, nil
+}
+
+// readField decodes a big-endian xref stream field. Widths of 8 bytes can
+// overflow int, so callers must reject negative results.
+func readField(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func (d *Document) readIndirectAt(offset int) (Ref, Object, error) {
+	l := newLexer(d.data, offset)
+	numObj, err := l.readObject()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	num, ok := toInt(numObj)
+	if !ok {
+		return Ref{}, nil, fmt.Errorf("object number expected at offset %d", offset)
+	}
+	genObj, err := l.readObject()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	gen, ok := toInt(genObj)
+	if !ok {
+		return Ref{}, nil, fmt.Errorf("generation number expected at offset %d", offset)
+	}
+	err = l.expectKeyword("obj")
+	if err != nil {
+		return Ref{}, nil, err
+	}
+
+	obj, err := l.readObject()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+
+	dict, ok := obj.(Dict)
+	if !ok {
+		return Ref{Num: num, Gen: gen}, obj, nil
+	}
+	l.skipSpace()
+	if !bytes.HasPrefix(d.data[l.pos:], []byte("stream")) {
+		return Ref{Num: num, Gen: gen}, obj, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(d.data) && d.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(d.data) && d.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	raw, err := d.streamData(dict, l.pos)
+	if err != nil {
+		return Ref{}, nil, fmt.Errorf("object %d: %w", num, err)
+	}
+
+	return Ref{Num: num, Gen: gen}, Stream{Dict: dict, Raw: raw}, nil
+}
+
+func (d *Document) streamData(dict Dict, start int) ([]byte, error) {
+	length, ok := toInt(d.resolveLength(dict["Length"]))
+	if ok && length >= 0 && start+length <= len(d.data) {
+		rest := d.data[start+length:]
+		trimmed := bytes.TrimLeft(rest, "\r\n \t")
+		if bytes.HasPrefix(trimmed, []byte("endstream")) {
+			return d.data[start : start+length], nil
+		}
+	}
+
+	end := bytes.Index(d.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("stream has no endstream")
+	}
+	return bytes.TrimRight(d.data[start:start+end], "\r\n"), nil
+}
+
+func (d *Document) resolveLength(o Object) Object {
+	ref, ok := o.(Ref)
+	if !ok {
+		return o
+	}
+	entry, ok := d.xref[ref.Num]
+	if !ok || entry.compressed {
+		return nil
+	}
+	_, obj, err := d.readIndirectAt(entry.offset)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// Resolve follows indirect references until a direct object is reached.
+// Missing objects resolve to nil as the specification requires.
+func (d *Document) Resolve(o Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o, nil
+		}
+		obj, err := d.object(ref.Num)
+		if err != nil {
+			return nil, err
+		}
+		o = obj
+	}
+	return nil, fmt.Errorf("reference chain is too deep")
+}
+
+func (d *Document) ResolveDict(o Object) (Dict, error) {
+	obj, err := d.Resolve(o)
+	if err != nil {
+		return nil, err
+	}
+	switch v := obj.(type) {
+	case Dict:
+		return v, nil
+	case Stream:
+		return v.Dict, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("dictionary expected, got %T", obj)
+}
+
+func (d *Document) object(num int) (Object, error) {
+	entry, ok := d.xref[num]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.compressed {
+		ref, obj, err := d.readIndirectAt(entry.offset)
+		if err != nil {
+			return nil, fmt.Errorf("reading object %d: %w", num, err)
+		}
+		if ref.Num != num {
+			return nil, fmt.Errorf("xref for object %d points to object %d", num, ref.Num)
+		}
+		return obj, nil
+	}
+
+	objects, err := d.objectStream(entry.stream)
+	if err != nil {
+		return nil, fmt.Errorf("reading object %d: %w", num, err)
+	}
+	if entry.index < 0 || entry.index >= len(objects) {
+		return nil, fmt.Errorf("object %d is missing from object stream %d", num, entry.stream)
+	}
+	return objects[entry.index], nil
+}
+
+func (d *Document) objectStream(num int) ([]Object, error) {
+	if objects, ok := d.objStreams[num]; ok {
+		return objects, nil
+	}
+
+	entry, ok := d.xref[num]
+	if !ok || entry.compressed {
+		return nil, fmt.Errorf("object stream %d not found", num)
+	}
+	_, obj, err := d.readIndirectAt(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(Stream)
+	if !ok || stream.Dict.Name("Type") != "ObjStm" {
+		return nil, fmt.Errorf("object %d isn't an object stream", num)
+	}
+	data, err := d.DecodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := stream.Dict.Int("N")
+	if n < 0 || n > len(data) {
+		return nil, fmt.Errorf("object stream %d has invalid /N", num)
+	}
+	first, _ := stream.Dict.Int("First")
+	if first < 0 || first > len(data) {
+		return nil, fmt.Errorf("object stream %d has invalid /First", num)
+	}
+
+	header := newLexer(data[:first], 0)
+	offsets := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := header.readObject(); err != nil {
+			return nil, fmt.Errorf("object stream %d header: %w", num, err)
+		}
+		offObj, err := header.readObject()
+		if err != nil {
+			return nil, fmt.Errorf("object stream %d header: %w", num, err)
+		}
+		off, ok := toInt(offObj)
+		if !ok || off < 0 || first+off > len(data) {
+			return nil, fmt.Errorf("object stream %d header is malformed", num)
+		}
+		offsets = append(offsets, off)
+	}
+
+	objects := make([]Object, 0, n)
+	for _, off := range offsets {
+		obj, err := newLexer(data, first+off).readObject()
+		if err != nil {
+			return nil, fmt.Errorf("object stream %d: %w", num, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	d.objStreams[num] = objects
+	return objects, nil
+}
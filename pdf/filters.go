@@ -0,0 +1,164 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"io"
+)
+
+const maxDecodedStreamSize = 64 << 20
+
+// DecodeStream applies the stream filters and returns the decoded bytes.
+func (d *Document) DecodeStream(s Stream) ([]byte, error) {
+	filterObj, err := d.Resolve(s.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	paramsObj, err := d.Resolve(s.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+
+	var filters Array
+	var params Array
+	switch f := filterObj.(type) {
+	case nil:
+	case Name:
+		filters = Array{f}
+		params = Array{paramsObj}
+	case Array:
+		filters = f
+		if p, ok := paramsObj.(Array); ok {
+			params = p
+		}
+	default:
+		return nil, fmt.Errorf("invalid /Filter %v", filterObj)
+	}
+
+	data := s.Raw
+	for i, f := range filters {
+		name, ok := f.(Name)
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %v", f)
+		}
+		var p Dict
+		if i < len(params) {
+			p, _ = d.ResolveDict(params[i])
+		}
+		data, err = applyFilter(name, p, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return data, nil
+}
+
+func applyFilter(name Name, params Dict, data []byte) ([]byte, error) {
+	switch name {
+	case "FlateDecode", "Fl":
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, maxDecodedStreamSize))
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return unpredict(params, out)
+	case "ASCIIHexDecode", "AHx":
+		l := newLexer(append(bytes.TrimSpace(data), '>'), 0)
+		return l.readHexString()
+	case "ASCII85Decode", "A85":
+		data = bytes.TrimSpace(data)
+		data = bytes.TrimSuffix(data, []byte("~>"))
+		out := make([]byte, len(data))
+		n, _, err := ascii85.Decode(out, data, true)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	}
+	return nil, ErrUnsupportedFilter
+}
+
+func unpredict(params Dict, data []byte) ([]byte, error) {
+	predictor, _ := params.Int("Predictor")
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("TIFF predictor isn't supported")
+	}
+
+	columns := 1
+	if v, ok := params.Int("Columns"); ok {
+		columns = v
+	}
+	colors := 1
+	if v, ok := params.Int("Colors"); ok {
+		colors = v
+	}
+	bpc := 8
+	if v, ok := params.Int("BitsPerComponent"); ok {
+		bpc = v
+	}
+
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (columns*colors*bpc + 7) / 8
+	if rowLen <= 0 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("unknown PNG filter type %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
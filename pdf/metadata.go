@@ -0,0 +1,196 @@
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const maxPageTreeDepth = 64
+
+type Metadata struct {
+	Pages        int
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	CreationDate time.Time
+	Size         int64
+}
+
+// ExtractMetadata reads the document information dictionary and counts the
+// pages. Malformed optional entries are skipped instead of failing the whole
+// extraction.
+func ExtractMetadata(data []byte) (*Metadata, error) {
+	doc, err := Open(data)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{Size: int64(len(data))}
+
+	pages, err := doc.Pages()
+	if err != nil {
+		return nil, fmt.Errorf("reading page tree: %w", err)
+	}
+	meta.Pages = len(pages)
+
+	if doc.Encrypted() {
+		return meta, nil
+	}
+
+	info, err := doc.ResolveDict(doc.Trailer["Info"])
+	if err != nil || info == nil {
+		return meta, nil
+	}
+
+	meta.Title = doc.textString(info["Title"])
+	meta.Author = doc.textString(info["Author"])
+	meta.Subject = doc.textString(info["Subject"])
+	meta.Keywords = doc.textString(info["Keywords"])
+	meta.CreationDate, _ = ParseDate(doc.textString(info["CreationDate"]))
+
+	return meta, nil
+}
+
+// Pages returns the leaf page dictionaries in document order.
+func (d *Document) Pages() ([]Dict, error) {
+	root, err := d.ResolveDict(d.Trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+
+	var pages []Dict
+	visited := map[Ref]bool{}
+	err = d.walkPages(root["Pages"], visited, 0, &pages)
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (d *Document) walkPages(node Object, visited map[Ref]bool, depth int, pages *[]Dict) error {
+	if depth > maxPageTreeDepth {
+		return fmt.Errorf("page tree is too deep")
+	}
+	if ref, ok := node.(Ref); ok {
+		if visited[ref] {
+			return fmt.Errorf("page tree has a cycle at object %d", ref.Num)
+		}
+		visited[ref] = true
+	}
+
+	dict, err := d.ResolveDict(node)
+	if err != nil {
+		return err
+	}
+	if dict == nil {
+		return nil
+	}
+
+	if dict.Name("Type") == "Page" {
+		*pages = append(*pages, dict)
+		return nil
+	}
+
+	kidsObj, err := d.Resolve(dict["Kids"])
+	if err != nil {
+		return err
+	}
+	kids, _ := kidsObj.(Array)
+	for _, kid := range kids {
+		err := d.walkPages(kid, visited, depth+1, pages)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Document) textString(o Object) string {
+	obj, err := d.Resolve(o)
+	if err != nil {
+		return ""
+	}
+	s, ok := obj.(String)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(DecodeText(s))
+}
+
+// DecodeText converts a PDF text string, either UTF-16BE with a byte order
+// mark or PDFDocEncoding, to UTF-8.
+func DecodeText(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(s) >= 3 && s[0] == 0xEF && s[1] == 0xBB && s[2] == 0xBF {
+		return string(s[3:])
+	}
+
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// ParseDate parses dates in the PDF "D:YYYYMMDDHHmmSSOHH'mm'" format where
+// every component after the year is optional.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	if len(s) < 4 || !isDigits(s[:4]) {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	parts := []int{0, 1, 1, 0, 0, 0}
+	widths := []int{4, 2, 2, 2, 2, 2}
+	pos := 0
+	for i, w := range widths {
+		if pos+w > len(s) || !isDigits(s[pos:pos+w]) {
+			break
+		}
+		parts[i], _ = strconv.Atoi(s[pos : pos+w])
+		pos += w
+	}
+
+	loc := time.UTC
+	rest := s[pos:]
+	if len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		tz := strings.ReplaceAll(rest[1:], "'", "")
+		hours, minutes := 0, 0
+		if len(tz) >= 2 {
+			hours, _ = strconv.Atoi(tz[:2])
+		}
+		if len(tz) >= 4 {
+			minutes, _ = strconv.Atoi(tz[2:4])
+		}
+		offset := hours*3600 + minutes*60
+		if rest[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	t := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, loc)
+	return t.UTC(), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package pdf
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExtractMetadata(t *testing.T) {
+	t.Run("info_dictionary", func(t *testing.T) {
+		data := readFixture(t, "valid.pdf")
+
+		meta, err := ExtractMetadata(data)
+		require.NoError(t, err)
+		assert.Equal(t, 2, meta.Pages)
+		assert.Equal(t, "Test Document", meta.Title)
+		assert.Equal(t, "Jane Roe", meta.Author)
+		assert.Equal(t, "Fixture for parser tests", meta.Subject)
+		assert.Equal(t, "pdf, test", meta.Keywords)
+		assert.Equal(t, time.Date(2023, 4, 26, 12, 0, 0, 0, time.UTC), meta.CreationDate)
+		assert.Equal(t, int64(len(data)), meta.Size)
+	})
+
+	t.Run("compressed_objects", func(t *testing.T) {
+		data, err := os.ReadFile("../storage/testsData/file.pdf")
+		require.NoError(t, err)
+
+		meta, err := ExtractMetadata(data)
+		require.NoError(t, err)
+		assert.Equal(t, 1, meta.Pages)
+		assert.Equal(t, int64(len(data)), meta.Size)
+	})
+
+	t.Run("not_pdf", func(t *testing.T) {
+		_, err := ExtractMetadata([]byte("plain text"))
+		assert.ErrorIs(t, err, ErrNotPDF)
+	})
+}
+
+func Test_ParseDate(t *testing.T) {
+	got, err := ParseDate("D:20230426153000+03'00'")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 4, 26, 12, 30, 0, 0, time.UTC), got)
+
+	got, err = ParseDate("D:2021")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), got)
+
+	_, err = ParseDate("yesterday")
+	assert.Error(t, err)
+}
+
+func Test_DecodeText(t *testing.T) {
+	assert.Equal(t, "Книга", DecodeText([]byte("\xfe\xff\x04\x1a\x04\x3d\x04\x38\x04\x33\x04\x30")))
+	assert.Equal(t, "café", DecodeText([]byte("caf\xe9")))
+}
@@ -0,0 +1,399 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+type Object interface{}
+
+type Name string
+
+type Dict map[Name]Object
+
+type Array []Object
+
+type String []byte
+
+type Keyword string
+
+type Ref struct {
+	Num int
+	Gen int
+}
+
+type Stream struct {
+	Dict Dict
+	Raw  []byte
+}
+
+func (d Dict) Name(key Name) Name {
+	n, _ := d[key].(Name)
+	return n
+}
+
+func (d Dict) Int(key Name) (int, bool) {
+	return toInt(d[key])
+}
+
+func toInt(o Object) (int, bool) {
+	switch v := o.(type) {
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// maxNesting bounds how deep arrays and dictionaries may nest. Objects are
+// read recursively, so without it a crafted file overflows the stack.
+const maxNesting = 256
+
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func newLexer(data []byte, pos int) *lexer {
+	return &lexer{data: data, pos: pos}
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !isDelimiter(c)
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *lexer) eof() bool {
+	return l.pos >= len(l.data)
+}
+
+func (l *lexer) readRegular() []byte {
+	start := l.pos
+	for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+		l.pos++
+	}
+	return l.data[start:l.pos]
+}
+
+// readObject reads the next direct object. Integers followed by "G R" are
+// returned as references, any other bare word is returned as a Keyword.
+func (l *lexer) readObject() (Object, error) {
+	l.skipSpace()
+	if l.eof() {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		return l.readName(), nil
+	case c == '(':
+		l.pos++
+		return l.readLiteralString()
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.readDict()
+		}
+		l.pos++
+		return l.readHexString()
+	case c == '[':
+		l.pos++
+		return l.readArray()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return Keyword(c), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumberOrRef()
+	}
+
+	word := l.readRegular()
+	if len(word) == 0 {
+		return nil, fmt.Errorf("unexpected byte %q at offset %d", c, l.pos)
+	}
+	switch string(word) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return Keyword(word), nil
+}
+
+func (l *lexer) readName() Name {
+	raw := l.readRegular()
+	if bytes.IndexByte(raw, '#') < 0 {
+		return Name(raw)
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return Name(out)
+}
+
+func (l *lexer) readLiteralString() (String, error) {
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(out), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *lexer) readHexString() (String, error) {
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, 0)
+			}
+			out := make([]byte, len(digits)/2)
+			for i := range out {
+				out[i] = digits[2*i]<<4 | digits[2*i+1]
+			}
+			return String(out), nil
+		}
+		if isSpace(c) {
+			continue
+		}
+		v, ok := unhex(c)
+		if !ok {
+			return nil, fmt.Errorf("invalid hex string byte %q", c)
+		}
+		digits = append(digits, v)
+	}
+	return nil, fmt.Errorf("unterminated hex string")
+}
+
+// enter accounts for one more level of nesting, leave must be deferred
+// once it succeeds.
+func (l *lexer) enter() error {
+	if l.depth >= maxNesting {
+		return fmt.Errorf("%w: objects are nested deeper than %d levels", ErrCorrupted, maxNesting)
+	}
+	l.depth++
+	return nil
+}
+
+func (l *lexer) leave() {
+	l.depth--
+}
+
+func (l *lexer) readArray() (Array, error) {
+	err := l.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer l.leave()
+
+	arr := Array{}
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		if obj == Keyword("]") {
+			return arr, nil
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *lexer) readDict() (Dict, error) {
+	err := l.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer l.leave()
+
+	dict := Dict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return dict, nil
+		}
+		key, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(Name)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key should be a name, got %v", key)
+		}
+		val, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = val
+	}
+}
+
+func (l *lexer) readNumber() (Object, error) {
+	word := l.readRegular()
+	if bytes.ContainsAny(word, ".") {
+		f, err := strconv.ParseFloat(string(word), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", word)
+		}
+		return f, nil
+	}
+	i, err := strconv.ParseInt(string(word), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", word)
+	}
+	return i, nil
+}
+
+func (l *lexer) readNumberOrRef() (Object, error) {
+	num, err := l.readNumber()
+	if err != nil {
+		return nil, err
+	}
+	n, ok := num.(int64)
+	if !ok || n < 0 {
+		return num, nil
+	}
+
+	save := l.pos
+	l.skipSpace()
+	if l.eof() || l.data[l.pos] < '0' || l.data[l.pos] > '9' {
+		l.pos = save
+		return num, nil
+	}
+	gen, err := l.readNumber()
+	if err != nil {
+		l.pos = save
+		return num, nil
+	}
+	g, ok := gen.(int64)
+	if !ok {
+		l.pos = save
+		return num, nil
+	}
+	l.skipSpace()
+	if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 == len(l.data) || !isRegular(l.data[l.pos+1])) {
+		l.pos++
+		return Ref{Num: int(n), Gen: int(g)}, nil
+	}
+	l.pos = save
+	return num, nil
+}
+
+func (l *lexer) expectKeyword(kw string) error {
+	obj, err := l.readObject()
+	if err != nil {
+		return err
+	}
+	if obj != Keyword(kw) {
+		return fmt.Errorf("expected %q, got %v", kw, obj)
+	}
+	return nil
+}
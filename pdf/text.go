@@ -0,0 +1,375 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const maxInheritanceDepth = 32
+
+// ExtractText returns the text of every page in document order. Pages whose
+// content can't be decoded produce an empty string rather than an error.
+func ExtractText(data []byte) ([]string, error) {
+	doc, err := Open(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Encrypted() {
+		return nil, ErrEncrypted
+	}
+
+	pages, err := doc.Pages()
+	if err != nil {
+		return nil, fmt.Errorf("reading page tree: %w", err)
+	}
+
+	fonts := map[Ref]*font{}
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		content, err := doc.pageContent(page)
+		if err != nil {
+			continue
+		}
+		texts[i] = doc.pageText(page, content, fonts)
+	}
+	return texts, nil
+}
+
+func (d *Document) pageContent(page Dict) ([]byte, error) {
+	obj, err := d.Resolve(page["Contents"])
+	if err != nil {
+		return nil, err
+	}
+
+	var streams Array
+	switch v := obj.(type) {
+	case Stream:
+		streams = Array{v}
+	case Array:
+		streams = v
+	}
+
+	var buf bytes.Buffer
+	for _, s := range streams {
+		resolved, err := d.Resolve(s)
+		if err != nil {
+			return nil, err
+		}
+		stream, ok := resolved.(Stream)
+		if !ok {
+			continue
+		}
+		data, err := d.DecodeStream(stream)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// inherited looks a page attribute up through the /Parent chain.
+func (d *Document) inherited(page Dict, key Name) Object {
+	node := page
+	for i := 0; i < maxInheritanceDepth && node != nil; i++ {
+		if v, ok := node[key]; ok {
+			return v
+		}
+		parent, err := d.ResolveDict(node["Parent"])
+		if err != nil {
+			return nil
+		}
+		node = parent
+	}
+	return nil
+}
+
+func (d *Document) pageText(page Dict, content []byte, cache map[Ref]*font) string {
+	resources, _ := d.ResolveDict(d.inherited(page, "Resources"))
+	var fontDict Dict
+	if resources != nil {
+		fontDict, _ = d.ResolveDict(resources["Font"])
+	}
+
+	var out strings.Builder
+	var operands []Object
+	var current *font
+
+	l := newLexer(content, 0)
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(Keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(Name); ok && fontDict != nil {
+					current = d.loadFont(fontDict[name], cache)
+				}
+			}
+		case "Tj", "'", "\"":
+			if kw != "Tj" {
+				out.WriteByte('\n')
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(String); ok {
+					out.WriteString(current.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				arr, _ := operands[len(operands)-1].(Array)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case String:
+						out.WriteString(current.decode(v))
+					case int64, float64:
+						if n, _ := toInt(v); n < -200 {
+							out.WriteByte(' ')
+						}
+					}
+				}
+			}
+		case "Td", "TD", "T*", "Tm":
+			writeSeparator(&out, ' ')
+		case "ET":
+			writeSeparator(&out, '\n')
+		case "ID":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+func writeSeparator(b *strings.Builder, sep byte) {
+	s := b.String()
+	if len(s) == 0 || s[len(s)-1] == ' ' || s[len(s)-1] == '\n' {
+		return
+	}
+	b.WriteByte(sep)
+}
+
+func skipInlineImage(l *lexer) {
+	end := bytes.Index(l.data[l.pos:], []byte("EI"))
+	for end >= 0 {
+		at := l.pos + end
+		before := at == 0 || isSpace(l.data[at-1])
+		after := at+2 >= len(l.data) || isSpace(l.data[at+2])
+		if before && after {
+			l.pos = at + 2
+			return
+		}
+		next := bytes.Index(l.data[at+2:], []byte("EI"))
+		if next < 0 {
+			break
+		}
+		end = at + 2 + next - l.pos
+	}
+	l.pos = len(l.data)
+}
+
+type font struct {
+	toUnicode map[string]string
+	codeLens  []int
+	composite bool
+}
+
+func (d *Document) loadFont(o Object, cache map[Ref]*font) *font {
+	ref, isRef := o.(Ref)
+	if isRef {
+		if f, ok := cache[ref]; ok {
+			return f
+		}
+	}
+
+	f := &font{}
+	dict, err := d.ResolveDict(o)
+	if err == nil && dict != nil {
+		f.composite = dict.Name("Subtype") == "Type0"
+		if cmapObj, err := d.Resolve(dict["ToUnicode"]); err == nil {
+			if stream, ok := cmapObj.(Stream); ok {
+				if data, err := d.DecodeStream(stream); err == nil {
+					f.toUnicode, f.codeLens = parseToUnicode(data)
+				}
+			}
+		}
+	}
+
+	if isRef {
+		cache[ref] = f
+	}
+	return f
+}
+
+func (f *font) decode(s String) string {
+	if f == nil || len(f.toUnicode) == 0 {
+		if f != nil && f.composite {
+			return ""
+		}
+		return DecodeText(s)
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range f.codeLens {
+			if i+n > len(s) {
+				continue
+			}
+			if u, ok := f.toUnicode[string(s[i:i+n])]; ok {
+				out.WriteString(u)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if !f.composite {
+				out.WriteRune(rune(s[i]))
+			}
+			i++
+		}
+	}
+	return out.String()
+}
+
+var errCMapEnd = errors.New("end of cmap")
+
+// parseToUnicode reads the bfchar and bfrange sections of a ToUnicode CMap.
+func parseToUnicode(data []byte) (map[string]string, []int) {
+	m := map[string]string{}
+	lens := map[int]bool{}
+	l := newLexer(data, 0)
+
+	var operands []Object
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(Keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		operands = operands[:0]
+
+		switch kw {
+		case "beginbfchar":
+			if readBfChar(l, m, lens) == errCMapEnd {
+				return m, sortedLens(lens)
+			}
+		case "beginbfrange":
+			if readBfRange(l, m, lens) == errCMapEnd {
+				return m, sortedLens(lens)
+			}
+		}
+	}
+	return m, sortedLens(lens)
+}
+
+func readBfChar(l *lexer, m map[string]string, lens map[int]bool) error {
+	for {
+		src, err := l.readObject()
+		if err != nil {
+			return errCMapEnd
+		}
+		if src == Keyword("endbfchar") {
+			return nil
+		}
+		dst, err := l.readObject()
+		if err != nil {
+			return errCMapEnd
+		}
+		code, ok1 := src.(String)
+		uni, ok2 := dst.(String)
+		if ok1 && ok2 && len(code) > 0 {
+			m[string(code)] = utf16BE(uni)
+			lens[len(code)] = true
+		}
+	}
+}
+
+func readBfRange(l *lexer, m map[string]string, lens map[int]bool) error {
+	for {
+		loObj, err := l.readObject()
+		if err != nil {
+			return errCMapEnd
+		}
+		if loObj == Keyword("endbfrange") {
+			return nil
+		}
+		hiObj, err := l.readObject()
+		if err != nil {
+			return errCMapEnd
+		}
+		dstObj, err := l.readObject()
+		if err != nil {
+			return errCMapEnd
+		}
+
+		lo, ok1 := loObj.(String)
+		hi, ok2 := hiObj.(String)
+		if !ok1 || !ok2 || len(lo) == 0 || len(lo) != len(hi) || len(lo) > 4 {
+			continue
+		}
+		start, end := readField(lo), readField(hi)
+		if end < start || end-start > 0xFFFF {
+			continue
+		}
+		lens[len(lo)] = true
+
+		for code := start; code <= end; code++ {
+			key := make([]byte, len(lo))
+			for i, v := len(key)-1, code; i >= 0; i, v = i-1, v>>8 {
+				key[i] = byte(v)
+			}
+
+			switch dst := dstObj.(type) {
+			case String:
+				uni := append([]byte(nil), dst...)
+				if len(uni) > 0 {
+					uni[len(uni)-1] += byte(code - start)
+				}
+				m[string(key)] = utf16BE(uni)
+			case Array:
+				if idx := code - start; idx < len(dst) {
+					if s, ok := dst[idx].(String); ok {
+						m[string(key)] = utf16BE(s)
+					}
+				}
+			}
+		}
+	}
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func sortedLens(lens map[int]bool) []int {
+	var out []int
+	for n := 4; n >= 1; n-- {
+		if lens[n] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
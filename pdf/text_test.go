@@ -0,0 +1,56 @@
+package pdf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExtractText(t *testing.T) {
+	t.Run("per_page", func(t *testing.T) {
+		pages, err := ExtractText(readFixture(t, "valid.pdf"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Hello PDF", "Second page"}, pages)
+	})
+
+	t.Run("compressed_objects", func(t *testing.T) {
+		data, err := os.ReadFile("../storage/testsData/file.pdf")
+		require.NoError(t, err)
+
+		pages, err := ExtractText(data)
+		require.NoError(t, err)
+		assert.Len(t, pages, 1)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		_, err := ExtractText(readFixture(t, "encrypted.pdf"))
+		assert.ErrorIs(t, err, ErrEncrypted)
+	})
+}
+
+func Test_ParseToUnicode(t *testing.T) {
+	cmap := []byte(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0011> <041A>
+endbfchar
+2 beginbfrange
+<0020> <0022> <0061>
+<0030> <0031> [<0078> <0079>]
+endbfrange
+endcmap`)
+
+	m, lens := parseToUnicode(cmap)
+	assert.Equal(t, []int{2}, lens)
+
+	f := &font{toUnicode: m, codeLens: lens, composite: true}
+	got := f.decode(String("\x00\x11\x00\x03\x00\x20\x00\x21\x00\x22\x00\x30\x00\x31"))
+	assert.Equal(t, "К abcxy", got)
+}
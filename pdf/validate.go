@@ -0,0 +1,41 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotPDF            = errors.New("content isn't a PDF document")
+	ErrCorrupted         = errors.New("PDF document is corrupted")
+	ErrEncrypted         = errors.New("PDF document is encrypted")
+	ErrUnsupportedFilter = errors.New("unsupported stream filter")
+)
+
+func corrupted(err error) error {
+	return fmt.Errorf("%w: %s", ErrCorrupted, err.Error())
+}
+
+// Validate checks that data is a readable PDF: the magic bytes are present,
+// the cross-reference structure points to the document catalog and the
+// document isn't encrypted.
+func Validate(data []byte) error {
+	doc, err := Open(data)
+	if err != nil {
+		return err
+	}
+
+	if doc.Encrypted() {
+		return ErrEncrypted
+	}
+
+	root, err := doc.ResolveDict(doc.Trailer["Root"])
+	if err != nil {
+		return corrupted(fmt.Errorf("reading catalog: %w", err))
+	}
+	if root == nil || root.Name("Type") != "Catalog" {
+		return corrupted(fmt.Errorf("document catalog not found"))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := os.ReadFile("./testsData/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+func Test_Validate(t *testing.T) {
+	t.Run("xref_table", func(t *testing.T) {
+		err := Validate(readFixture(t, "valid.pdf"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("xref_stream_and_object_streams", func(t *testing.T) {
+		data, err := os.ReadFile("../storage/testsData/file.pdf")
+		require.NoError(t, err)
+
+		assert.NoError(t, Validate(data))
+	})
+
+	t.Run("not_pdf", func(t *testing.T) {
+		err := Validate([]byte("MZ\x90\x00\x03\x00\x00\x00 renamed executable"))
+		assert.ErrorIs(t, err, ErrNotPDF)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		err := Validate(nil)
+		assert.ErrorIs(t, err, ErrNotPDF)
+	})
+
+	t.Run("broken_startxref", func(t *testing.T) {
+		err := Validate(readFixture(t, "corrupted.pdf"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data := readFixture(t, "valid.pdf")
+		err := Validate(data[:len(data)/2])
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("header_only", func(t *testing.T) {
+		err := Validate([]byte("%PDF-1.7\n%%EOF\n"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("nested_too_deep", func(t *testing.T) {
+		err := Validate(readFixture(t, "nested.pdf"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("object_stream_negative_count", func(t *testing.T) {
+		err := Validate(readFixture(t, "objstm_negative_n.pdf"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("object_stream_huge_count", func(t *testing.T) {
+		err := Validate(readFixture(t, "objstm_huge_n.pdf"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("xref_stream_negative_index", func(t *testing.T) {
+		err := Validate(readFixture(t, "xref_negative_index.pdf"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		err := Validate(readFixture(t, "encrypted.pdf"))
+		assert.ErrorIs(t, err, ErrEncrypted)
+	})
+}
@@ -1,18 +1,46 @@
 package server
 
 import (
+	"context"
+	"crud-books/docs"
+	"crud-books/logging"
+	"crud-books/metrics"
+	"crud-books/tracing"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// streamingRoutes transfer whole files and are bounded by the storage
+// timeouts instead of the request timeout.
+var streamingRoutes = map[string]bool{
+	"/files":              true,
+	"/books/:id/download": true,
+}
+
 type Server struct {
-	port          string
-	server        *echo.Echo
-	jwtSecret     string
-	jwtMiddleware echo.MiddlewareFunc
+	port           string
+	server         *echo.Echo
+	jwtSecret      string
+	auth           Authenticator
+	requestTimeout time.Duration
+	logger         *slog.Logger
+}
+
+// Authenticator provides the auth middlewares routes choose from.
+type Authenticator interface {
+	// RequireAuth rejects anonymous requests.
+	RequireAuth() echo.MiddlewareFunc
+	// OptionalAuth authenticates the request if it carries a token.
+	OptionalAuth() echo.MiddlewareFunc
+	// JWKSHandler publishes the keys tokens are verified with.
+	JWKSHandler(c echo.Context) error
 }
 
 type Handlers interface {
@@ -24,41 +52,150 @@ type Handlers interface {
 	GetBooks(c echo.Context) error
 	UpdateBook(c echo.Context) error
 	DeleteBook(c echo.Context) error
+	UpdateBookCover(c echo.Context) error
+	GetBookCover(c echo.Context) error
+	GetTrash(c echo.Context) error
+	RestoreBook(c echo.Context) error
+	GetBookVersions(c echo.Context) error
+	GetBookVersion(c echo.Context) error
+	RestoreBookVersion(c echo.Context) error
+	DownloadBook(c echo.Context) error
+	Healthz(c echo.Context) error
+	Readyz(c echo.Context) error
+}
+
+// APIPrefix is the mount point of the current API version.
+const APIPrefix = "/api/v1"
+
+// access is the authentication a route requires.
+type access int
+
+const (
+	authRequired access = iota
+	authOptional
+	public
+)
+
+type route struct {
+	method  string
+	path    string
+	handler echo.HandlerFunc
+	access  access
+}
+
+func apiRoutes(handlers Handlers) []route {
+	return []route{
+		{http.MethodPost, "/login", handlers.SignIn, public},
+		{http.MethodPost, "/register", handlers.SignUp, public},
+
+		{http.MethodPost, "/files", handlers.UploadFile, authRequired},
+
+		{http.MethodPost, "/books", handlers.CreateBook, authRequired},
+		{http.MethodGet, "/books", handlers.GetBooks, authOptional},
+		{http.MethodGet, "/books/:id", handlers.GetBook, authRequired},
+		{http.MethodPut, "/books/:id", handlers.UpdateBook, authRequired},
+		{http.MethodDelete, "/books/:id", handlers.DeleteBook, authRequired},
+		{http.MethodPut, "/books/:id/cover", handlers.UpdateBookCover, authRequired},
+		// covers are loaded by <img> tags, which send no bearer header
+		{http.MethodGet, "/books/:id/cover", handlers.GetBookCover, authOptional},
+		// browser PDF viewers open the link without a bearer header
+		{http.MethodGet, "/books/:id/download", handlers.DownloadBook, authOptional},
+		{http.MethodPost, "/books/:id/restore", handlers.RestoreBook, authRequired},
+		{http.MethodGet, "/books/:id/versions", handlers.GetBookVersions, authRequired},
+		{http.MethodGet, "/books/:id/versions/:n", handlers.GetBookVersion, authRequired},
+		{http.MethodPost, "/books/:id/versions/:n/restore", handlers.RestoreBookVersion, authRequired},
+
+		{http.MethodGet, "/me/trash", handlers.GetTrash, authRequired},
+	}
 }
 
 func (s Server) UseRouters(handlers Handlers) {
-	s.server.Add(http.MethodPost, "/login", handlers.SignIn)
-	s.server.Add(http.MethodPost, "/register", handlers.SignUp)
+	s.server.Add(http.MethodGet, "/healthz", handlers.Healthz)
+	s.server.Add(http.MethodGet, "/readyz", handlers.Readyz)
+	s.server.Add(http.MethodGet, "/metrics", echo.WrapHandler(metrics.Handler()))
+	s.server.Add(http.MethodGet, "/openapi.json", docs.SpecHandler)
+	s.server.Add(http.MethodGet, "/docs", docs.UIHandler)
+	s.server.Add(http.MethodGet, "/.well-known/jwks.json", s.auth.JWKSHandler)
 
-	s.server.Add(http.MethodPost, "/files", handlers.UploadFile)
+	for _, r := range apiRoutes(handlers) {
+		var middlewares []echo.MiddlewareFunc
+		switch r.access {
+		case authRequired:
+			middlewares = append(middlewares, s.auth.RequireAuth())
+		case authOptional:
+			middlewares = append(middlewares, s.auth.OptionalAuth())
+		}
 
-	books := s.server.Group("/books")
-	books.Add(http.MethodPost, "", handlers.CreateBook)
-	books.Add(http.MethodGet, "", handlers.GetBooks)
-	books.Add(http.MethodGet, "/:id", handlers.GetBook)
-	books.Add(http.MethodPut, "/:id", handlers.UpdateBook)
-	books.Add(http.MethodDelete, "/:id", handlers.DeleteBook)
+		s.server.Add(r.method, APIPrefix+r.path, r.handler, middlewares...)
+		// unversioned paths are kept for clients built before /api/v1
+		s.server.Add(r.method, r.path, r.handler, append([]echo.MiddlewareFunc{deprecated}, middlewares...)...)
+	}
+}
+
+// deprecated marks responses of an unversioned route and points to its
+// successor under APIPrefix.
+func deprecated(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set("Deprecation", "true")
+		header.Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", APIPrefix, c.Request().URL.Path))
+		return next(c)
+	}
 }
 
 func (s Server) InitMiddlewares() {
-	s.server.Use(s.jwtMiddleware)
+	s.server.Use(logging.Middleware(s.logger))
+	s.server.Use(tracing.Middleware)
+	s.server.Use(metrics.Middleware)
+	s.server.Use(s.timeoutMiddleware)
 	s.server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*", "*"},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
 	}))
 }
 
+// timeoutMiddleware puts a deadline on the request context, so database and
+// storage calls of an abandoned or slow request are cancelled.
+func (s Server) timeoutMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.requestTimeout <= 0 || streamingRoutes[strings.TrimPrefix(c.Path(), APIPrefix)] {
+			return next(c)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), s.requestTimeout)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// Start serves requests until Shutdown is called, in which case it returns
+// nil.
 func (s Server) Start() error {
-	return s.server.Start(fmt.Sprintf(":%s", s.port))
+	err := s.server.Start(fmt.Sprintf(":%s", s.port))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until
+// ctx is done.
+func (s Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
 }
 
-func New(port string, JwtSecret string, JwtMiddleware echo.MiddlewareFunc) Server {
+func New(port string, JwtSecret string, auth Authenticator, RequestTimeout time.Duration, logger *slog.Logger) Server {
 	server := Server{
-		port:          port,
-		server:        echo.New(),
-		jwtSecret:     JwtSecret,
-		jwtMiddleware: JwtMiddleware,
+		port:           port,
+		server:         echo.New(),
+		jwtSecret:      JwtSecret,
+		auth:           auth,
+		requestTimeout: RequestTimeout,
+		logger:         logger,
 	}
+	server.server.HideBanner = true
+	server.server.HidePort = true
 
 	return server
 }
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"crud-books/auth"
+	"crud-books/config"
+	"crud-books/docs"
+	"crud-books/handlers"
+	mock_handlers "crud-books/handlers/mocks"
+	"crud-books/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// stubAuth answers in place of the handler, telling which auth the route
+// uses.
+type stubAuth struct{}
+
+func (stubAuth) RequireAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return c.String(http.StatusUnauthorized, "required")
+		}
+	}
+}
+
+func (stubAuth) JWKSHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"keys": []string{}})
+}
+
+func (stubAuth) OptionalAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return c.String(http.StatusUnauthorized, "optional")
+		}
+	}
+}
+
+// specOperations returns "METHOD /path" for every operation in the OpenAPI
+// document.
+func specOperations(t *testing.T) map[string]bool {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(docs.Spec(), &spec))
+
+	ops := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			ops[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return ops
+}
+
+func Test_UseRouters_Documented(t *testing.T) {
+	s := New("0", "", stubAuth{}, time.Second, nil)
+	s.UseRouters(handlers.New(nil, nil))
+
+	documented := specOperations(t)
+	routed := map[string]bool{}
+	for _, r := range s.server.Routes() {
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		path := pathParam.ReplaceAllString(r.Path, "{$1}")
+		op := r.Method + " " + path
+		routed[op] = true
+		// deprecated aliases are documented by their versioned route
+		alias := r.Method + " " + APIPrefix + path
+		assert.True(t, documented[op] || documented[alias], "route %s is missing from docs/openapi.json", op)
+	}
+	for op := range documented {
+		assert.True(t, routed[op], "operation %s of docs/openapi.json isn't routed", op)
+	}
+}
+
+func Test_DocsRoutes(t *testing.T) {
+	s := New("0", "", stubAuth{}, time.Second, nil)
+	s.UseRouters(handlers.New(nil, nil))
+
+	for path, contentType := range map[string]string{
+		"/openapi.json": "application/json",
+		"/docs":         "text/html",
+	} {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		s.server.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Contains(t, rec.Header().Get("Content-Type"), contentType, path)
+	}
+}
+
+func Test_DeprecatedAliases(t *testing.T) {
+	s := New("0", "", stubAuth{}, time.Second, nil)
+	s.UseRouters(handlers.New(nil, nil))
+
+	versioned := map[string]bool{}
+	legacy := map[string]bool{}
+	for _, r := range s.server.Routes() {
+		if strings.HasPrefix(r.Path, APIPrefix+"/") {
+			versioned[r.Method+" "+strings.TrimPrefix(r.Path, APIPrefix)] = true
+		} else {
+			legacy[r.Method+" "+r.Path] = true
+		}
+	}
+	for op := range versioned {
+		assert.True(t, legacy[op], "route %s has no unversioned alias", op)
+	}
+}
+
+func Test_Deprecated(t *testing.T) {
+	e := echo.New()
+	e.GET("/books/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "")
+	}, deprecated)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books/42?limit=5", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/books/42>; rel="successor-version"`, rec.Header().Get("Link"))
+}
+
+func Test_RouteAccess(t *testing.T) {
+	s := New("0", "", stubAuth{}, time.Second, nil)
+	s.UseRouters(handlers.New(nil, nil))
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodPost, path: "/login", want: "public"},
+		{method: http.MethodPost, path: "/register", want: "public"},
+		{method: http.MethodGet, path: "/books", want: "optional"},
+		{method: http.MethodPost, path: "/books", want: "required"},
+		{method: http.MethodGet, path: "/books/1", want: "required"},
+		{method: http.MethodGet, path: "/books/1/download", want: "optional"},
+		{method: http.MethodGet, path: "/books/1/cover", want: "optional"},
+		{method: http.MethodPost, path: "/files", want: "required"},
+		{method: http.MethodGet, path: "/me/trash", want: "required"},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{APIPrefix + tt.path, tt.path} {
+			// public handlers reject the malformed body before reaching the
+			// services
+			req := httptest.NewRequest(tt.method, path, strings.NewReader("{"))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			s.server.ServeHTTP(rec, req)
+
+			got := "public"
+			if rec.Code == http.StatusUnauthorized {
+				got = rec.Body.String()
+			}
+			assert.Equal(t, tt.want, got, "%s %s", tt.method, path)
+		}
+	}
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// a browser PDF viewer follows the link without an Authorization header
+func Test_DownloadPublicBook_Anonymous(t *testing.T) {
+	jwtEngine, err := auth.NewJwtEngine(&config.Config{JwtSecret: "secret"})
+	require.NoError(t, err)
+	services := mock_handlers.NewMockService(gomock.NewController(t))
+	content := []byte("%PDF-1.4 book content")
+
+	s := New("0", "", jwtEngine, time.Second, nil)
+	s.UseRouters(handlers.New(services, nil))
+
+	services.EXPECT().OpenBookFile(gomock.Any(), "1", "").Return(&models.BookFile{
+		Name:     "Book.pdf",
+		MimeType: "application/pdf",
+		Size:     int64(len(content)),
+		Content:  nopSeekCloser{bytes.NewReader(content)},
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	s.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, APIPrefix+"/books/1/download", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, content, rec.Body.Bytes())
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"crud-books/tracing"
+	"fmt"
+	"time"
+)
+
+const (
+	fileDeletionsWorker = "fileDeletions"
+	orphanFilesWorker   = "orphanFilesGC"
+	trashPurgeWorker    = "trashPurge"
+
+	deletionBatchSize   = 50
+	deletionMaxAttempts = 10
+	deletionBaseBackoff = time.Minute
+	deletionMaxBackoff  = 6 * time.Hour
+)
+
+// RunFileDeletions drains the file deletion outbox every interval until ctx
+// is cancelled.
+func (s *Services) RunFileDeletions(ctx context.Context, interval time.Duration) {
+	s.health.workerStarted(fileDeletionsWorker)
+	defer s.health.workerStopped(fileDeletionsWorker)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.processFileDeletions(ctx, time.Now().UTC())
+		if err != nil {
+			s.logger.ErrorContext(ctx, "processing file deletions failed", "error", err)
+		}
+		s.health.workerRan(fileDeletionsWorker, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOrphanFilesGC periodically schedules deletion of uploaded files which
+// weren't attached to a book within maxAge.
+func (s *Services) RunOrphanFilesGC(ctx context.Context, interval, maxAge time.Duration) {
+	s.health.workerStarted(orphanFilesWorker)
+	defer s.health.workerStopped(orphanFilesWorker)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.db.EnqueueOrphanFiles(ctx, time.Now().UTC().Add(-maxAge))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "collecting orphan files failed", "error", err)
+		}
+		s.health.workerRan(orphanFilesWorker, err)
+		if count > 0 {
+			s.logger.InfoContext(ctx, "scheduled deletion of orphan files", "count", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunTrashPurge periodically deletes books which stayed in the trash longer
+// than retention. Their files go through the deletion outbox.
+func (s *Services) RunTrashPurge(ctx context.Context, interval, retention time.Duration) {
+	s.health.workerStarted(trashPurgeWorker)
+	defer s.health.workerStopped(trashPurgeWorker)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.db.PurgeTrash(ctx, time.Now().UTC().Add(-retention))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "purging trash failed", "error", err)
+		}
+		s.health.workerRan(trashPurgeWorker, err)
+		if count > 0 {
+			s.logger.InfoContext(ctx, "purged books from trash", "count", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Services) processFileDeletions(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "services.processFileDeletions")
+	defer span.End()
+
+	deletions, err := s.db.GetFileDeletions(ctx, now, deletionBatchSize)
+	if err != nil {
+		return fmt.Errorf("getting file deletions failed, error: %w", err)
+	}
+
+	for _, d := range deletions {
+		// the file may have been attached to a book after it was scheduled
+		referenced, err := s.db.IsFileReferenced(ctx, d.Token)
+		if err != nil {
+			return fmt.Errorf("checking file references failed, error: %w", err)
+		}
+		if referenced {
+			err = s.db.DropFileDeletion(ctx, d.Token)
+			if err != nil {
+				return fmt.Errorf("dropping file deletion failed, error: %w", err)
+			}
+			continue
+		}
+
+		storageToken, remaining, err := s.db.ReleaseFile(ctx, d.Token)
+		if err != nil {
+			return fmt.Errorf("releasing file failed, error: %w", err)
+		}
+
+		// the stored object stays while other files share its content
+		if remaining == 0 {
+			err = s.storage.DeleteFile(ctx, storageToken)
+			if err != nil {
+				attempts := d.Attempts + 1
+				if attempts >= deletionMaxAttempts {
+					s.logger.WarnContext(ctx, "giving up deleting file", "file_token", d.Token, "attempts", attempts, "error", err)
+					err = s.db.DropFileDeletion(ctx, d.Token)
+				} else {
+					err = s.db.PostponeFileDeletion(ctx, d.Token, attempts, err.Error(), now.Add(deletionBackoff(attempts)))
+				}
+				if err != nil {
+					return fmt.Errorf("rescheduling file deletion failed, error: %w", err)
+				}
+				continue
+			}
+
+			err = s.db.DeleteBlob(ctx, storageToken)
+			if err != nil {
+				return fmt.Errorf("deleting blob failed, error: %w", err)
+			}
+		}
+
+		err = s.db.CompleteFileDeletion(ctx, d.Token)
+		if err != nil {
+			return fmt.Errorf("completing file deletion failed, error: %w", err)
+		}
+	}
+	return nil
+}
+
+func deletionBackoff(attempts int) time.Duration {
+	backoff := deletionBaseBackoff
+	for i := 1; i < attempts && backoff < deletionMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > deletionMaxBackoff {
+		return deletionMaxBackoff
+	}
+	return backoff
+}
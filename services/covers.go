@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crud-books/models"
+	"crud-books/tracing"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const coverContentType = "image/png"
+
+var coverWidths = []int{160, 480}
+
+// renderCovers uploads first page thumbnails of a freshly uploaded file next
+// to it. A book without a cover is still usable, so failures are only logged.
+// The file token becomes the token of the book created from the file, so the
+// cover urls point to it.
+func (s *Services) renderCovers(ctx context.Context, servForUpload, folderId, fileToken string, file []byte, fileName string) []models.Cover {
+	if s.thumbnailer == nil {
+		return nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+
+	var covers []models.Cover
+	for _, width := range coverWidths {
+		img, err := s.thumbnailer.RenderFirstPage(ctx, file, width)
+		if err != nil {
+			s.logger.WarnContext(ctx, "rendering cover failed", "width", width, "file_name", fileName, "error", err)
+			continue
+		}
+
+		stored, err := s.storage.UploadFile(ctx, servForUpload, folderId, img, fmt.Sprintf("%s-cover-%d.png", base, width), coverContentType)
+		if err != nil {
+			s.logger.WarnContext(ctx, "uploading cover failed", "width", width, "file_name", fileName, "error", err)
+			continue
+		}
+
+		covers = append(covers, models.Cover{
+			Width: width,
+			Token: stored.Token,
+			Url:   models.CoverUrl(fileToken, width),
+		})
+	}
+	return covers
+}
+
+// UpdateBookCover replaces the cover of a book, which only its owner may do.
+func (s *Services) UpdateBookCover(ctx context.Context, bookToken string, img []byte, fileName, userEmail string) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.UpdateBookCover")
+	defer span.End()
+
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return "", fmt.Errorf("decoding cover image failed, error: %w", err)
+	}
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return "", fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !isOwner(book, userEmail) {
+		return "", models.ErrAccessDenied
+	}
+
+	// the cover goes to the folder of the book file
+	fileData, err := s.db.GetFileData(ctx, bookToken)
+	if err != nil {
+		return "", fmt.Errorf("getting book file failed, error: %w", err)
+	}
+
+	servForUpload, err := s.storage.GetServerToUpload(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting cell server for upload cover failed, error: %w", err)
+	}
+
+	stored, err := s.storage.UploadFile(ctx, servForUpload, fileData.FolderId, img, fileName, http.DetectContentType(img))
+	if err != nil {
+		return "", fmt.Errorf("upload cover to service failed, error: %w", err)
+	}
+
+	cover := models.Cover{
+		Width: imgConfig.Width,
+		Token: stored.Token,
+		Url:   models.CoverUrl(bookToken, imgConfig.Width),
+	}
+	err = s.db.UpdateBookCover(ctx, bookToken, cover)
+	if err != nil {
+		return "", fmt.Errorf("updating book cover failed, error: %w", err)
+	}
+
+	return cover.Url, nil
+}
+
+// OpenBookCover opens the stored cover of a book closest to the requested
+// width, or the largest one when width is 0. Covers of private books are
+// only available to their owner.
+func (s *Services) OpenBookCover(ctx context.Context, bookToken string, width int, userEmail string) (*models.BookFile, error) {
+	ctx, span := tracing.Start(ctx, "services.OpenBookCover")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !canAccess(book, userEmail) {
+		return nil, models.ErrAccessDenied
+	}
+
+	cover, ok := pickCover(book.Covers, width)
+	if !ok {
+		return nil, models.ErrNoCover
+	}
+
+	content, err := s.storage.OpenFile(ctx, cover.Token, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening stored cover failed, error: %w", err)
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		content.Close()
+		return nil, fmt.Errorf("getting cover size failed, error: %w", err)
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		content.Close()
+		return nil, fmt.Errorf("rewinding cover failed, error: %w", err)
+	}
+
+	// rendered covers are PNG, custom ones PNG or JPEG, the type is sniffed
+	// when serving
+	return &models.BookFile{
+		Name:    fmt.Sprintf("cover-%d", cover.Width),
+		Size:    size,
+		ETag:    cover.Token,
+		Content: content,
+	}, nil
+}
+
+// pickCover finds the smallest cover at least width wide, falling back to the
+// largest one.
+func pickCover(covers []models.Cover, width int) (models.Cover, bool) {
+	var best models.Cover
+	found := false
+	for _, c := range covers {
+		switch {
+		case !found:
+			best, found = c, true
+		case best.Width < width || width <= 0:
+			if c.Width > best.Width {
+				best = c
+			}
+		case c.Width >= width && c.Width < best.Width:
+			best = c
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"crud-books/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// storeContent uploads the file unless the same content is already stored, in
+// which case the new file record shares the existing object.
+func (s *Services) storeContent(ctx context.Context, servForUpload, folderId string, file []byte, fileName, mimeType string) (*models.FileData, error) {
+	sum := sha256.Sum256(file)
+	hash := hex.EncodeToString(sum[:])
+
+	blob, err := s.db.AcquireBlob(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("looking up stored content failed, error: %w", err)
+	}
+	if blob != nil {
+		token, err := newFileToken()
+		if err != nil {
+			s.releaseContent(ctx, hash, blob.StorageToken)
+			return nil, fmt.Errorf("generating file token failed, error: %w", err)
+		}
+		return &models.FileData{
+			Token:        token,
+			StorageToken: blob.StorageToken,
+			DownloadPage: blob.DownloadPage,
+			MimeType:     mimeType,
+			Sha256:       hash,
+			FolderId:     blob.FolderId,
+		}, nil
+	}
+
+	fileData, err := s.storage.UploadFile(ctx, servForUpload, folderId, file, fileName, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("upload file to service failed, error: \n%w", err)
+	}
+	fileData.StorageToken = fileData.Token
+	fileData.Sha256 = hash
+
+	err = s.db.CreateBlob(ctx, models.Blob{
+		Sha256:       hash,
+		StorageToken: fileData.StorageToken,
+		DownloadPage: fileData.DownloadPage,
+		FolderId:     fileData.FolderId,
+		RefCount:     1,
+	})
+	if err != nil {
+		// another upload of the same content registered first, this copy
+		// stays unshared and is deleted with its only file
+		s.logger.WarnContext(ctx, "registering blob failed", "file_token", fileData.Token, "error", err)
+	}
+
+	return fileData, nil
+}
+
+// releaseUpload undoes storeContent and renderCovers for an upload whose file
+// record couldn't be saved.
+func (s *Services) releaseUpload(ctx context.Context, fileData *models.FileData) {
+	// the upload may have failed because the request was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	s.releaseContent(ctx, fileData.Sha256, fileData.StorageToken)
+
+	if len(fileData.Covers) == 0 {
+		return
+	}
+	tokens := make([]string, 0, len(fileData.Covers))
+	for _, c := range fileData.Covers {
+		tokens = append(tokens, c.Token)
+	}
+	err := s.db.EnqueueFileDeletions(ctx, tokens...)
+	if err != nil {
+		s.logger.WarnContext(ctx, "scheduling deletion of covers failed", "file_token", fileData.Token, "error", err)
+	}
+}
+
+// releaseContent drops the reference storeContent took on the stored object
+// and schedules its deletion once no file shares it.
+func (s *Services) releaseContent(ctx context.Context, hash, storageToken string) {
+	remaining, err := s.db.ReleaseBlob(ctx, hash, storageToken)
+	if err != nil {
+		s.logger.WarnContext(ctx, "releasing stored content failed", "storage_token", storageToken, "error", err)
+		return
+	}
+	if remaining > 0 {
+		return
+	}
+
+	err = s.db.EnqueueFileDeletions(ctx, storageToken)
+	if err != nil {
+		s.logger.WarnContext(ctx, "scheduling deletion of stored content failed", "storage_token", storageToken, "error", err)
+	}
+}
+
+// newFileToken returns a random UUID, the same shape as storage file ids.
+func newFileToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"crud-books/formats"
+	"crud-books/models"
+	"crud-books/tracing"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OpenBookFile opens the stored file of a book for streaming. Private books
+// are only available to their owner.
+func (s *Services) OpenBookFile(ctx context.Context, bookToken, userEmail string) (*models.BookFile, error) {
+	ctx, span := tracing.Start(ctx, "services.OpenBookFile")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !canAccess(book, userEmail) {
+		return nil, models.ErrAccessDenied
+	}
+
+	fileData, err := s.db.GetFileData(ctx, book.FileToken)
+	if err != nil {
+		return nil, fmt.Errorf("getting file data failed, error: %w", err)
+	}
+
+	content, err := s.storage.OpenFile(ctx, storageTokenOf(*fileData), fileData.Metadata.Size)
+	if err != nil {
+		return nil, fmt.Errorf("opening stored file failed, error: %w", err)
+	}
+
+	mimeType := fileData.MimeType
+	if mimeType == "" {
+		// files uploaded before formats were introduced are always PDFs
+		mimeType = formats.MimePDF
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		content.Close()
+		return nil, fmt.Errorf("getting file size failed, error: %w", err)
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		content.Close()
+		return nil, fmt.Errorf("rewinding file failed, error: %w", err)
+	}
+
+	return &models.BookFile{
+		Name:     downloadName(book.Title, mimeType),
+		MimeType: mimeType,
+		Size:     size,
+		ETag:     fileData.Sha256,
+		Content:  content,
+	}, nil
+}
+
+func canAccess(book *models.BookData, userEmail string) bool {
+	return !book.Private || isOwner(book, userEmail)
+}
+
+func isOwner(book *models.BookData, userEmail string) bool {
+	return userEmail != "" && book.OwnerEmail == userEmail
+}
+
+// downloadName builds a file name from the book title with an extension
+// matching the stored format.
+func downloadName(title, mimeType string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "book"
+	}
+
+	if format, ok := formats.Lookup(mimeType); ok && len(format.Extensions) > 0 {
+		return name + "." + format.Extensions[0]
+	}
+	return name
+}
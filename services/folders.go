@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"fmt"
+)
+
+const userFolderPrefix = "user-"
+
+// UseUserFolders makes uploads go to a storage subfolder per user instead of
+// the configured folder itself.
+func (s *Services) UseUserFolders(enabled bool) {
+	s.userFolders = enabled
+}
+
+// uploadFolder returns the storage folder for files uploaded by userEmail.
+// An empty folder means the storage default. The user folder is created on
+// the first upload.
+func (s *Services) uploadFolder(ctx context.Context, userEmail string) (string, error) {
+	if !s.userFolders || userEmail == "" {
+		return "", nil
+	}
+
+	userData, err := s.db.GetUserData(ctx, userEmail)
+	if err != nil {
+		return "", fmt.Errorf("getting user of upload failed, error: %w", err)
+	}
+	if userData.FolderId != "" {
+		return userData.FolderId, nil
+	}
+
+	folderId, err := s.storage.CreateFolder(ctx, "", userFolderPrefix+userData.Id)
+	if err != nil {
+		return "", fmt.Errorf("creating user folder failed, error: %w", err)
+	}
+	folderId, err = s.db.SetUserFolder(ctx, userEmail, folderId)
+	if err != nil {
+		return "", fmt.Errorf("recording user folder failed, error: %w", err)
+	}
+	return folderId, nil
+}
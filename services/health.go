@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"crud-books/models"
+	"sync"
+	"time"
+)
+
+const (
+	healthStatusOk   = "ok"
+	healthStatusFail = "fail"
+
+	storageCheckTTL     = 30 * time.Second
+	storageCheckTimeout = 5 * time.Second
+	dbCheckTimeout      = 3 * time.Second
+)
+
+// health keeps what readiness checks need between requests: the state of
+// background workers and the last storage check, which costs a gofile call.
+type health struct {
+	mu      sync.Mutex
+	workers map[string]*models.WorkerStatus
+	storage *models.HealthCheck
+	now     func() time.Time
+}
+
+func newHealth() *health {
+	return &health{workers: map[string]*models.WorkerStatus{}, now: time.Now}
+}
+
+func (h *health) workerStarted(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workers[name] = &models.WorkerStatus{Running: true}
+}
+
+func (h *health) workerStopped(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.workers[name]; ok {
+		w.Running = false
+	}
+}
+
+func (h *health) workerRan(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.workers[name]
+	if !ok {
+		return
+	}
+	now := h.now().UTC()
+	w.LastRunAt = &now
+	w.LastError = ""
+	if err != nil {
+		w.LastError = err.Error()
+	}
+}
+
+// Readiness checks the database, the storage and the background workers. The
+// storage result is reused for storageCheckTTL.
+func (s *Services) Readiness(ctx context.Context) *models.Readiness {
+	r := &models.Readiness{
+		Status:  healthStatusOk,
+		Checks:  map[string]models.HealthCheck{},
+		Workers: map[string]models.WorkerStatus{},
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, dbCheckTimeout)
+	defer cancel()
+	r.Checks["mongodb"] = s.health.check(s.db.Ping(dbCtx))
+	r.Checks["storage"] = s.checkStorage(ctx)
+
+	for _, check := range r.Checks {
+		if check.Status != healthStatusOk {
+			r.Status = healthStatusFail
+		}
+	}
+
+	s.health.mu.Lock()
+	for name, w := range s.health.workers {
+		r.Workers[name] = *w
+		if !w.Running {
+			r.Status = healthStatusFail
+		}
+	}
+	s.health.mu.Unlock()
+
+	return r
+}
+
+func (s *Services) checkStorage(ctx context.Context) models.HealthCheck {
+	s.health.mu.Lock()
+	cached := s.health.storage
+	s.health.mu.Unlock()
+	if cached != nil && s.health.now().Sub(*cached.CheckedAt) < storageCheckTTL {
+		return *cached
+	}
+
+	storageCtx, cancel := context.WithTimeout(ctx, storageCheckTimeout)
+	defer cancel()
+	check := s.health.check(s.storage.Ping(storageCtx))
+
+	s.health.mu.Lock()
+	s.health.storage = &check
+	s.health.mu.Unlock()
+	return check
+}
+
+func (h *health) check(err error) models.HealthCheck {
+	now := h.now().UTC()
+	if err != nil {
+		return models.HealthCheck{Status: healthStatusFail, Error: err.Error(), CheckedAt: &now}
+	}
+	return models.HealthCheck{Status: healthStatusOk, CheckedAt: &now}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crud-books/formats"
+	"crud-books/models"
+	"crud-books/tracing"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	contentIndexerWorker = "contentIndexer"
+
+	indexBatchSize   = 20
+	indexMaxAttempts = 5
+	indexBaseBackoff = time.Minute
+	snippetRadius    = 80
+)
+
+// wakeIndexer tells the content indexer that a file is waiting. The pending
+// work itself is the indexed flag of the file, so a missed wake up only
+// delays indexing until the next poll.
+func (s *Services) wakeIndexer() {
+	select {
+	case s.indexWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunContentIndexer extracts the text of files that aren't indexed yet and
+// stores it page by page until ctx is cancelled. It runs after every upload
+// and every interval, which also picks up files left over by a restart and
+// retries failed ones.
+func (s *Services) RunContentIndexer(ctx context.Context, interval time.Duration) {
+	s.health.workerStarted(contentIndexerWorker)
+	defer s.health.workerStopped(contentIndexerWorker)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.processIndexing(ctx, time.Now().UTC())
+		if err != nil {
+			s.logger.ErrorContext(ctx, "indexing content failed", "error", err)
+		}
+		s.health.workerRan(contentIndexerWorker, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.indexWake:
+		}
+	}
+}
+
+func (s *Services) processIndexing(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "services.processIndexing")
+	defer span.End()
+
+	for {
+		files, err := s.db.GetUnindexedFiles(ctx, now, indexBatchSize)
+		if err != nil {
+			return fmt.Errorf("getting unindexed files failed, error: %w", err)
+		}
+
+		for _, f := range files {
+			err = s.indexFile(ctx, f)
+			if ctx.Err() != nil {
+				// shutting down, the file stays pending for the next run
+				return nil
+			}
+			if err == nil {
+				err = s.db.MarkFileIndexed(ctx, f.Token, "")
+			} else if errors.Is(err, errExtraction) {
+				// the same content fails the same way, retrying is pointless
+				s.logger.WarnContext(ctx, "file content can't be indexed", "file_token", f.Token, "error", err)
+				err = s.db.MarkFileIndexed(ctx, f.Token, err.Error())
+			} else {
+				err = s.postponeIndexing(ctx, f, err, now)
+			}
+			if err != nil {
+				return fmt.Errorf("recording indexing of %s failed, error: %w", f.Token, err)
+			}
+		}
+
+		if len(files) < indexBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Services) postponeIndexing(ctx context.Context, f models.FileData, cause error, now time.Time) error {
+	attempts := f.IndexAttempts + 1
+	if attempts >= indexMaxAttempts {
+		s.logger.WarnContext(ctx, "giving up indexing file", "file_token", f.Token, "attempts", attempts, "error", cause)
+		return s.db.MarkFileIndexed(ctx, f.Token, cause.Error())
+	}
+
+	s.logger.WarnContext(ctx, "indexing file failed, will retry", "file_token", f.Token, "attempts", attempts, "error", cause)
+	backoff := indexBaseBackoff << (attempts - 1)
+	return s.db.PostponeIndexing(ctx, f.Token, attempts, cause.Error(), now.Add(backoff))
+}
+
+var errExtraction = errors.New("text extraction failed")
+
+// indexFile reads a file back from the storage and saves its text.
+func (s *Services) indexFile(ctx context.Context, f models.FileData) error {
+	ctx, span := tracing.Start(ctx, "services.indexFile")
+	defer span.End()
+
+	mimeType := f.MimeType
+	if mimeType == "" {
+		// files uploaded before formats were introduced are always PDFs
+		mimeType = formats.MimePDF
+	}
+	format, ok := formats.Lookup(mimeType)
+	if !ok || format.ExtractText == nil {
+		return nil
+	}
+
+	content, err := s.storage.OpenFile(ctx, storageTokenOf(f), f.Metadata.Size)
+	if err != nil {
+		return fmt.Errorf("opening stored file failed, error: %w", err)
+	}
+	defer content.Close()
+
+	file, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("reading stored file failed, error: %w", err)
+	}
+
+	return s.indexContent(ctx, f.Token, format, file)
+}
+
+func (s *Services) indexContent(ctx context.Context, fileToken string, format *formats.Format, file []byte) error {
+	texts, err := extractText(format, file)
+	if err != nil {
+		return err
+	}
+
+	pages := make([]models.PageText, 0, len(texts))
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		pages = append(pages, models.PageText{
+			FileToken: fileToken,
+			Page:      i + 1,
+			Text:      text,
+		})
+	}
+
+	err = s.db.SavePages(ctx, fileToken, pages)
+	if err != nil {
+		return fmt.Errorf("saving pages failed, error: %w", err)
+	}
+	return nil
+}
+
+// extractText runs the format parser on uploaded content. A parser panic is
+// returned as an ordinary error, so it counts against the attempts of the
+// file instead of taking the server down on every restart.
+func extractText(format *formats.Format, file []byte) (texts []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("text extraction panicked: %v", r)
+		}
+	}()
+
+	texts, err = format.ExtractText(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w, error: %s", errExtraction, err.Error())
+	}
+	return texts, nil
+}
+
+func (s *Services) SearchBooksContent(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.ContentHit, error) {
+	ctx, span := tracing.Start(ctx, "services.SearchBooksContent")
+	defer span.End()
+
+	pages, err := s.db.SearchPages(ctx, filter, sorting)
+	if err != nil {
+		return nil, fmt.Errorf("search in books content failed, error: %w", err)
+	}
+
+	hits := make([]models.ContentHit, 0, len(pages))
+	for _, p := range pages {
+		hits = append(hits, models.ContentHit{
+			BookId:  p.FileToken,
+			Page:    p.Page,
+			Snippet: snippet(p.Text, filter.Search),
+		})
+	}
+	return &hits, nil
+}
+
+// snippet cuts the part of the page text around the first search term found.
+func snippet(text, search string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+
+	at := -1
+	for _, term := range strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"'
+	}) {
+		if idx := indexRunes(lower, []rune(term)); idx >= 0 && (at < 0 || idx < at) {
+			at = idx
+		}
+	}
+	if at < 0 {
+		at = 0
+	}
+
+	start, end := at-snippetRadius, at+snippetRadius
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(runes) {
+		end, suffix = len(runes), ""
+	}
+
+	return prefix + strings.Join(strings.Fields(string(runes[start:end])), " ") + suffix
+}
+
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -5,8 +5,11 @@
 package mock_services
 
 import (
+	context "context"
 	models "crud-books/models"
+	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -87,166 +90,608 @@ func (m *MockDB) EXPECT() *MockDBMockRecorder {
 	return m.recorder
 }
 
+// AcquireBlob mocks base method.
+func (m *MockDB) AcquireBlob(ctx context.Context, sha256 string) (*models.Blob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireBlob", ctx, sha256)
+	ret0, _ := ret[0].(*models.Blob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireBlob indicates an expected call of AcquireBlob.
+func (mr *MockDBMockRecorder) AcquireBlob(ctx, sha256 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireBlob", reflect.TypeOf((*MockDB)(nil).AcquireBlob), ctx, sha256)
+}
+
+// CompleteFileDeletion mocks base method.
+func (m *MockDB) CompleteFileDeletion(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteFileDeletion", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteFileDeletion indicates an expected call of CompleteFileDeletion.
+func (mr *MockDBMockRecorder) CompleteFileDeletion(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteFileDeletion", reflect.TypeOf((*MockDB)(nil).CompleteFileDeletion), ctx, token)
+}
+
+// CreateBlob mocks base method.
+func (m *MockDB) CreateBlob(ctx context.Context, blob models.Blob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBlob", ctx, blob)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateBlob indicates an expected call of CreateBlob.
+func (mr *MockDBMockRecorder) CreateBlob(ctx, blob interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBlob", reflect.TypeOf((*MockDB)(nil).CreateBlob), ctx, blob)
+}
+
 // CreateBook mocks base method.
-func (m *MockDB) CreateBook(title, description, fileToken, emailOwner string) (string, error) {
+func (m *MockDB) CreateBook(ctx context.Context, title, description, fileToken, emailOwner string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBook", title, description, fileToken, emailOwner)
+	ret := m.ctrl.Call(m, "CreateBook", ctx, title, description, fileToken, emailOwner)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateBook indicates an expected call of CreateBook.
-func (mr *MockDBMockRecorder) CreateBook(title, description, fileToken, emailOwner interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) CreateBook(ctx, title, description, fileToken, emailOwner interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBook", reflect.TypeOf((*MockDB)(nil).CreateBook), title, description, fileToken, emailOwner)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBook", reflect.TypeOf((*MockDB)(nil).CreateBook), ctx, title, description, fileToken, emailOwner)
 }
 
 // CreateUser mocks base method.
-func (m *MockDB) CreateUser(email, passwordHash string) (string, error) {
+func (m *MockDB) CreateUser(ctx context.Context, email, passwordHash string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", email, passwordHash)
+	ret := m.ctrl.Call(m, "CreateUser", ctx, email, passwordHash)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockDBMockRecorder) CreateUser(email, passwordHash interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) CreateUser(ctx, email, passwordHash interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockDB)(nil).CreateUser), email, passwordHash)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockDB)(nil).CreateUser), ctx, email, passwordHash)
+}
+
+// DeleteBlob mocks base method.
+func (m *MockDB) DeleteBlob(ctx context.Context, storageToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBlob", ctx, storageToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteBlob indicates an expected call of DeleteBlob.
+func (mr *MockDBMockRecorder) DeleteBlob(ctx, storageToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBlob", reflect.TypeOf((*MockDB)(nil).DeleteBlob), ctx, storageToken)
 }
 
 // DeleteBook mocks base method.
-func (m *MockDB) DeleteBook(tokenBook string) error {
+func (m *MockDB) DeleteBook(ctx context.Context, tokenBook, ownerEmail string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteBook", tokenBook)
+	ret := m.ctrl.Call(m, "DeleteBook", ctx, tokenBook, ownerEmail)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteBook indicates an expected call of DeleteBook.
-func (mr *MockDBMockRecorder) DeleteBook(tokenBook interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) DeleteBook(ctx, tokenBook, ownerEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBook", reflect.TypeOf((*MockDB)(nil).DeleteBook), ctx, tokenBook, ownerEmail)
+}
+
+// DropFileDeletion mocks base method.
+func (m *MockDB) DropFileDeletion(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DropFileDeletion", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DropFileDeletion indicates an expected call of DropFileDeletion.
+func (mr *MockDBMockRecorder) DropFileDeletion(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropFileDeletion", reflect.TypeOf((*MockDB)(nil).DropFileDeletion), ctx, token)
+}
+
+// EnqueueFileDeletions mocks base method.
+func (m *MockDB) EnqueueFileDeletions(ctx context.Context, tokens ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range tokens {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "EnqueueFileDeletions", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueFileDeletions indicates an expected call of EnqueueFileDeletions.
+func (mr *MockDBMockRecorder) EnqueueFileDeletions(ctx interface{}, tokens ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, tokens...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueFileDeletions", reflect.TypeOf((*MockDB)(nil).EnqueueFileDeletions), varargs...)
+}
+
+// EnqueueOrphanFiles mocks base method.
+func (m *MockDB) EnqueueOrphanFiles(ctx context.Context, createdBefore time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueOrphanFiles", ctx, createdBefore)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnqueueOrphanFiles indicates an expected call of EnqueueOrphanFiles.
+func (mr *MockDBMockRecorder) EnqueueOrphanFiles(ctx, createdBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueOrphanFiles", reflect.TypeOf((*MockDB)(nil).EnqueueOrphanFiles), ctx, createdBefore)
+}
+
+// ForgetBlob mocks base method.
+func (m *MockDB) ForgetBlob(ctx context.Context, storageToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgetBlob", ctx, storageToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForgetBlob indicates an expected call of ForgetBlob.
+func (mr *MockDBMockRecorder) ForgetBlob(ctx, storageToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgetBlob", reflect.TypeOf((*MockDB)(nil).ForgetBlob), ctx, storageToken)
+}
+
+// GetAllBooks mocks base method.
+func (m *MockDB) GetAllBooks(ctx context.Context) ([]models.BookData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllBooks", ctx)
+	ret0, _ := ret[0].([]models.BookData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllBooks indicates an expected call of GetAllBooks.
+func (mr *MockDBMockRecorder) GetAllBooks(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllBooks", reflect.TypeOf((*MockDB)(nil).GetAllBooks), ctx)
+}
+
+// GetAllFileData mocks base method.
+func (m *MockDB) GetAllFileData(ctx context.Context) ([]models.FileData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllFileData", ctx)
+	ret0, _ := ret[0].([]models.FileData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllFileData indicates an expected call of GetAllFileData.
+func (mr *MockDBMockRecorder) GetAllFileData(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBook", reflect.TypeOf((*MockDB)(nil).DeleteBook), tokenBook)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllFileData", reflect.TypeOf((*MockDB)(nil).GetAllFileData), ctx)
 }
 
 // GetBook mocks base method.
-func (m *MockDB) GetBook(bookToken string) (*models.BookData, error) {
+func (m *MockDB) GetBook(ctx context.Context, bookToken string) (*models.BookData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBook", bookToken)
+	ret := m.ctrl.Call(m, "GetBook", ctx, bookToken)
 	ret0, _ := ret[0].(*models.BookData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBook indicates an expected call of GetBook.
-func (mr *MockDBMockRecorder) GetBook(bookToken interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetBook(ctx, bookToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBook", reflect.TypeOf((*MockDB)(nil).GetBook), ctx, bookToken)
+}
+
+// GetBookVersion mocks base method.
+func (m *MockDB) GetBookVersion(ctx context.Context, bookToken string, version int) (*models.BookVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookVersion", ctx, bookToken, version)
+	ret0, _ := ret[0].(*models.BookVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookVersion indicates an expected call of GetBookVersion.
+func (mr *MockDBMockRecorder) GetBookVersion(ctx, bookToken, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookVersion", reflect.TypeOf((*MockDB)(nil).GetBookVersion), ctx, bookToken, version)
+}
+
+// GetBookVersions mocks base method.
+func (m *MockDB) GetBookVersions(ctx context.Context, bookToken string) ([]models.BookVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookVersions", ctx, bookToken)
+	ret0, _ := ret[0].([]models.BookVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookVersions indicates an expected call of GetBookVersions.
+func (mr *MockDBMockRecorder) GetBookVersions(ctx, bookToken interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBook", reflect.TypeOf((*MockDB)(nil).GetBook), bookToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookVersions", reflect.TypeOf((*MockDB)(nil).GetBookVersions), ctx, bookToken)
 }
 
 // GetFileData mocks base method.
-func (m *MockDB) GetFileData(fileToken string) (*models.FileData, error) {
+func (m *MockDB) GetFileData(ctx context.Context, fileToken string) (*models.FileData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFileData", fileToken)
+	ret := m.ctrl.Call(m, "GetFileData", ctx, fileToken)
 	ret0, _ := ret[0].(*models.FileData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFileData indicates an expected call of GetFileData.
-func (mr *MockDBMockRecorder) GetFileData(fileToken interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetFileData(ctx, fileToken interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileData", reflect.TypeOf((*MockDB)(nil).GetFileData), fileToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileData", reflect.TypeOf((*MockDB)(nil).GetFileData), ctx, fileToken)
+}
+
+// GetFileDeletions mocks base method.
+func (m *MockDB) GetFileDeletions(ctx context.Context, before time.Time, limit int) ([]models.FileDeletion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileDeletions", ctx, before, limit)
+	ret0, _ := ret[0].([]models.FileDeletion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileDeletions indicates an expected call of GetFileDeletions.
+func (mr *MockDBMockRecorder) GetFileDeletions(ctx, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileDeletions", reflect.TypeOf((*MockDB)(nil).GetFileDeletions), ctx, before, limit)
 }
 
 // GetListBooks mocks base method.
-func (m *MockDB) GetListBooks(filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+func (m *MockDB) GetListBooks(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetListBooks", filter, sort)
+	ret := m.ctrl.Call(m, "GetListBooks", ctx, filter, sort)
 	ret0, _ := ret[0].([]models.BookData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetListBooks indicates an expected call of GetListBooks.
-func (mr *MockDBMockRecorder) GetListBooks(filter, sort interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetListBooks(ctx, filter, sort interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListBooks", reflect.TypeOf((*MockDB)(nil).GetListBooks), filter, sort)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListBooks", reflect.TypeOf((*MockDB)(nil).GetListBooks), ctx, filter, sort)
 }
 
 // GetListBooksUser mocks base method.
-func (m *MockDB) GetListBooksUser(filter models.Filter, sort models.Sort) ([]models.BookData, error) {
+func (m *MockDB) GetListBooksUser(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetListBooksUser", filter, sort)
+	ret := m.ctrl.Call(m, "GetListBooksUser", ctx, filter, sort)
 	ret0, _ := ret[0].([]models.BookData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetListBooksUser indicates an expected call of GetListBooksUser.
-func (mr *MockDBMockRecorder) GetListBooksUser(filter, sort interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetListBooksUser(ctx, filter, sort interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListBooksUser", reflect.TypeOf((*MockDB)(nil).GetListBooksUser), ctx, filter, sort)
+}
+
+// GetTrash mocks base method.
+func (m *MockDB) GetTrash(ctx context.Context, ownerEmail string) ([]models.BookData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", ctx, ownerEmail)
+	ret0, _ := ret[0].([]models.BookData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockDBMockRecorder) GetTrash(ctx, ownerEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockDB)(nil).GetTrash), ctx, ownerEmail)
+}
+
+// GetUnindexedFiles mocks base method.
+func (m *MockDB) GetUnindexedFiles(ctx context.Context, now time.Time, limit int) ([]models.FileData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnindexedFiles", ctx, now, limit)
+	ret0, _ := ret[0].([]models.FileData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnindexedFiles indicates an expected call of GetUnindexedFiles.
+func (mr *MockDBMockRecorder) GetUnindexedFiles(ctx, now, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListBooksUser", reflect.TypeOf((*MockDB)(nil).GetListBooksUser), filter, sort)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnindexedFiles", reflect.TypeOf((*MockDB)(nil).GetUnindexedFiles), ctx, now, limit)
 }
 
 // GetUserData mocks base method.
-func (m *MockDB) GetUserData(email string) (*models.UserData, error) {
+func (m *MockDB) GetUserData(ctx context.Context, email string) (*models.UserData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserData", email)
+	ret := m.ctrl.Call(m, "GetUserData", ctx, email)
 	ret0, _ := ret[0].(*models.UserData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserData indicates an expected call of GetUserData.
-func (mr *MockDBMockRecorder) GetUserData(email interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetUserData(ctx, email interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserData", reflect.TypeOf((*MockDB)(nil).GetUserData), email)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserData", reflect.TypeOf((*MockDB)(nil).GetUserData), ctx, email)
 }
 
 // GetUserDataById mocks base method.
-func (m *MockDB) GetUserDataById(userId string) (*models.UserData, error) {
+func (m *MockDB) GetUserDataById(ctx context.Context, userId string) (*models.UserData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserDataById", userId)
+	ret := m.ctrl.Call(m, "GetUserDataById", ctx, userId)
 	ret0, _ := ret[0].(*models.UserData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserDataById indicates an expected call of GetUserDataById.
-func (mr *MockDBMockRecorder) GetUserDataById(userId interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) GetUserDataById(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserDataById", reflect.TypeOf((*MockDB)(nil).GetUserDataById), ctx, userId)
+}
+
+// IsFileReferenced mocks base method.
+func (m *MockDB) IsFileReferenced(ctx context.Context, token string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsFileReferenced", ctx, token)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsFileReferenced indicates an expected call of IsFileReferenced.
+func (mr *MockDBMockRecorder) IsFileReferenced(ctx, token interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserDataById", reflect.TypeOf((*MockDB)(nil).GetUserDataById), userId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsFileReferenced", reflect.TypeOf((*MockDB)(nil).IsFileReferenced), ctx, token)
+}
+
+// MarkFileIndexed mocks base method.
+func (m *MockDB) MarkFileIndexed(ctx context.Context, token, indexError string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkFileIndexed", ctx, token, indexError)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkFileIndexed indicates an expected call of MarkFileIndexed.
+func (mr *MockDBMockRecorder) MarkFileIndexed(ctx, token, indexError interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkFileIndexed", reflect.TypeOf((*MockDB)(nil).MarkFileIndexed), ctx, token, indexError)
+}
+
+// Ping mocks base method.
+func (m *MockDB) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockDBMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockDB)(nil).Ping), ctx)
+}
+
+// PostponeFileDeletion mocks base method.
+func (m *MockDB) PostponeFileDeletion(ctx context.Context, token string, attempts int, lastError string, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostponeFileDeletion", ctx, token, attempts, lastError, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PostponeFileDeletion indicates an expected call of PostponeFileDeletion.
+func (mr *MockDBMockRecorder) PostponeFileDeletion(ctx, token, attempts, lastError, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostponeFileDeletion", reflect.TypeOf((*MockDB)(nil).PostponeFileDeletion), ctx, token, attempts, lastError, next)
+}
+
+// PostponeIndexing mocks base method.
+func (m *MockDB) PostponeIndexing(ctx context.Context, token string, attempts int, lastError string, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostponeIndexing", ctx, token, attempts, lastError, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PostponeIndexing indicates an expected call of PostponeIndexing.
+func (mr *MockDBMockRecorder) PostponeIndexing(ctx, token, attempts, lastError, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostponeIndexing", reflect.TypeOf((*MockDB)(nil).PostponeIndexing), ctx, token, attempts, lastError, next)
+}
+
+// PurgeTrash mocks base method.
+func (m *MockDB) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTrash", ctx, deletedBefore)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTrash indicates an expected call of PurgeTrash.
+func (mr *MockDBMockRecorder) PurgeTrash(ctx, deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTrash", reflect.TypeOf((*MockDB)(nil).PurgeTrash), ctx, deletedBefore)
+}
+
+// ReleaseBlob mocks base method.
+func (m *MockDB) ReleaseBlob(ctx context.Context, sha256, storageToken string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseBlob", ctx, sha256, storageToken)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseBlob indicates an expected call of ReleaseBlob.
+func (mr *MockDBMockRecorder) ReleaseBlob(ctx, sha256, storageToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseBlob", reflect.TypeOf((*MockDB)(nil).ReleaseBlob), ctx, sha256, storageToken)
+}
+
+// ReleaseFile mocks base method.
+func (m *MockDB) ReleaseFile(ctx context.Context, token string) (string, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseFile", ctx, token)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReleaseFile indicates an expected call of ReleaseFile.
+func (mr *MockDBMockRecorder) ReleaseFile(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseFile", reflect.TypeOf((*MockDB)(nil).ReleaseFile), ctx, token)
+}
+
+// RestoreBook mocks base method.
+func (m *MockDB) RestoreBook(ctx context.Context, bookToken, ownerEmail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreBook", ctx, bookToken, ownerEmail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreBook indicates an expected call of RestoreBook.
+func (mr *MockDBMockRecorder) RestoreBook(ctx, bookToken, ownerEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreBook", reflect.TypeOf((*MockDB)(nil).RestoreBook), ctx, bookToken, ownerEmail)
+}
+
+// RestoreBookVersion mocks base method.
+func (m *MockDB) RestoreBookVersion(ctx context.Context, bookToken string, version int, editor string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreBookVersion", ctx, bookToken, version, editor)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreBookVersion indicates an expected call of RestoreBookVersion.
+func (mr *MockDBMockRecorder) RestoreBookVersion(ctx, bookToken, version, editor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreBookVersion", reflect.TypeOf((*MockDB)(nil).RestoreBookVersion), ctx, bookToken, version, editor)
+}
+
+// SavePages mocks base method.
+func (m *MockDB) SavePages(ctx context.Context, fileToken string, pages []models.PageText) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePages", ctx, fileToken, pages)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePages indicates an expected call of SavePages.
+func (mr *MockDBMockRecorder) SavePages(ctx, fileToken, pages interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePages", reflect.TypeOf((*MockDB)(nil).SavePages), ctx, fileToken, pages)
+}
+
+// SearchPages mocks base method.
+func (m *MockDB) SearchPages(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.PageText, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchPages", ctx, filter, sort)
+	ret0, _ := ret[0].([]models.PageText)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchPages indicates an expected call of SearchPages.
+func (mr *MockDBMockRecorder) SearchPages(ctx, filter, sort interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchPages", reflect.TypeOf((*MockDB)(nil).SearchPages), ctx, filter, sort)
+}
+
+// SetUserFolder mocks base method.
+func (m *MockDB) SetUserFolder(ctx context.Context, email, folderId string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserFolder", ctx, email, folderId)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetUserFolder indicates an expected call of SetUserFolder.
+func (mr *MockDBMockRecorder) SetUserFolder(ctx, email, folderId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserFolder", reflect.TypeOf((*MockDB)(nil).SetUserFolder), ctx, email, folderId)
 }
 
 // UpdateBook mocks base method.
-func (m *MockDB) UpdateBook(bookFileToken string, updater models.BookDataUpdater) error {
+func (m *MockDB) UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editor string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBook", bookFileToken, updater)
+	ret := m.ctrl.Call(m, "UpdateBook", ctx, bookFileToken, updater, editor)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateBook indicates an expected call of UpdateBook.
-func (mr *MockDBMockRecorder) UpdateBook(bookFileToken, updater interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) UpdateBook(ctx, bookFileToken, updater, editor interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBook", reflect.TypeOf((*MockDB)(nil).UpdateBook), bookFileToken, updater)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBook", reflect.TypeOf((*MockDB)(nil).UpdateBook), ctx, bookFileToken, updater, editor)
+}
+
+// UpdateBookCover mocks base method.
+func (m *MockDB) UpdateBookCover(ctx context.Context, bookFileToken string, cover models.Cover) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBookCover", ctx, bookFileToken, cover)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBookCover indicates an expected call of UpdateBookCover.
+func (mr *MockDBMockRecorder) UpdateBookCover(ctx, bookFileToken, cover interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBookCover", reflect.TypeOf((*MockDB)(nil).UpdateBookCover), ctx, bookFileToken, cover)
+}
+
+// UpdatePasswordHash mocks base method.
+func (m *MockDB) UpdatePasswordHash(ctx context.Context, email, oldHash, newHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasswordHash", ctx, email, oldHash, newHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasswordHash indicates an expected call of UpdatePasswordHash.
+func (mr *MockDBMockRecorder) UpdatePasswordHash(ctx, email, oldHash, newHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasswordHash", reflect.TypeOf((*MockDB)(nil).UpdatePasswordHash), ctx, email, oldHash, newHash)
 }
 
 // UploadFileData mocks base method.
-func (m *MockDB) UploadFileData(fileData *models.FileData) error {
+func (m *MockDB) UploadFileData(ctx context.Context, fileData *models.FileData) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadFileData", fileData)
+	ret := m.ctrl.Call(m, "UploadFileData", ctx, fileData)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UploadFileData indicates an expected call of UploadFileData.
-func (mr *MockDBMockRecorder) UploadFileData(fileData interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) UploadFileData(ctx, fileData interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFileData", reflect.TypeOf((*MockDB)(nil).UploadFileData), fileData)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFileData", reflect.TypeOf((*MockDB)(nil).UploadFileData), ctx, fileData)
 }
 
 // MockStorager is a mock of Storager interface.
@@ -272,48 +717,160 @@ func (m *MockStorager) EXPECT() *MockStoragerMockRecorder {
 	return m.recorder
 }
 
+// CreateFolder mocks base method.
+func (m *MockStorager) CreateFolder(ctx context.Context, parentFolderId, name string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateFolder", ctx, parentFolderId, name)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateFolder indicates an expected call of CreateFolder.
+func (mr *MockStoragerMockRecorder) CreateFolder(ctx, parentFolderId, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFolder", reflect.TypeOf((*MockStorager)(nil).CreateFolder), ctx, parentFolderId, name)
+}
+
 // DeleteFile mocks base method.
-func (m *MockStorager) DeleteFile(fileToken string) error {
+func (m *MockStorager) DeleteFile(ctx context.Context, fileToken string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteFile", fileToken)
+	ret := m.ctrl.Call(m, "DeleteFile", ctx, fileToken)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteFile indicates an expected call of DeleteFile.
-func (mr *MockStoragerMockRecorder) DeleteFile(fileToken interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) DeleteFile(ctx, fileToken interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockStorager)(nil).DeleteFile), fileToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockStorager)(nil).DeleteFile), ctx, fileToken)
 }
 
 // GetServerToUpload mocks base method.
-func (m *MockStorager) GetServerToUpload() (string, error) {
+func (m *MockStorager) GetServerToUpload(ctx context.Context) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetServerToUpload")
+	ret := m.ctrl.Call(m, "GetServerToUpload", ctx)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetServerToUpload indicates an expected call of GetServerToUpload.
-func (mr *MockStoragerMockRecorder) GetServerToUpload() *gomock.Call {
+func (mr *MockStoragerMockRecorder) GetServerToUpload(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerToUpload", reflect.TypeOf((*MockStorager)(nil).GetServerToUpload))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerToUpload", reflect.TypeOf((*MockStorager)(nil).GetServerToUpload), ctx)
+}
+
+// ListFolder mocks base method.
+func (m *MockStorager) ListFolder(ctx context.Context, folderId string) ([]models.StoredFile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFolder", ctx, folderId)
+	ret0, _ := ret[0].([]models.StoredFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFolder indicates an expected call of ListFolder.
+func (mr *MockStoragerMockRecorder) ListFolder(ctx, folderId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFolder", reflect.TypeOf((*MockStorager)(nil).ListFolder), ctx, folderId)
+}
+
+// OpenFile mocks base method.
+func (m *MockStorager) OpenFile(ctx context.Context, fileToken string, size int64) (io.ReadSeekCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenFile", ctx, fileToken, size)
+	ret0, _ := ret[0].(io.ReadSeekCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenFile indicates an expected call of OpenFile.
+func (mr *MockStoragerMockRecorder) OpenFile(ctx, fileToken, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenFile", reflect.TypeOf((*MockStorager)(nil).OpenFile), ctx, fileToken, size)
+}
+
+// Ping mocks base method.
+func (m *MockStorager) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockStoragerMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStorager)(nil).Ping), ctx)
+}
+
+// StatFile mocks base method.
+func (m *MockStorager) StatFile(ctx context.Context, fileToken string) (*models.StoredFile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StatFile", ctx, fileToken)
+	ret0, _ := ret[0].(*models.StoredFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StatFile indicates an expected call of StatFile.
+func (mr *MockStoragerMockRecorder) StatFile(ctx, fileToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StatFile", reflect.TypeOf((*MockStorager)(nil).StatFile), ctx, fileToken)
 }
 
 // UploadFile mocks base method.
-func (m *MockStorager) UploadFile(servForUpload string, file []byte, fileName string) (*models.FileData, error) {
+func (m *MockStorager) UploadFile(ctx context.Context, servForUpload, folderId string, file []byte, fileName, contentType string) (*models.FileData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadFile", servForUpload, file, fileName)
+	ret := m.ctrl.Call(m, "UploadFile", ctx, servForUpload, folderId, file, fileName, contentType)
 	ret0, _ := ret[0].(*models.FileData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UploadFile indicates an expected call of UploadFile.
-func (mr *MockStoragerMockRecorder) UploadFile(servForUpload, file, fileName interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) UploadFile(ctx, servForUpload, folderId, file, fileName, contentType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockStorager)(nil).UploadFile), ctx, servForUpload, folderId, file, fileName, contentType)
+}
+
+// MockThumbnailer is a mock of Thumbnailer interface.
+type MockThumbnailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockThumbnailerMockRecorder
+}
+
+// MockThumbnailerMockRecorder is the mock recorder for MockThumbnailer.
+type MockThumbnailerMockRecorder struct {
+	mock *MockThumbnailer
+}
+
+// NewMockThumbnailer creates a new mock instance.
+func NewMockThumbnailer(ctrl *gomock.Controller) *MockThumbnailer {
+	mock := &MockThumbnailer{ctrl: ctrl}
+	mock.recorder = &MockThumbnailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockThumbnailer) EXPECT() *MockThumbnailerMockRecorder {
+	return m.recorder
+}
+
+// RenderFirstPage mocks base method.
+func (m *MockThumbnailer) RenderFirstPage(ctx context.Context, file []byte, width int) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenderFirstPage", ctx, file, width)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenderFirstPage indicates an expected call of RenderFirstPage.
+func (mr *MockThumbnailerMockRecorder) RenderFirstPage(ctx, file, width interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockStorager)(nil).UploadFile), servForUpload, file, fileName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenderFirstPage", reflect.TypeOf((*MockThumbnailer)(nil).RenderFirstPage), ctx, file, width)
 }
 
 // MockHasher is a mock of Hasher interface.
@@ -367,3 +924,17 @@ func (mr *MockHasherMockRecorder) GetNewHash(password interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNewHash", reflect.TypeOf((*MockHasher)(nil).GetNewHash), password)
 }
+
+// NeedsRehash mocks base method.
+func (m *MockHasher) NeedsRehash(hash string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NeedsRehash", hash)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// NeedsRehash indicates an expected call of NeedsRehash.
+func (mr *MockHasherMockRecorder) NeedsRehash(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NeedsRehash", reflect.TypeOf((*MockHasher)(nil).NeedsRehash), hash)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"crud-books/models"
+	"crud-books/tracing"
+	"fmt"
+)
+
+// Reconcile compares file records and books with the storage contents:
+//   - missing: file records whose stored object is gone;
+//   - dangling: books whose file record doesn't exist;
+//   - orphans: stored objects nothing refers to.
+//
+// With fix set, unreferenced missing records and orphans go through the
+// deletion outbox and dangling books are moved to the trash. Missing files of
+// existing books can't be repaired and are only reported.
+func (s *Services) Reconcile(ctx context.Context, fix bool) (*models.ReconcileReport, error) {
+	ctx, span := tracing.Start(ctx, "services.Reconcile")
+	defer span.End()
+
+	files, err := s.db.GetAllFileData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing file records failed, error: %w", err)
+	}
+	books, err := s.db.GetAllBooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing books failed, error: %w", err)
+	}
+	stored, err := s.storage.ListFolder(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing stored files failed, error: %w", err)
+	}
+
+	report := &models.ReconcileReport{
+		CheckedFiles: len(files),
+		CheckedBooks: len(books),
+		StoredFiles:  len(stored),
+		Missing:      []models.ReconcileEntry{},
+		Dangling:     []models.ReconcileEntry{},
+		Orphans:      []models.ReconcileEntry{},
+	}
+
+	inStorage := map[string]bool{}
+	for _, f := range stored {
+		inStorage[f.Token] = true
+	}
+	records := map[string]bool{}
+	referenced := map[string]bool{}
+	for _, f := range files {
+		records[f.Token] = true
+		referenced[storageTokenOf(f)] = true
+		for _, c := range f.Covers {
+			referenced[c.Token] = true
+		}
+	}
+	for _, b := range books {
+		for _, c := range b.Covers {
+			referenced[c.Token] = true
+		}
+	}
+
+	// files uploaded before folders were used live outside the listed
+	// folder, so objects not listed are looked up one by one
+	exists := map[string]bool{}
+	for _, f := range files {
+		token := storageTokenOf(f)
+		found, checked := exists[token]
+		if !checked {
+			found = inStorage[token]
+			if !found {
+				info, err := s.storage.StatFile(ctx, token)
+				if err != nil {
+					return nil, fmt.Errorf("checking stored file %s failed, error: %w", token, err)
+				}
+				found = info != nil
+			}
+			exists[token] = found
+		}
+		if found {
+			continue
+		}
+
+		entry := models.ReconcileEntry{Token: f.Token, Detail: fmt.Sprintf("stored object %s doesn't exist", token)}
+		if fix {
+			entry.Fixed, err = s.fixMissingFile(ctx, f.Token, token)
+			if err != nil {
+				return nil, err
+			}
+		}
+		report.Missing = append(report.Missing, entry)
+	}
+
+	for _, b := range books {
+		if records[b.FileToken] {
+			continue
+		}
+
+		entry := models.ReconcileEntry{Token: b.FileToken, Detail: fmt.Sprintf("book %q has no file record", b.Title)}
+		if fix && b.DeletedAt == nil {
+			err = s.db.DeleteBook(ctx, b.FileToken, b.OwnerEmail)
+			if err != nil {
+				return nil, fmt.Errorf("moving dangling book %s to trash failed, error: %w", b.FileToken, err)
+			}
+			entry.Fixed = true
+		}
+		report.Dangling = append(report.Dangling, entry)
+	}
+
+	for _, f := range stored {
+		if referenced[f.Token] {
+			continue
+		}
+
+		entry := models.ReconcileEntry{Token: f.Token, Detail: fmt.Sprintf("stored object %q isn't referenced", f.Name)}
+		if fix {
+			err = s.db.EnqueueFileDeletions(ctx, f.Token)
+			if err != nil {
+				return nil, fmt.Errorf("scheduling deletion of orphan %s failed, error: %w", f.Token, err)
+			}
+			entry.Fixed = true
+		}
+		report.Orphans = append(report.Orphans, entry)
+	}
+
+	return report, nil
+}
+
+// fixMissingFile forgets a file whose stored object is gone. The shared blob
+// is dropped so the same content gets uploaded again, and the record is
+// removed through the deletion outbox unless a book still uses it.
+func (s *Services) fixMissingFile(ctx context.Context, fileToken, storageToken string) (bool, error) {
+	err := s.db.ForgetBlob(ctx, storageToken)
+	if err != nil {
+		return false, fmt.Errorf("dropping blob of missing file %s failed, error: %w", fileToken, err)
+	}
+
+	isReferenced, err := s.db.IsFileReferenced(ctx, fileToken)
+	if err != nil {
+		return false, fmt.Errorf("checking references of missing file %s failed, error: %w", fileToken, err)
+	}
+	if isReferenced {
+		return false, nil
+	}
+
+	err = s.db.EnqueueFileDeletions(ctx, fileToken)
+	if err != nil {
+		return false, fmt.Errorf("scheduling deletion of missing file %s failed, error: %w", fileToken, err)
+	}
+	return true, nil
+}
+
+// storageTokenOf returns the stored object of a file. Files uploaded before
+// deduplication are stored under their own token.
+func storageTokenOf(f models.FileData) string {
+	if f.StorageToken != "" {
+		return f.StorageToken
+	}
+	return f.Token
+}
@@ -1,9 +1,22 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crud-books/formats"
 	"crud-books/models"
 	mock_services "crud-books/services/mocks"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -15,8 +28,11 @@ type mocks struct {
 	hasher   *mock_services.MockHasher
 	tokener  *mock_services.MockTokener
 	storager *mock_services.MockStorager
+	thumbs   *mock_services.MockThumbnailer
 }
 
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
 func getMocks(t *testing.T) mocks {
 	ctrl := gomock.NewController(t)
 	return mocks{
@@ -24,6 +40,7 @@ func getMocks(t *testing.T) mocks {
 		hasher:   mock_services.NewMockHasher(ctrl),
 		tokener:  mock_services.NewMockTokener(ctrl),
 		storager: mock_services.NewMockStorager(ctrl),
+		thumbs:   mock_services.NewMockThumbnailer(ctrl),
 	}
 }
 
@@ -40,17 +57,86 @@ func Test_SignIn(t *testing.T) {
 		PasswordHash: "kasldjlajsd@2413",
 	}
 
-	mocks.db.EXPECT().GetUserData(userInp.Email).Return(&userData, nil)
+	mocks.db.EXPECT().GetUserData(gomock.Any(), userInp.Email).Return(&userData, nil)
 	mocks.hasher.EXPECT().CompareHashWithPassword(userInp.Password, userData.PasswordHash).Return(nil)
+	mocks.hasher.EXPECT().NeedsRehash(userData.PasswordHash).Return(false)
 	mocks.tokener.EXPECT().GenAccessToken(userData.Id).Return(token, nil)
 
-	s := New(mocks.db, mocks.tokener, nil, mocks.hasher)
-	tokenRes, err := s.SignIn(userInp)
+	s := New(mocks.db, mocks.tokener, nil, mocks.hasher, nil, testLogger)
+	tokenRes, err := s.SignIn(context.Background(), userInp)
 
 	require.NoError(t, err)
 	assert.Equal(t, token, tokenRes)
 }
 
+func Test_SignIn_Rehash(t *testing.T) {
+	const (
+		token   = "alsdkalsdkjl22412"
+		newHash = "$2a$12$upgraded"
+	)
+	userInp := models.UserDataInput{
+		Email:    "jojek.as@gmail.com",
+		Password: "41uijaksjd",
+	}
+	userData := models.UserData{
+		Id:           "12",
+		Email:        userInp.Email,
+		PasswordHash: "$2a$10$weak",
+	}
+
+	tests := []struct {
+		name      string
+		hashErr   error
+		updateErr error
+	}{
+		{name: "upgraded"},
+		{name: "hashing fails", hashErr: fmt.Errorf("no entropy")},
+		{name: "update fails", updateErr: fmt.Errorf("connection lost")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := getMocks(t)
+			mocks.db.EXPECT().GetUserData(gomock.Any(), userInp.Email).Return(&userData, nil)
+			mocks.hasher.EXPECT().CompareHashWithPassword(userInp.Password, userData.PasswordHash).Return(nil)
+			mocks.hasher.EXPECT().NeedsRehash(userData.PasswordHash).Return(true)
+			mocks.hasher.EXPECT().GetNewHash(userInp.Password).Return(newHash, tt.hashErr)
+			if tt.hashErr == nil {
+				mocks.db.EXPECT().UpdatePasswordHash(gomock.Any(), userData.Email, userData.PasswordHash, newHash).Return(tt.updateErr)
+			}
+			mocks.tokener.EXPECT().GenAccessToken(userData.Id).Return(token, nil)
+
+			// a failed upgrade must not lock the user out
+			s := New(mocks.db, mocks.tokener, nil, mocks.hasher, nil, testLogger)
+			tokenRes, err := s.SignIn(context.Background(), userInp)
+
+			require.NoError(t, err)
+			assert.Equal(t, token, tokenRes)
+		})
+	}
+}
+
+func Test_SignIn_WrongPassword(t *testing.T) {
+	mocks := getMocks(t)
+	userInp := models.UserDataInput{
+		Email:    "jojek.as@gmail.com",
+		Password: "wrong",
+	}
+	userData := models.UserData{
+		Id:           "12",
+		Email:        userInp.Email,
+		PasswordHash: "$2a$10$weak",
+	}
+
+	// a weak hash is only upgraded once the password is proven
+	mocks.db.EXPECT().GetUserData(gomock.Any(), userInp.Email).Return(&userData, nil)
+	mocks.hasher.EXPECT().CompareHashWithPassword(userInp.Password, userData.PasswordHash).Return(fmt.Errorf("mismatch"))
+
+	s := New(mocks.db, mocks.tokener, nil, mocks.hasher, nil, testLogger)
+	_, err := s.SignIn(context.Background(), userInp)
+
+	require.Error(t, err)
+}
+
 func Test_SignUp(t *testing.T) {
 	mocks := getMocks(t)
 	const (
@@ -64,11 +150,11 @@ func Test_SignUp(t *testing.T) {
 	}
 
 	mocks.hasher.EXPECT().GetNewHash(userInp.Password).Return(hash, nil)
-	mocks.db.EXPECT().CreateUser(userInp.Email, hash).Return(userId, nil)
+	mocks.db.EXPECT().CreateUser(gomock.Any(), userInp.Email, hash).Return(userId, nil)
 	mocks.tokener.EXPECT().GenAccessToken(userId).Return(token, nil)
 
-	s := New(mocks.db, mocks.tokener, nil, mocks.hasher)
-	tokenRes, err := s.SignUp(userInp)
+	s := New(mocks.db, mocks.tokener, nil, mocks.hasher, nil, testLogger)
+	tokenRes, err := s.SignUp(context.Background(), userInp)
 
 	require.NoError(t, err)
 	assert.Equal(t, token, tokenRes)
@@ -83,9 +169,9 @@ func Test_GetUserByInsertedId(t *testing.T) {
 		PasswordHash: "fjakjsdk2412",
 	}
 
-	mocks.db.EXPECT().GetUserDataById(userId).Return(&userData, nil)
-	s := New(mocks.db, nil, nil, nil)
-	usData, err := s.GetUserById(userId)
+	mocks.db.EXPECT().GetUserDataById(gomock.Any(), userId).Return(&userData, nil)
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	usData, err := s.GetUserById(context.Background(), userId)
 	require.NoError(t, err)
 	assert.Equal(t, &userData, usData)
 }
@@ -100,18 +186,41 @@ func Test_CreateBook(t *testing.T) {
 		Url:         "https://google.com",
 		OwnerEmail:  "jaksdjkasd@gmail.com",
 	}
-	mocks.db.EXPECT().CreateBook(book.Title, book.Description, book.FileToken, book.OwnerEmail).Return(book.FileToken, nil)
+	mocks.db.EXPECT().CreateBook(gomock.Any(), book.Title, book.Description, book.FileToken, book.OwnerEmail).Return(book.FileToken, nil)
 
-	s := New(mocks.db, nil, nil, nil)
-	fToken, err := s.CreateBook(book.Title, book.Description, book.FileToken, book.OwnerEmail)
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	fToken, err := s.CreateBook(context.Background(), book.Title, book.Description, book.FileToken, book.OwnerEmail)
 	require.NoError(t, err)
 	assert.Equal(t, book.FileToken, fToken)
 }
 
+func Test_CreateBook_PrefillFromMetadata(t *testing.T) {
+	mocks := getMocks(t)
+	const (
+		fileToken  = "41213513513614"
+		ownerEmail = "jaksdjkasd@gmail.com"
+	)
+	fileData := models.FileData{
+		Token: fileToken,
+		Metadata: models.FileMetadata{
+			Title:   "Title from PDF",
+			Subject: "Subject from PDF",
+		},
+	}
+	mocks.db.EXPECT().GetFileData(gomock.Any(), fileToken).Return(&fileData, nil)
+	mocks.db.EXPECT().CreateBook(gomock.Any(), "Title from PDF", "Subject from PDF", fileToken, ownerEmail).Return(fileToken, nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	fToken, err := s.CreateBook(context.Background(), "", "", fileToken, ownerEmail)
+	require.NoError(t, err)
+	assert.Equal(t, fileToken, fToken)
+}
+
 func Test_UploadFile(t *testing.T) {
 	mocks := getMocks(t)
 	defServToUpload := "google.com"
-	file := []byte("dkalsjdkjasdkas")
+	file, err := os.ReadFile("../pdf/testsData/valid.pdf")
+	require.NoError(t, err)
 
 	fileName := "namefile"
 
@@ -119,14 +228,28 @@ func Test_UploadFile(t *testing.T) {
 		DownloadPage: "http://download.com",
 		Token:        "jfkajsdkj413513",
 	}
-	mocks.storager.EXPECT().GetServerToUpload().Return(defServToUpload, nil)
-	mocks.storager.EXPECT().UploadFile(defServToUpload, file, fileName).Return(&fileRet, nil)
-	mocks.db.EXPECT().UploadFileData(&fileRet).Return(nil)
+	mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+	mocks.db.EXPECT().AcquireBlob(gomock.Any(), gomock.Any()).Return(nil, nil)
+	mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", file, fileName, "application/pdf").Return(&fileRet, nil)
+	mocks.db.EXPECT().CreateBlob(gomock.Any(), gomock.Any()).Return(nil)
+	mocks.db.EXPECT().UploadFileData(gomock.Any(), &fileRet).Return(nil)
 
-	s := New(mocks.db, nil, mocks.storager, nil)
-	res, err := s.UploadFile(file, fileName)
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	res, err := s.UploadFile(context.Background(), file, fileName, "")
 	require.NoError(t, err)
 	assert.Equal(t, fileRet.Token, res)
+	assert.Equal(t, "application/pdf", fileRet.MimeType)
+	assert.Equal(t, models.FileMetadata{
+		Pages:        2,
+		Title:        "Test Document",
+		Author:       "Jane Roe",
+		Subject:      "Fixture for parser tests",
+		Keywords:     "pdf, test",
+		CreationDate: time.Date(2023, 4, 26, 12, 0, 0, 0, time.UTC),
+		Size:         int64(len(file)),
+	}, fileRet.Metadata)
+	assert.Equal(t, fileRet.Token, fileRet.StorageToken)
+	assert.Len(t, fileRet.Sha256, 64)
 }
 
 func Test_GetBook(t *testing.T) {
@@ -145,14 +268,27 @@ func Test_GetBook(t *testing.T) {
 		Title:       bookData.Title,
 		Description: bookData.Description,
 	}
-	mocks.db.EXPECT().GetBook(bookToken).Return(&bookData, nil)
+	mocks.db.EXPECT().GetBook(gomock.Any(), bookToken).Return(&bookData, nil)
 
-	s := New(mocks.db, nil, nil, nil)
-	res, err := s.GetBook(bookToken)
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	res, err := s.GetBook(context.Background(), bookToken, "")
 	require.NoError(t, err)
 	assert.Equal(t, want, res)
 }
 
+func Test_GetBook_Private(t *testing.T) {
+	mocks := getMocks(t)
+	bookData := models.BookData{FileToken: "FileToken1", OwnerEmail: "owner@gmail.com", Private: true}
+	mocks.db.EXPECT().GetBook(gomock.Any(), bookData.FileToken).Return(&bookData, nil).Times(2)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	_, err := s.GetBook(context.Background(), bookData.FileToken, "other@gmail.com")
+	assert.ErrorIs(t, err, models.ErrAccessDenied)
+
+	_, err = s.GetBook(context.Background(), bookData.FileToken, bookData.OwnerEmail)
+	assert.NoError(t, err)
+}
+
 func Test_GetBooks(t *testing.T) {
 	mocks := getMocks(t)
 	filter := models.Filter{
@@ -183,10 +319,809 @@ func Test_GetBooks(t *testing.T) {
 			OwnerEmail:  "owner2",
 		},
 	}
-	mocks.db.EXPECT().GetListBooksUser(filter, sort).Return(want, nil)
+	mocks.db.EXPECT().GetListBooksUser(gomock.Any(), filter, sort).Return(want, nil)
 
-	s := New(mocks.db, nil, nil, nil)
-	books, err := s.GetBooks(filter, sort)
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	books, err := s.GetBooks(context.Background(), filter, sort)
 	require.NoError(t, err)
 	assert.Equal(t, &want, books)
 }
+
+func Test_ProcessIndexing(t *testing.T) {
+	const fileToken = "jfkajsdkj413513"
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	file, err := os.ReadFile("../pdf/testsData/valid.pdf")
+	require.NoError(t, err)
+	pending := models.FileData{Token: fileToken, StorageToken: "stored", MimeType: "application/pdf", Metadata: models.FileMetadata{Size: int64(len(file))}}
+
+	t.Run("indexed", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{pending}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", int64(len(file))).Return(nopSeekCloser{bytes.NewReader(file)}, nil)
+		mocks.db.EXPECT().SavePages(gomock.Any(), fileToken, []models.PageText{
+			{FileToken: fileToken, Page: 1, Text: "Hello PDF"},
+			{FileToken: fileToken, Page: 2, Text: "Second page"},
+		}).Return(nil)
+		mocks.db.EXPECT().MarkFileIndexed(gomock.Any(), fileToken, "").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+
+	t.Run("storage_unavailable", func(t *testing.T) {
+		mocks := getMocks(t)
+		retried := pending
+		retried.IndexAttempts = 1
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{retried}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", gomock.Any()).Return(nil, fmt.Errorf("gofile is down"))
+		mocks.db.EXPECT().PostponeIndexing(gomock.Any(), fileToken, 2, gomock.Any(), now.Add(2*indexBaseBackoff)).Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+
+	t.Run("gives_up", func(t *testing.T) {
+		mocks := getMocks(t)
+		retried := pending
+		retried.IndexAttempts = indexMaxAttempts - 1
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{retried}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", gomock.Any()).Return(nil, fmt.Errorf("gofile is down"))
+		mocks.db.EXPECT().MarkFileIndexed(gomock.Any(), fileToken, gomock.Any()).Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+
+	t.Run("unreadable_content", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{pending}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", gomock.Any()).Return(nopSeekCloser{bytes.NewReader([]byte("%PDF-1.4 garbage"))}, nil)
+		mocks.db.EXPECT().MarkFileIndexed(gomock.Any(), fileToken, gomock.Any()).Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+
+	t.Run("extraction_panics", func(t *testing.T) {
+		formats.Register(formats.Format{
+			Name:     "panicking",
+			MimeType: "application/x-panicking",
+			Detect:   func([]byte) bool { return false },
+			ExtractText: func([]byte) ([]string, error) {
+				panic("index out of range [-1]")
+			},
+		})
+
+		mocks := getMocks(t)
+		crashing := pending
+		crashing.MimeType = "application/x-panicking"
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{crashing}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", gomock.Any()).Return(nopSeekCloser{bytes.NewReader(file)}, nil)
+		mocks.db.EXPECT().PostponeIndexing(gomock.Any(), fileToken, 1, "text extraction panicked: index out of range [-1]", now.Add(indexBaseBackoff)).Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+
+	t.Run("unknown_format", func(t *testing.T) {
+		mocks := getMocks(t)
+		unknown := models.FileData{Token: fileToken, MimeType: "application/x-unknown"}
+		mocks.db.EXPECT().GetUnindexedFiles(gomock.Any(), now, indexBatchSize).Return([]models.FileData{unknown}, nil)
+		mocks.db.EXPECT().MarkFileIndexed(gomock.Any(), fileToken, "").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processIndexing(context.Background(), now))
+	})
+}
+
+func Test_WakeIndexer(t *testing.T) {
+	s := New(nil, nil, nil, nil, nil, testLogger)
+
+	// wake ups coalesce instead of blocking the upload
+	s.wakeIndexer()
+	s.wakeIndexer()
+	assert.Len(t, s.indexWake, 1)
+}
+
+func Test_SearchBooksContent(t *testing.T) {
+	mocks := getMocks(t)
+	filter := models.Filter{Search: "island"}
+	sort := models.Sort{Limit: 10}
+	pages := []models.PageText{
+		{FileToken: "token1", Page: 3, Text: "Stories about an island far away"},
+	}
+	mocks.db.EXPECT().SearchPages(gomock.Any(), filter, sort).Return(pages, nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	hits, err := s.SearchBooksContent(context.Background(), filter, sort)
+	require.NoError(t, err)
+	assert.Equal(t, &[]models.ContentHit{
+		{BookId: "token1", Page: 3, Snippet: "Stories about an island far away"},
+	}, hits)
+}
+
+func Test_Snippet(t *testing.T) {
+	long := strings.Repeat("a ", 100) + "Needle" + strings.Repeat(" b", 100)
+
+	got := snippet(long, "needle")
+	assert.True(t, strings.HasPrefix(got, "…"))
+	assert.True(t, strings.HasSuffix(got, "…"))
+	assert.Contains(t, got, "Needle")
+
+	assert.Equal(t, "short text", snippet("short\ntext", "missing"))
+}
+
+func Test_UploadFile_RendersCovers(t *testing.T) {
+	mocks := getMocks(t)
+	defServToUpload := "google.com"
+	file, err := os.ReadFile("../pdf/testsData/valid.pdf")
+	require.NoError(t, err)
+
+	fileRet := models.FileData{
+		DownloadPage: "http://download.com",
+		Token:        "jfkajsdkj413513",
+	}
+	gomock.InOrder(
+		mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil),
+		mocks.db.EXPECT().AcquireBlob(gomock.Any(), gomock.Any()).Return(nil, nil),
+		mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", file, "book.pdf", "application/pdf").Return(&fileRet, nil),
+		mocks.db.EXPECT().CreateBlob(gomock.Any(), gomock.Any()).Return(nil),
+		mocks.thumbs.EXPECT().RenderFirstPage(gomock.Any(), file, 160).Return([]byte("small"), nil),
+		mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", []byte("small"), "book-cover-160.png", "image/png").
+			Return(&models.FileData{Token: "small", DownloadPage: "http://download.com/small"}, nil),
+		mocks.thumbs.EXPECT().RenderFirstPage(gomock.Any(), file, 480).Return(nil, fmt.Errorf("render failed")),
+	)
+	mocks.db.EXPECT().UploadFileData(gomock.Any(), &fileRet).Return(nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, mocks.thumbs, testLogger)
+	_, err = s.UploadFile(context.Background(), file, "book.pdf", "")
+	require.NoError(t, err)
+	assert.Equal(t, []models.Cover{
+		{Width: 160, Token: "small", Url: "/api/v1/books/jfkajsdkj413513/cover?width=160"},
+	}, fileRet.Covers)
+}
+
+func Test_UpdateBookCover(t *testing.T) {
+	mocks := getMocks(t)
+	const bookToken = "1893859195"
+	defServToUpload := "google.com"
+
+	buf := bytes.NewBuffer(nil)
+	err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 300, 400)))
+	require.NoError(t, err)
+	img := buf.Bytes()
+
+	book := models.BookData{FileToken: bookToken, OwnerEmail: "owner@gmail.com"}
+	mocks.db.EXPECT().GetBook(gomock.Any(), bookToken).Return(&book, nil).Times(2)
+	mocks.db.EXPECT().GetFileData(gomock.Any(), bookToken).Return(&models.FileData{Token: bookToken, FolderId: "folder"}, nil)
+	mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+	mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "folder", img, "cover.png", "image/png").
+		Return(&models.FileData{Token: "cover", DownloadPage: "http://download.com/cover"}, nil)
+	mocks.db.EXPECT().UpdateBookCover(gomock.Any(), bookToken, models.Cover{
+		Width: 300,
+		Token: "cover",
+		Url:   "/api/v1/books/1893859195/cover?width=300",
+	}).Return(nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	url, err := s.UpdateBookCover(context.Background(), bookToken, img, "cover.png", book.OwnerEmail)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/books/1893859195/cover?width=300", url)
+
+	_, err = s.UpdateBookCover(context.Background(), bookToken, []byte("not an image"), "cover.png", book.OwnerEmail)
+	assert.Error(t, err)
+
+	_, err = s.UpdateBookCover(context.Background(), bookToken, img, "cover.png", "other@gmail.com")
+	assert.ErrorIs(t, err, models.ErrAccessDenied)
+}
+
+func Test_OpenBookCover(t *testing.T) {
+	const bookToken = "1893859195"
+	covers := []models.Cover{{Width: 160, Token: "small"}, {Width: 480, Token: "large"}}
+
+	t.Run("closest_width", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), bookToken).Return(&models.BookData{FileToken: bookToken, Covers: covers}, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "large", int64(0)).Return(nopSeekCloser{bytes.NewReader([]byte("cover"))}, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		cover, err := s.OpenBookCover(context.Background(), bookToken, 200, "")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), cover.Size)
+		assert.Equal(t, "large", cover.ETag)
+	})
+
+	t.Run("private_book", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), bookToken).Return(&models.BookData{FileToken: bookToken, Covers: covers, Private: true, OwnerEmail: "owner@gmail.com"}, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		_, err := s.OpenBookCover(context.Background(), bookToken, 0, "other@gmail.com")
+		assert.ErrorIs(t, err, models.ErrAccessDenied)
+	})
+
+	t.Run("no_cover", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), bookToken).Return(&models.BookData{FileToken: bookToken}, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		_, err := s.OpenBookCover(context.Background(), bookToken, 0, "")
+		assert.ErrorIs(t, err, models.ErrNoCover)
+	})
+}
+
+func Test_PickCover(t *testing.T) {
+	covers := []models.Cover{{Width: 480, Token: "large"}, {Width: 160, Token: "small"}}
+
+	for width, want := range map[int]string{0: "large", 100: "small", 160: "small", 161: "large", 2000: "large"} {
+		got, ok := pickCover(covers, width)
+		require.True(t, ok)
+		assert.Equal(t, want, got.Token, "width %d", width)
+	}
+
+	_, ok := pickCover(nil, 160)
+	assert.False(t, ok)
+}
+
+func Test_UploadFile_Epub(t *testing.T) {
+	mocks := getMocks(t)
+	defServToUpload := "google.com"
+	file, err := os.ReadFile("../formats/testsData/book.epub")
+	require.NoError(t, err)
+
+	fileRet := models.FileData{
+		DownloadPage: "http://download.com",
+		Token:        "jfkajsdkj413513",
+	}
+	mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+	mocks.db.EXPECT().AcquireBlob(gomock.Any(), gomock.Any()).Return(nil, nil)
+	mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", file, "book.epub", "application/epub+zip").Return(&fileRet, nil)
+	mocks.db.EXPECT().CreateBlob(gomock.Any(), gomock.Any()).Return(nil)
+	mocks.db.EXPECT().UploadFileData(gomock.Any(), &fileRet).Return(nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, mocks.thumbs, testLogger)
+	_, err = s.UploadFile(context.Background(), file, "book.epub", "")
+	require.NoError(t, err)
+	assert.Equal(t, "application/epub+zip", fileRet.MimeType)
+	assert.Equal(t, "The Adventures of Tom Sawyer", fileRet.Metadata.Title)
+	assert.Empty(t, fileRet.Covers)
+}
+
+func Test_ProcessFileDeletions(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("deleted", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file"}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "file").Return("stored", 0, nil)
+		mocks.storager.EXPECT().DeleteFile(gomock.Any(), "stored").Return(nil)
+		mocks.db.EXPECT().DeleteBlob(gomock.Any(), "stored").Return(nil)
+		mocks.db.EXPECT().CompleteFileDeletion(gomock.Any(), "file").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+
+	t.Run("orphan_with_cover", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file"}, {Token: "cover"}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "file").Return("stored", 0, nil)
+		mocks.storager.EXPECT().DeleteFile(gomock.Any(), "stored").Return(nil)
+		mocks.db.EXPECT().DeleteBlob(gomock.Any(), "stored").Return(nil)
+		mocks.db.EXPECT().CompleteFileDeletion(gomock.Any(), "file").Return(nil)
+		// covers have no file record and are deleted as they are
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "cover").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "cover").Return("cover", 0, nil)
+		mocks.storager.EXPECT().DeleteFile(gomock.Any(), "cover").Return(nil)
+		mocks.db.EXPECT().DeleteBlob(gomock.Any(), "cover").Return(nil)
+		mocks.db.EXPECT().CompleteFileDeletion(gomock.Any(), "cover").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+
+	t.Run("still_referenced", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file"}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(true, nil)
+		mocks.db.EXPECT().DropFileDeletion(gomock.Any(), "file").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+
+	t.Run("storage_failure_postponed", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file", Attempts: 2}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "file").Return("file", 0, nil)
+		mocks.storager.EXPECT().DeleteFile(gomock.Any(), "file").Return(fmt.Errorf("unavailable"))
+		mocks.db.EXPECT().PostponeFileDeletion(gomock.Any(), "file", 3, "unavailable", now.Add(4*time.Minute)).Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+
+	t.Run("content_still_shared", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file"}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "file").Return("stored", 1, nil)
+		mocks.db.EXPECT().CompleteFileDeletion(gomock.Any(), "file").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+
+	t.Run("gives_up", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetFileDeletions(gomock.Any(), now, deletionBatchSize).Return([]models.FileDeletion{{Token: "file", Attempts: deletionMaxAttempts - 1}}, nil)
+		mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "file").Return(false, nil)
+		mocks.db.EXPECT().ReleaseFile(gomock.Any(), "file").Return("file", 0, nil)
+		mocks.storager.EXPECT().DeleteFile(gomock.Any(), "file").Return(fmt.Errorf("unavailable"))
+		mocks.db.EXPECT().DropFileDeletion(gomock.Any(), "file").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		require.NoError(t, s.processFileDeletions(context.Background(), now))
+	})
+}
+
+func Test_DeletionBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, deletionBackoff(1))
+	assert.Equal(t, 8*time.Minute, deletionBackoff(4))
+	assert.Equal(t, deletionMaxBackoff, deletionBackoff(30))
+}
+
+func Test_DeleteBook(t *testing.T) {
+	book := models.BookData{FileToken: "FileToken1", OwnerEmail: "owner@gmail.com"}
+
+	t.Run("owner", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), "FileToken1").Return(&book, nil)
+		mocks.db.EXPECT().DeleteBook(gomock.Any(), "FileToken1", "owner@gmail.com").Return(nil)
+
+		s := New(mocks.db, nil, nil, nil, nil, testLogger)
+		require.NoError(t, s.DeleteBook(context.Background(), "FileToken1", "owner@gmail.com"))
+	})
+
+	t.Run("not_owner", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), "FileToken1").Return(&book, nil)
+
+		s := New(mocks.db, nil, nil, nil, nil, testLogger)
+		err := s.DeleteBook(context.Background(), "FileToken1", "other@gmail.com")
+		assert.ErrorIs(t, err, models.ErrAccessDenied)
+	})
+}
+
+func Test_RestoreBook(t *testing.T) {
+	mocks := getMocks(t)
+	mocks.db.EXPECT().RestoreBook(gomock.Any(), "FileToken1", "owner@gmail.com").Return(nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	require.NoError(t, s.RestoreBook(context.Background(), "FileToken1", "owner@gmail.com"))
+}
+
+func Test_GetTrash(t *testing.T) {
+	mocks := getMocks(t)
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	trash := []models.BookData{{FileToken: "FileToken1", DeletedAt: &deletedAt}}
+	mocks.db.EXPECT().GetTrash(gomock.Any(), "owner@gmail.com").Return(trash, nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	got, err := s.GetTrash(context.Background(), "owner@gmail.com")
+	require.NoError(t, err)
+	assert.Equal(t, trash, *got)
+}
+
+func Test_UploadFile_Deduplicated(t *testing.T) {
+	mocks := getMocks(t)
+	defServToUpload := "google.com"
+	file, err := os.ReadFile("../formats/testsData/book.epub")
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(file)
+	hash := hex.EncodeToString(sum[:])
+	blob := models.Blob{
+		Sha256:       hash,
+		StorageToken: "stored",
+		DownloadPage: "http://download.com/stored",
+		RefCount:     2,
+	}
+
+	var recorded *models.FileData
+	mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+	mocks.db.EXPECT().AcquireBlob(gomock.Any(), hash).Return(&blob, nil)
+	mocks.db.EXPECT().UploadFileData(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, f *models.FileData) error {
+		recorded = f
+		return nil
+	})
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	token, err := s.UploadFile(context.Background(), file, "book.epub", "")
+	require.NoError(t, err)
+
+	require.NotNil(t, recorded)
+	assert.Equal(t, token, recorded.Token)
+	assert.NotEqual(t, blob.StorageToken, recorded.Token)
+	assert.Equal(t, blob.StorageToken, recorded.StorageToken)
+	assert.Equal(t, blob.DownloadPage, recorded.DownloadPage)
+	assert.Equal(t, hash, recorded.Sha256)
+}
+
+func Test_UploadFile_ReleasesContentOnFailure(t *testing.T) {
+	defServToUpload := "google.com"
+
+	t.Run("shared_content", func(t *testing.T) {
+		mocks := getMocks(t)
+		file, err := os.ReadFile("../formats/testsData/book.epub")
+		require.NoError(t, err)
+		sum := sha256.Sum256(file)
+		hash := hex.EncodeToString(sum[:])
+
+		mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+		mocks.db.EXPECT().AcquireBlob(gomock.Any(), hash).Return(&models.Blob{Sha256: hash, StorageToken: "stored", RefCount: 2}, nil)
+		mocks.db.EXPECT().UploadFileData(gomock.Any(), gomock.Any()).Return(fmt.Errorf("db is down"))
+		mocks.db.EXPECT().ReleaseBlob(gomock.Any(), hash, "stored").Return(1, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		_, err = s.UploadFile(context.Background(), file, "book.epub", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("new_content", func(t *testing.T) {
+		mocks := getMocks(t)
+		file, err := os.ReadFile("../pdf/testsData/valid.pdf")
+		require.NoError(t, err)
+		sum := sha256.Sum256(file)
+		hash := hex.EncodeToString(sum[:])
+
+		mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+		mocks.db.EXPECT().AcquireBlob(gomock.Any(), hash).Return(nil, nil)
+		mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", file, "book.pdf", "application/pdf").
+			Return(&models.FileData{Token: "stored"}, nil)
+		mocks.db.EXPECT().CreateBlob(gomock.Any(), gomock.Any()).Return(nil)
+		mocks.thumbs.EXPECT().RenderFirstPage(gomock.Any(), file, gomock.Any()).Return([]byte("cover"), nil).Times(2)
+		mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", []byte("cover"), gomock.Any(), "image/png").
+			Return(&models.FileData{Token: "small"}, nil)
+		mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "", []byte("cover"), gomock.Any(), "image/png").
+			Return(&models.FileData{Token: "large"}, nil)
+		mocks.db.EXPECT().UploadFileData(gomock.Any(), gomock.Any()).Return(fmt.Errorf("db is down"))
+		mocks.db.EXPECT().ReleaseBlob(gomock.Any(), hash, "stored").Return(0, nil)
+		mocks.db.EXPECT().EnqueueFileDeletions(gomock.Any(), "stored").Return(nil)
+		mocks.db.EXPECT().EnqueueFileDeletions(gomock.Any(), "small", "large").Return(nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, mocks.thumbs, testLogger)
+		_, err = s.UploadFile(context.Background(), file, "book.pdf", "")
+		assert.Error(t, err)
+	})
+}
+
+func Test_NewFileToken(t *testing.T) {
+	a, err := newFileToken()
+	require.NoError(t, err)
+	b, err := newFileToken()
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, a)
+	assert.NotEqual(t, a, b)
+}
+
+func Test_UpdateBook(t *testing.T) {
+	const owner = "owner@gmail.com"
+	yes, no := true, false
+
+	tests := []struct {
+		name    string
+		private bool
+		setTo   *bool
+		editor  string
+		allowed bool
+	}{
+		{name: "editor of public book", editor: "editor@gmail.com", allowed: true},
+		{name: "owner hides book", setTo: &yes, editor: owner, allowed: true},
+		{name: "editor hides book", setTo: &yes, editor: "editor@gmail.com"},
+		{name: "editor publishes private book", private: true, setTo: &no, editor: "editor@gmail.com"},
+		{name: "editor of private book", private: true, editor: "editor@gmail.com"},
+		{name: "editor keeps book public", setTo: &no, editor: "editor@gmail.com", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := getMocks(t)
+			book := models.BookData{FileToken: "old", OwnerEmail: owner, Private: tt.private}
+			updater := models.BookDataUpdater{FileToken: "new", Title: "Title", Description: "Description", Private: tt.setTo}
+			mocks.db.EXPECT().GetBook(gomock.Any(), "old").Return(&book, nil)
+			if tt.allowed {
+				mocks.db.EXPECT().UpdateBook(gomock.Any(), "old", updater, tt.editor).Return(nil)
+			}
+
+			s := New(mocks.db, nil, nil, nil, nil, testLogger)
+			err := s.UpdateBook(context.Background(), "old", updater, tt.editor)
+			if tt.allowed {
+				require.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, models.ErrAccessDenied)
+			}
+		})
+	}
+}
+
+func Test_GetBookVersions_Private(t *testing.T) {
+	mocks := getMocks(t)
+	book := models.BookData{FileToken: "new", OwnerEmail: "owner@gmail.com", Private: true}
+	versions := []models.BookVersion{{Version: 1, FileToken: "new"}}
+	mocks.db.EXPECT().GetBook(gomock.Any(), "new").Return(&book, nil).Times(4)
+	mocks.db.EXPECT().GetBookVersions(gomock.Any(), "new").Return(versions, nil)
+	mocks.db.EXPECT().GetBookVersion(gomock.Any(), "new", 1).Return(&versions[0], nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	got, err := s.GetBookVersions(context.Background(), "new", book.OwnerEmail)
+	require.NoError(t, err)
+	assert.Equal(t, versions, *got)
+	v, err := s.GetBookVersion(context.Background(), "new", 1, book.OwnerEmail)
+	require.NoError(t, err)
+	assert.Equal(t, &versions[0], v)
+
+	_, err = s.GetBookVersions(context.Background(), "new", "other@gmail.com")
+	assert.ErrorIs(t, err, models.ErrAccessDenied)
+	_, err = s.GetBookVersion(context.Background(), "new", 1, "other@gmail.com")
+	assert.ErrorIs(t, err, models.ErrAccessDenied)
+}
+
+func Test_GetBookVersions_Editor(t *testing.T) {
+	book := models.BookData{FileToken: "new", OwnerEmail: "owner@gmail.com"}
+	getVersions := func() []models.BookVersion {
+		return []models.BookVersion{{Version: 1, FileToken: "new", Editor: "editor@gmail.com"}}
+	}
+
+	for _, tt := range []struct {
+		name       string
+		userEmail  string
+		wantEditor string
+	}{
+		{"owner", book.OwnerEmail, "editor@gmail.com"},
+		{"other_user", "other@gmail.com", ""},
+		{"anonymous", "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := getMocks(t)
+			versions := getVersions()
+			mocks.db.EXPECT().GetBook(gomock.Any(), "new").Return(&book, nil).Times(2)
+			mocks.db.EXPECT().GetBookVersions(gomock.Any(), "new").Return(versions, nil)
+			mocks.db.EXPECT().GetBookVersion(gomock.Any(), "new", 1).Return(&getVersions()[0], nil)
+
+			s := New(mocks.db, nil, nil, nil, nil, testLogger)
+			got, err := s.GetBookVersions(context.Background(), "new", tt.userEmail)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEditor, (*got)[0].Editor)
+
+			v, err := s.GetBookVersion(context.Background(), "new", 1, tt.userEmail)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEditor, v.Editor)
+		})
+	}
+}
+
+func Test_RestoreBookVersion(t *testing.T) {
+	mocks := getMocks(t)
+	book := models.BookData{FileToken: "new", OwnerEmail: "owner@gmail.com"}
+	mocks.db.EXPECT().GetBook(gomock.Any(), "new").Return(&book, nil).Times(2)
+	mocks.db.EXPECT().RestoreBookVersion(gomock.Any(), "new", 1, book.OwnerEmail).Return("old", nil)
+
+	s := New(mocks.db, nil, nil, nil, nil, testLogger)
+	token, err := s.RestoreBookVersion(context.Background(), "new", 1, book.OwnerEmail)
+	require.NoError(t, err)
+	assert.Equal(t, "old", token)
+
+	_, err = s.RestoreBookVersion(context.Background(), "new", 1, "editor@gmail.com")
+	assert.ErrorIs(t, err, models.ErrAccessDenied)
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func Test_OpenBookFile(t *testing.T) {
+	book := models.BookData{Title: "Tom Sawyer", FileToken: "file", OwnerEmail: "owner@gmail.com"}
+	fileData := models.FileData{
+		Token:        "file",
+		StorageToken: "stored",
+		MimeType:     "application/epub+zip",
+		Sha256:       "abc",
+		Metadata:     models.FileMetadata{Size: 5},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mocks := getMocks(t)
+		mocks.db.EXPECT().GetBook(gomock.Any(), "file").Return(&book, nil)
+		mocks.db.EXPECT().GetFileData(gomock.Any(), "file").Return(&fileData, nil)
+		mocks.storager.EXPECT().OpenFile(gomock.Any(), "stored", int64(5)).Return(nopSeekCloser{bytes.NewReader([]byte("hello"))}, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		f, err := s.OpenBookFile(context.Background(), "file", "")
+		require.NoError(t, err)
+		assert.Equal(t, "Tom Sawyer.epub", f.Name)
+		assert.Equal(t, "application/epub+zip", f.MimeType)
+		assert.Equal(t, int64(5), f.Size)
+		assert.Equal(t, "abc", f.ETag)
+	})
+
+	t.Run("private", func(t *testing.T) {
+		mocks := getMocks(t)
+		private := book
+		private.Private = true
+		mocks.db.EXPECT().GetBook(gomock.Any(), "file").Return(&private, nil)
+
+		s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+		_, err := s.OpenBookFile(context.Background(), "file", "other@gmail.com")
+		assert.ErrorIs(t, err, models.ErrAccessDenied)
+	})
+}
+
+func Test_DownloadName(t *testing.T) {
+	assert.Equal(t, "a_b.pdf", downloadName("a/b", "application/pdf"))
+	assert.Equal(t, "book.txt", downloadName("  ", "text/plain"))
+	assert.Equal(t, "Title", downloadName("Title", "application/octet-stream"))
+}
+
+func Test_UploadFile_UserFolder(t *testing.T) {
+	mocks := getMocks(t)
+	defServToUpload := "google.com"
+	file, err := os.ReadFile("../formats/testsData/book.epub")
+	require.NoError(t, err)
+
+	const email = "owner@gmail.com"
+	fileRet := models.FileData{Token: "stored", FolderId: "folder"}
+
+	mocks.db.EXPECT().GetUserData(gomock.Any(), email).Return(&models.UserData{Id: "42", Email: email}, nil)
+	mocks.storager.EXPECT().CreateFolder(gomock.Any(), "", "user-42").Return("folder", nil)
+	mocks.db.EXPECT().SetUserFolder(gomock.Any(), email, "folder").Return("folder", nil)
+	mocks.storager.EXPECT().GetServerToUpload(gomock.Any()).Return(defServToUpload, nil)
+	mocks.db.EXPECT().AcquireBlob(gomock.Any(), gomock.Any()).Return(nil, nil)
+	mocks.storager.EXPECT().UploadFile(gomock.Any(), defServToUpload, "folder", file, "book.epub", "application/epub+zip").Return(&fileRet, nil)
+	mocks.db.EXPECT().CreateBlob(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, b models.Blob) error {
+		assert.Equal(t, "folder", b.FolderId)
+		return nil
+	})
+	mocks.db.EXPECT().UploadFileData(gomock.Any(), &fileRet).Return(nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	s.UseUserFolders(true)
+	_, err = s.UploadFile(context.Background(), file, "book.epub", email)
+	require.NoError(t, err)
+	assert.Equal(t, "folder", fileRet.FolderId)
+}
+
+func Test_UploadFolder_Existing(t *testing.T) {
+	mocks := getMocks(t)
+	const email = "owner@gmail.com"
+
+	mocks.db.EXPECT().GetUserData(gomock.Any(), email).Return(&models.UserData{Id: "42", Email: email, FolderId: "folder"}, nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	s.UseUserFolders(true)
+	folderId, err := s.uploadFolder(context.Background(), email)
+	require.NoError(t, err)
+	assert.Equal(t, "folder", folderId)
+
+	s.UseUserFolders(false)
+	folderId, err = s.uploadFolder(context.Background(), email)
+	require.NoError(t, err)
+	assert.Empty(t, folderId)
+}
+
+func Test_Reconcile(t *testing.T) {
+	mocks := getMocks(t)
+
+	files := []models.FileData{
+		{Token: "ok", StorageToken: "stored-ok"},
+		{Token: "legacy"},
+		{Token: "lost-used", StorageToken: "stored-lost"},
+		{Token: "lost-unused", StorageToken: "stored-lost"},
+		{Token: "cover-owner", StorageToken: "stored-ok", Covers: []models.Cover{{Token: "file-cover"}}},
+	}
+	books := []models.BookData{
+		{FileToken: "ok", Covers: []models.Cover{{Token: "book-cover"}}},
+		{FileToken: "gone", Title: "Gone"},
+	}
+	stored := []models.StoredFile{
+		{Token: "stored-ok"},
+		{Token: "book-cover"},
+		{Token: "file-cover"},
+		{Token: "stray", Name: "stray.pdf"},
+	}
+
+	mocks.db.EXPECT().GetAllFileData(gomock.Any()).Return(files, nil)
+	mocks.db.EXPECT().GetAllBooks(gomock.Any()).Return(books, nil)
+	mocks.storager.EXPECT().ListFolder(gomock.Any(), "").Return(stored, nil)
+	mocks.storager.EXPECT().StatFile(gomock.Any(), "legacy").Return(&models.StoredFile{Token: "legacy"}, nil)
+	mocks.storager.EXPECT().StatFile(gomock.Any(), "stored-lost").Return(nil, nil)
+
+	mocks.db.EXPECT().ForgetBlob(gomock.Any(), "stored-lost").Return(nil).Times(2)
+	mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "lost-used").Return(true, nil)
+	mocks.db.EXPECT().IsFileReferenced(gomock.Any(), "lost-unused").Return(false, nil)
+	mocks.db.EXPECT().EnqueueFileDeletions(gomock.Any(), "lost-unused").Return(nil)
+	mocks.db.EXPECT().DeleteBook(gomock.Any(), "gone", "").Return(nil)
+	mocks.db.EXPECT().EnqueueFileDeletions(gomock.Any(), "stray").Return(nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	report, err := s.Reconcile(context.Background(), true)
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, report.CheckedFiles)
+	assert.Equal(t, 2, report.CheckedBooks)
+	assert.Equal(t, 4, report.StoredFiles)
+	assert.Equal(t, []models.ReconcileEntry{
+		{Token: "lost-used", Detail: "stored object stored-lost doesn't exist", Fixed: false},
+		{Token: "lost-unused", Detail: "stored object stored-lost doesn't exist", Fixed: true},
+	}, report.Missing)
+	assert.Equal(t, []models.ReconcileEntry{
+		{Token: "gone", Detail: `book "Gone" has no file record`, Fixed: true},
+	}, report.Dangling)
+	assert.Equal(t, []models.ReconcileEntry{
+		{Token: "stray", Detail: `stored object "stray.pdf" isn't referenced`, Fixed: true},
+	}, report.Orphans)
+}
+
+func Test_Reconcile_ReportOnly(t *testing.T) {
+	mocks := getMocks(t)
+
+	mocks.db.EXPECT().GetAllFileData(gomock.Any()).Return([]models.FileData{{Token: "lost"}}, nil)
+	mocks.db.EXPECT().GetAllBooks(gomock.Any()).Return(nil, nil)
+	mocks.storager.EXPECT().ListFolder(gomock.Any(), "").Return([]models.StoredFile{{Token: "stray"}}, nil)
+	mocks.storager.EXPECT().StatFile(gomock.Any(), "lost").Return(nil, nil)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	report, err := s.Reconcile(context.Background(), false)
+	require.NoError(t, err)
+	assert.Len(t, report.Missing, 1)
+	assert.Len(t, report.Orphans, 1)
+	assert.False(t, report.Missing[0].Fixed)
+	assert.False(t, report.Orphans[0].Fixed)
+}
+
+func Test_Readiness(t *testing.T) {
+	mocks := getMocks(t)
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	s.health.now = func() time.Time { return now }
+	s.health.workerStarted(trashPurgeWorker)
+
+	mocks.db.EXPECT().Ping(gomock.Any()).Return(nil).Times(2)
+	mocks.storager.EXPECT().Ping(gomock.Any()).Return(nil)
+
+	r := s.Readiness(context.Background())
+	assert.Equal(t, "ok", r.Status)
+	assert.Equal(t, "ok", r.Checks["mongodb"].Status)
+	assert.Equal(t, "ok", r.Checks["storage"].Status)
+	assert.True(t, r.Workers[trashPurgeWorker].Running)
+
+	// the storage result is cached, a stopped worker makes the app not ready
+	s.health.workerRan(trashPurgeWorker, fmt.Errorf("purge failed"))
+	s.health.workerStopped(trashPurgeWorker)
+	now = now.Add(storageCheckTTL / 2)
+
+	r = s.Readiness(context.Background())
+	assert.Equal(t, "fail", r.Status)
+	assert.Equal(t, "ok", r.Checks["storage"].Status)
+	assert.Equal(t, "purge failed", r.Workers[trashPurgeWorker].LastError)
+	assert.False(t, r.Workers[trashPurgeWorker].Running)
+}
+
+func Test_Readiness_Unavailable(t *testing.T) {
+	mocks := getMocks(t)
+
+	mocks.db.EXPECT().Ping(gomock.Any()).Return(fmt.Errorf("no primary"))
+	mocks.storager.EXPECT().Ping(gomock.Any()).Return(fmt.Errorf("circuit breaker is open"))
+
+	s := New(mocks.db, nil, mocks.storager, nil, nil, testLogger)
+	r := s.Readiness(context.Background())
+	assert.Equal(t, "fail", r.Status)
+	assert.Equal(t, "no primary", r.Checks["mongodb"].Error)
+	assert.Equal(t, "circuit breaker is open", r.Checks["storage"].Error)
+}
@@ -1,8 +1,15 @@
 package services
 
 import (
+	"context"
+	"crud-books/formats"
+	"crud-books/metrics"
 	"crud-books/models"
+	"crud-books/tracing"
 	"fmt"
+	"io"
+	"log/slog"
+	"time"
 )
 
 //go:generate mockgen -source=services.go -destination=mocks/services_mock.go
@@ -12,31 +19,79 @@ type Tokener interface {
 }
 
 type DB interface {
-	CreateUser(email, passwordHash string) (string, error)
-	GetUserData(email string) (*models.UserData, error)
-	GetUserDataById(userId string) (*models.UserData, error)
+	Ping(ctx context.Context) error
 
-	UploadFileData(fileData *models.FileData) error
-	GetFileData(fileToken string) (*models.FileData, error)
+	CreateUser(ctx context.Context, email, passwordHash string) (string, error)
+	GetUserData(ctx context.Context, email string) (*models.UserData, error)
+	GetUserDataById(ctx context.Context, userId string) (*models.UserData, error)
+	SetUserFolder(ctx context.Context, email, folderId string) (string, error)
+	UpdatePasswordHash(ctx context.Context, email, oldHash, newHash string) error
 
-	GetListBooks(filter models.Filter, sort models.Sort) ([]models.BookData, error)
-	GetListBooksUser(filter models.Filter, sort models.Sort) ([]models.BookData, error)
+	UploadFileData(ctx context.Context, fileData *models.FileData) error
+	GetFileData(ctx context.Context, fileToken string) (*models.FileData, error)
 
-	CreateBook(title, description, fileToken, emailOwner string) (string, error)
-	GetBook(bookToken string) (*models.BookData, error)
-	UpdateBook(bookFileToken string, updater models.BookDataUpdater) error
-	DeleteBook(tokenBook string) error
+	GetUnindexedFiles(ctx context.Context, now time.Time, limit int) ([]models.FileData, error)
+	MarkFileIndexed(ctx context.Context, token, indexError string) error
+	PostponeIndexing(ctx context.Context, token string, attempts int, lastError string, next time.Time) error
+	SavePages(ctx context.Context, fileToken string, pages []models.PageText) error
+	SearchPages(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.PageText, error)
+
+	GetListBooks(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error)
+	GetListBooksUser(ctx context.Context, filter models.Filter, sort models.Sort) ([]models.BookData, error)
+
+	CreateBook(ctx context.Context, title, description, fileToken, emailOwner string) (string, error)
+	GetBook(ctx context.Context, bookToken string) (*models.BookData, error)
+	UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editor string) error
+	UpdateBookCover(ctx context.Context, bookFileToken string, cover models.Cover) error
+	DeleteBook(ctx context.Context, tokenBook, ownerEmail string) error
+	GetTrash(ctx context.Context, ownerEmail string) ([]models.BookData, error)
+	RestoreBook(ctx context.Context, bookToken, ownerEmail string) error
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error)
+
+	GetBookVersions(ctx context.Context, bookToken string) ([]models.BookVersion, error)
+	GetBookVersion(ctx context.Context, bookToken string, version int) (*models.BookVersion, error)
+	RestoreBookVersion(ctx context.Context, bookToken string, version int, editor string) (string, error)
+
+	EnqueueOrphanFiles(ctx context.Context, createdBefore time.Time) (int, error)
+	GetFileDeletions(ctx context.Context, before time.Time, limit int) ([]models.FileDeletion, error)
+	IsFileReferenced(ctx context.Context, token string) (bool, error)
+	PostponeFileDeletion(ctx context.Context, token string, attempts int, lastError string, next time.Time) error
+	CompleteFileDeletion(ctx context.Context, token string) error
+	DropFileDeletion(ctx context.Context, token string) error
+
+	AcquireBlob(ctx context.Context, sha256 string) (*models.Blob, error)
+	CreateBlob(ctx context.Context, blob models.Blob) error
+	ReleaseBlob(ctx context.Context, sha256, storageToken string) (int, error)
+	ReleaseFile(ctx context.Context, token string) (string, int, error)
+	DeleteBlob(ctx context.Context, storageToken string) error
+	ForgetBlob(ctx context.Context, storageToken string) error
+
+	GetAllFileData(ctx context.Context) ([]models.FileData, error)
+	GetAllBooks(ctx context.Context) ([]models.BookData, error)
+	EnqueueFileDeletions(ctx context.Context, tokens ...string) error
 }
 
 type Storager interface {
-	GetServerToUpload() (string, error)
-	UploadFile(servForUpload string, file []byte, fileName string) (*models.FileData, error)
-	DeleteFile(fileToken string) error
+	Ping(ctx context.Context) error
+	GetServerToUpload(ctx context.Context) (string, error)
+	UploadFile(ctx context.Context, servForUpload, folderId string, file []byte, fileName, contentType string) (*models.FileData, error)
+	DeleteFile(ctx context.Context, fileToken string) error
+	OpenFile(ctx context.Context, fileToken string, size int64) (io.ReadSeekCloser, error)
+	CreateFolder(ctx context.Context, parentFolderId, name string) (string, error)
+	ListFolder(ctx context.Context, folderId string) ([]models.StoredFile, error)
+	StatFile(ctx context.Context, fileToken string) (*models.StoredFile, error)
+}
+
+type Thumbnailer interface {
+	RenderFirstPage(ctx context.Context, file []byte, width int) ([]byte, error)
 }
 
 type Hasher interface {
 	GetNewHash(password string) (string, error)
 	CompareHashWithPassword(password, hash string) error
+	// NeedsRehash reports whether the hash was made with another algorithm
+	// or weaker parameters than new hashes are.
+	NeedsRehash(hash string) bool
 }
 
 type Services struct {
@@ -44,44 +99,80 @@ type Services struct {
 	tokenEngine Tokener
 	hashEngine  Hasher
 	storage     Storager
+	thumbnailer Thumbnailer
+	indexWake   chan struct{}
+	userFolders bool
+	health      *health
+	logger      *slog.Logger
 }
 
-func New(db DB, tokener Tokener, storage Storager, hasher Hasher) *Services {
+func New(db DB, tokener Tokener, storage Storager, hasher Hasher, thumbnailer Thumbnailer, logger *slog.Logger) *Services {
 	return &Services{
 		db:          db,
 		tokenEngine: tokener,
 		hashEngine:  hasher,
 		storage:     storage,
+		thumbnailer: thumbnailer,
+		indexWake:   make(chan struct{}, 1),
+		health:      newHealth(),
+		logger:      logger,
 	}
 }
 
-func (s *Services) SignIn(user models.UserDataInput) (string, error) {
-	userCred, err := s.db.GetUserData(user.Email)
+func (s *Services) SignIn(ctx context.Context, user models.UserDataInput) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.SignIn")
+	defer span.End()
+
+	userCred, err := s.db.GetUserData(ctx, user.Email)
 	if err != nil {
+		metrics.IncLogins(false)
 		return "", fmt.Errorf("failed find user in db in sign in method, error: %w", err)
 	}
 	err = s.hashEngine.CompareHashWithPassword(user.Password, userCred.PasswordHash)
 	if err != nil {
+		metrics.IncLogins(false)
 		return "", fmt.Errorf("password isn't equal")
 	}
+	if s.hashEngine.NeedsRehash(userCred.PasswordHash) {
+		s.rehashPassword(ctx, userCred, user.Password)
+	}
 	accessToken, err := s.tokenEngine.GenAccessToken(userCred.Id)
 	if err != nil {
 		return "", fmt.Errorf("failed generate token in sign in method, error: %w", err)
 	}
+	metrics.IncLogins(true)
 
 	return accessToken, nil
 }
 
-func (s *Services) SignUp(user models.UserDataInput) (string, error) {
+// rehashPassword upgrades the stored hash while the password is at hand.
+// Failing to do so doesn't fail the sign in, the next one retries.
+func (s *Services) rehashPassword(ctx context.Context, user *models.UserData, password string) {
+	newHash, err := s.hashEngine.GetNewHash(password)
+	if err == nil {
+		err = s.db.UpdatePasswordHash(ctx, user.Email, user.PasswordHash, newHash)
+	}
+	if err != nil {
+		s.logger.WarnContext(ctx, "rehashing password failed", "user_id", user.Id, "error", err)
+		return
+	}
+	s.logger.InfoContext(ctx, "rehashed password", "user_id", user.Id)
+}
+
+func (s *Services) SignUp(ctx context.Context, user models.UserDataInput) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.SignUp")
+	defer span.End()
+
 	passwordHash, err := s.hashEngine.GetNewHash(user.Password)
 	if err != nil {
 		return "", fmt.Errorf("getting new hash of password failed, error: %w", err)
 	}
 
-	userId, err := s.db.CreateUser(user.Email, passwordHash)
+	userId, err := s.db.CreateUser(ctx, user.Email, passwordHash)
 	if err != nil {
 		return "", fmt.Errorf("create user DB proccess failed, error: %w", err)
 	}
+	metrics.IncSignups()
 
 	accessToken, err := s.tokenEngine.GenAccessToken(userId)
 	if err != nil {
@@ -91,16 +182,35 @@ func (s *Services) SignUp(user models.UserDataInput) (string, error) {
 	return accessToken, nil
 }
 
-func (s *Services) GetUserById(userId string) (*models.UserData, error) {
-	usData, err := s.db.GetUserDataById(userId)
+func (s *Services) GetUserById(ctx context.Context, userId string) (*models.UserData, error) {
+	ctx, span := tracing.Start(ctx, "services.GetUserById")
+	defer span.End()
+
+	usData, err := s.db.GetUserDataById(ctx, userId)
 	if err != nil {
 		return nil, fmt.Errorf("userData by user id fetch failed, error: %w", err)
 	}
 	return usData, nil
 }
 
-func (s *Services) CreateBook(title, description, fileToken, userEmail string) (string, error) {
-	fileToken, err := s.db.CreateBook(title, description, fileToken, userEmail)
+func (s *Services) CreateBook(ctx context.Context, title, description, fileToken, userEmail string) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.CreateBook")
+	defer span.End()
+
+	if title == "" || description == "" {
+		fileData, err := s.db.GetFileData(ctx, fileToken)
+		if err != nil {
+			return "", fmt.Errorf("getting file metadata failed, error: %w", err)
+		}
+		if title == "" {
+			title = fileData.Metadata.Title
+		}
+		if description == "" {
+			description = fileData.Metadata.Subject
+		}
+	}
+
+	fileToken, err := s.db.CreateBook(ctx, title, description, fileToken, userEmail)
 	if err != nil {
 		return "", fmt.Errorf("create book failed, error: %w", err)
 	}
@@ -108,48 +218,100 @@ func (s *Services) CreateBook(title, description, fileToken, userEmail string) (
 	return fileToken, nil
 }
 
-func (s *Services) UploadFile(file []byte, fileName string) (string, error) {
-	servForUpload, err := s.storage.GetServerToUpload()
+func (s *Services) UploadFile(ctx context.Context, file []byte, fileName, userEmail string) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.UploadFile")
+	defer span.End()
+
+	format, err := formats.Detect(file)
+	if err != nil {
+		return "", fmt.Errorf("detecting file format failed, error: %w", err)
+	}
+
+	meta, err := format.ExtractMetadata(file)
+	if err != nil {
+		return "", fmt.Errorf("extracting file metadata failed, error: %w", err)
+	}
+
+	folderId, err := s.uploadFolder(ctx, userEmail)
+	if err != nil {
+		return "", err
+	}
+
+	servForUpload, err := s.storage.GetServerToUpload(ctx)
 	if err != nil {
 		return "", fmt.Errorf("getting cell server for upload file failed, error: %w", err)
 	}
 
-	fileData, err := s.storage.UploadFile(servForUpload, file, fileName)
+	fileData, err := s.storeContent(ctx, servForUpload, folderId, file, fileName, format.MimeType)
 	if err != nil {
-		return "", fmt.Errorf("upload file to service failed, error: \n%w", err)
+		return "", err
+	}
+	recorded := false
+	defer func() {
+		if !recorded {
+			s.releaseUpload(ctx, fileData)
+		}
+	}()
+	fileData.MimeType = format.MimeType
+	fileData.Metadata = models.FileMetadata{
+		Pages:        meta.Pages,
+		Title:        meta.Title,
+		Author:       meta.Author,
+		Subject:      meta.Subject,
+		Keywords:     meta.Keywords,
+		CreationDate: meta.CreationDate,
+		Size:         meta.Size,
+	}
+	if format.MimeType == formats.MimePDF {
+		fileData.Covers = s.renderCovers(ctx, servForUpload, fileData.FolderId, fileData.Token, file, fileName)
 	}
 
-	err = s.db.UploadFileData(fileData)
+	err = s.db.UploadFileData(ctx, fileData)
 	if err != nil {
 		return "", fmt.Errorf("recording to db of uploaded file failed, error: %w", err)
 	}
+	recorded = true
+
+	metrics.AddUploadBytes(format.MimeType, len(file))
+	s.wakeIndexer()
 	return fileData.Token, nil
 }
 
-func (s *Services) GetBook(bookToken string) (*models.GetBookResponse, error) {
-	bookData, err := s.db.GetBook(bookToken)
+func (s *Services) GetBook(ctx context.Context, bookToken, userEmail string) (*models.GetBookResponse, error) {
+	ctx, span := tracing.Start(ctx, "services.GetBook")
+	defer span.End()
+
+	bookData, err := s.db.GetBook(ctx, bookToken)
 	if err != nil {
 		return nil, fmt.Errorf("get book in get book of service failed, error: %w", err)
 	}
+	if !canAccess(bookData, userEmail) {
+		return nil, models.ErrAccessDenied
+	}
 	return &models.GetBookResponse{
 		FileURL:     bookData.Url,
 		Title:       bookData.Title,
 		Description: bookData.Description,
+		CoverURL:    bookData.CoverUrl,
+		MimeType:    bookData.MimeType,
 	}, nil
 }
 
-func (s *Services) GetBooks(filter models.Filter, sorting models.Sort) (*[]models.BookData, error) {
+func (s *Services) GetBooks(ctx context.Context, filter models.Filter, sorting models.Sort) (*[]models.BookData, error) {
+	ctx, span := tracing.Start(ctx, "services.GetBooks")
+	defer span.End()
+
 	var books []models.BookData
 
 	if filter.Email == "" {
-		booksArr, err := s.db.GetListBooks(filter, sorting)
+		booksArr, err := s.db.GetListBooks(ctx, filter, sorting)
 		if err != nil {
 			return nil, fmt.Errorf("get list of books public, error: %w", err)
 		}
 		books = booksArr
 	}
 	if filter.Email != "" {
-		booksArr, err := s.db.GetListBooksUser(filter, sorting)
+		booksArr, err := s.db.GetListBooksUser(ctx, filter, sorting)
 		if err != nil {
 			return nil, fmt.Errorf("get list of books error: %w", err)
 		}
@@ -158,18 +320,141 @@ func (s *Services) GetBooks(filter models.Filter, sorting models.Sort) (*[]model
 	return &books, nil
 }
 
-func (s *Services) UpdateBook(bookFileToken string, updater models.BookDataUpdater) error {
-	err := s.db.UpdateBook(bookFileToken, updater)
+// UpdateBook saves a new revision of a book. Anyone who can see the book may
+// edit it, but only the owner decides whether it is private.
+func (s *Services) UpdateBook(ctx context.Context, bookFileToken string, updater models.BookDataUpdater, editorEmail string) error {
+	ctx, span := tracing.Start(ctx, "services.UpdateBook")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookFileToken)
+	if err != nil {
+		return fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !canAccess(book, editorEmail) {
+		return models.ErrAccessDenied
+	}
+	if updater.Private != nil && *updater.Private != book.Private && !isOwner(book, editorEmail) {
+		return models.ErrAccessDenied
+	}
+
+	err = s.db.UpdateBook(ctx, bookFileToken, updater, editorEmail)
 	if err != nil {
 		return fmt.Errorf("updating failed, error: %w", err)
 	}
 	return nil
 }
 
-func (s *Services) DeleteBook(bookId string) error {
-	err := s.db.DeleteBook(bookId)
+func (s *Services) GetBookVersions(ctx context.Context, bookToken, userEmail string) (*[]models.BookVersion, error) {
+	ctx, span := tracing.Start(ctx, "services.GetBookVersions")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !canAccess(book, userEmail) {
+		return nil, models.ErrAccessDenied
+	}
+
+	versions, err := s.db.GetBookVersions(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("get book versions failed, error: %w", err)
+	}
+	if !isOwner(book, userEmail) {
+		for i := range versions {
+			hideEditor(&versions[i])
+		}
+	}
+	return &versions, nil
+}
+
+func (s *Services) GetBookVersion(ctx context.Context, bookToken string, version int, userEmail string) (*models.BookVersion, error) {
+	ctx, span := tracing.Start(ctx, "services.GetBookVersion")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return nil, fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !canAccess(book, userEmail) {
+		return nil, models.ErrAccessDenied
+	}
+
+	v, err := s.db.GetBookVersion(ctx, bookToken, version)
+	if err != nil {
+		return nil, fmt.Errorf("get book version failed, error: %w", err)
+	}
+	if !isOwner(book, userEmail) {
+		hideEditor(v)
+	}
+	return v, nil
+}
+
+// hideEditor removes the email of whoever made a version, which only the
+// owner of the book may see.
+func hideEditor(v *models.BookVersion) {
+	v.Editor = ""
+}
+
+// RestoreBookVersion rolls a book back to an earlier version, which only its
+// owner may do.
+func (s *Services) RestoreBookVersion(ctx context.Context, bookToken string, version int, editorEmail string) (string, error) {
+	ctx, span := tracing.Start(ctx, "services.RestoreBookVersion")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookToken)
+	if err != nil {
+		return "", fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !isOwner(book, editorEmail) {
+		return "", models.ErrAccessDenied
+	}
+
+	fileToken, err := s.db.RestoreBookVersion(ctx, bookToken, version, editorEmail)
+	if err != nil {
+		return "", fmt.Errorf("restore book version failed, error: %w", err)
+	}
+	return fileToken, nil
+}
+
+// DeleteBook moves a book to the trash, which only its owner may do.
+func (s *Services) DeleteBook(ctx context.Context, bookId, userEmail string) error {
+	ctx, span := tracing.Start(ctx, "services.DeleteBook")
+	defer span.End()
+
+	book, err := s.db.GetBook(ctx, bookId)
+	if err != nil {
+		return fmt.Errorf("get book failed, error: %w", err)
+	}
+	if !isOwner(book, userEmail) {
+		return models.ErrAccessDenied
+	}
+
+	err = s.db.DeleteBook(ctx, bookId, userEmail)
 	if err != nil {
 		return fmt.Errorf("delete book was failed, error: %w", err)
 	}
 	return nil
 }
+
+func (s *Services) GetTrash(ctx context.Context, userEmail string) (*[]models.BookData, error) {
+	ctx, span := tracing.Start(ctx, "services.GetTrash")
+	defer span.End()
+
+	books, err := s.db.GetTrash(ctx, userEmail)
+	if err != nil {
+		return nil, fmt.Errorf("get trashed books failed, error: %w", err)
+	}
+	return &books, nil
+}
+
+func (s *Services) RestoreBook(ctx context.Context, bookToken, userEmail string) error {
+	ctx, span := tracing.Start(ctx, "services.RestoreBook")
+	defer span.End()
+
+	err := s.db.RestoreBook(ctx, bookToken, userEmail)
+	if err != nil {
+		return fmt.Errorf("restore book failed, error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"crud-books/metrics"
+	"crud-books/tracing"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultTimeout       = 30 * time.Second
+	defaultUploadTimeout = 10 * time.Minute
+	defaultMaxRetries    = 3
+	defaultRetryDelay    = 200 * time.Millisecond
+	maxRetryDelay        = 5 * time.Second
+
+	maxResponseSize = 1 << 20
+)
+
+type requestBuilder func(ctx context.Context) (*http.Request, error)
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// call sends an API request and decodes the JSON answer into out. Idempotent
+// calls are retried with exponential backoff while the error is transient.
+// Every attempt gets its own deadline and a fresh request from build, so
+// request bodies are never reused. Cancelling ctx stops the retries.
+func (s Storage) call(ctx context.Context, op string, timeout time.Duration, idempotent bool, build requestBuilder, out interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "storage."+op)
+	defer func(start time.Time) {
+		metrics.ObserveStorage(op, start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	if !s.breaker.allow() {
+		return fmt.Errorf("%s: %w", op, ErrCircuitOpen)
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += s.maxRetries
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleep(ctx, s.backoff(attempt)); sleepErr != nil {
+				break
+			}
+		}
+		err = s.callOnce(ctx, op, timeout, build, out)
+		if err == nil || !retryable(err) {
+			break
+		}
+	}
+
+	s.record(ctx, err)
+	return err
+}
+
+func (s Storage) callOnce(ctx context.Context, op string, timeout time.Duration, build requestBuilder, out interface{}) error {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := build(callCtx)
+	if err != nil {
+		return fmt.Errorf("%s building request failed: %v", op, err)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return sendError(ctx, op, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%s reading response failed: %v: %w", op, err, ErrUnavailable)
+	}
+
+	var status statusResponse
+	jsonErr := json.Unmarshal(body, &status)
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return &StatusError{Op: op, HTTPStatus: res.StatusCode, Status: status.Status}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("%s decoding response failed: %v: %w", op, jsonErr, ErrUnavailable)
+	}
+	if status.Status != "ok" {
+		return &StatusError{Op: op, HTTPStatus: res.StatusCode, Status: status.Status}
+	}
+
+	if out != nil {
+		err = json.Unmarshal(body, out)
+		if err != nil {
+			return fmt.Errorf("%s decoding response failed: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// stream is call for downloads: the successful response body is returned
+// open and its deadline is left to ctx.
+func (s Storage) stream(ctx context.Context, op string, build requestBuilder) (res *http.Response, err error) {
+	ctx, span := tracing.Start(ctx, "storage."+op)
+	defer func(start time.Time) {
+		metrics.ObserveStorage(op, start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	if !s.breaker.allow() {
+		return nil, fmt.Errorf("%s: %w", op, ErrCircuitOpen)
+	}
+
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleep(ctx, s.backoff(attempt)); sleepErr != nil {
+				break
+			}
+		}
+
+		res, err = s.streamOnce(ctx, op, build)
+		if err == nil {
+			s.record(ctx, nil)
+			return res, nil
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+
+	s.record(ctx, err)
+	return nil, err
+}
+
+func (s Storage) streamOnce(ctx context.Context, op string, build requestBuilder) (*http.Response, error) {
+	req, err := build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s building request failed: %v", op, err)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, sendError(ctx, op, err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		res.Body.Close()
+		return nil, &StatusError{Op: op, HTTPStatus: res.StatusCode}
+	}
+	return res, nil
+}
+
+// sendError wraps a transport error. When the caller gave up the error isn't
+// a sign of an outage, so it is neither retried nor counted by the breaker.
+// The request URL is left out, it may carry credentials.
+func sendError(ctx context.Context, op string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s sending request failed: %w", op, ctx.Err())
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return fmt.Errorf("%s sending request failed: %v: %w", op, err, ErrUnavailable)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// record feeds the outcome of a call to the circuit breaker. Errors caused by
+// the request itself or by rate limiting show that gofile is up. A call the
+// caller gave up on shows neither.
+func (s Storage) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		s.breaker.abandon()
+		return
+	}
+	if isOutage(err) {
+		s.breaker.failure()
+		return
+	}
+	s.breaker.success()
+}
+
+func (s Storage) backoff(attempt int) time.Duration {
+	delay := s.retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
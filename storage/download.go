@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crud-books/models"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentIdParamName = "contentId"
+	accountTokenCookie = "accountToken"
+)
+
+var urlGetContent = "https://api.gofile.io/getContent"
+
+const (
+	contentTypeFile   = "file"
+	contentTypeFolder = "folder"
+)
+
+type ContentEntry struct {
+	Id           string `json:"id"`
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	Link         string `json:"link"`
+	Size         int64  `json:"size"`
+	Md5          string `json:"md5"`
+	ParentFolder string `json:"parentFolder"`
+}
+
+type DataFromGetContentResponse struct {
+	ContentEntry
+	Contents map[string]ContentEntry `json:"contents"`
+}
+
+type GetContentResponse struct {
+	Status string                     `json:"status"`
+	Data   DataFromGetContentResponse `json:"data"`
+}
+
+// OpenFile returns the stored file as a seekable stream. Bytes are fetched
+// lazily with HTTP range requests, so seeking is cheap and only the requested
+// part is transferred. A non-positive size is looked up from the storage.
+// Reads stop once ctx is done.
+func (s Storage) OpenFile(ctx context.Context, fileToken string, size int64) (io.ReadSeekCloser, error) {
+	entry, err := s.getContent(ctx, fileToken)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = entry.Size
+	}
+
+	f := &remoteFile{ctx: ctx, storage: s, link: entry.Link, size: size}
+	if f.size <= 0 {
+		f.size, err = f.probeSize()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (s Storage) getContent(ctx context.Context, fileToken string) (*ContentEntry, error) {
+	content, err := s.getContentData(ctx, fileToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// the file itself, or its entry when the parent folder is returned
+	if content.Link != "" {
+		return &content.ContentEntry, nil
+	}
+	for _, entry := range content.Contents {
+		if entry.Id == fileToken && entry.Link != "" {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("download link of %s: %w", fileToken, ErrNotFound)
+}
+
+// StatFile describes a stored file, or returns nil when gofile doesn't have it.
+func (s Storage) StatFile(ctx context.Context, fileToken string) (*models.StoredFile, error) {
+	entry, err := s.getContent(ctx, fileToken)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.StoredFile{
+		Token:    entry.Id,
+		Name:     entry.Name,
+		FolderId: entry.ParentFolder,
+		Size:     entry.Size,
+		Md5:      entry.Md5,
+	}, nil
+}
+
+// ListFolder returns every file stored in folderId and its subfolders. An
+// empty folderId lists the configured folder.
+func (s Storage) ListFolder(ctx context.Context, folderId string) ([]models.StoredFile, error) {
+	if folderId == "" {
+		folderId = s.folderToken
+	}
+
+	var files []models.StoredFile
+	visited := map[string]bool{}
+	pending := []string{folderId}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		content, err := s.getContentData(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("listing folder %s: %w", id, err)
+		}
+		for _, entry := range content.Contents {
+			switch entry.Type {
+			case contentTypeFolder:
+				pending = append(pending, entry.Id)
+			case contentTypeFile:
+				parent := entry.ParentFolder
+				if parent == "" {
+					parent = id
+				}
+				files = append(files, models.StoredFile{
+					Token:    entry.Id,
+					Name:     entry.Name,
+					FolderId: parent,
+					Size:     entry.Size,
+					Md5:      entry.Md5,
+				})
+			}
+		}
+	}
+	return files, nil
+}
+
+func (s Storage) getContentData(ctx context.Context, contentId string) (*DataFromGetContentResponse, error) {
+	var content GetContentResponse
+	err := s.call(ctx, "getContent", s.timeout, true, func(ctx context.Context) (*http.Request, error) {
+		req, err := DoRequest(
+			http.MethodGet,
+			urlGetContent,
+			[]QueryParams{
+				{QueryParamName: contentIdParamName, QueryParamVal: contentId},
+			},
+			&bytes.Buffer{},
+		)
+		if err != nil {
+			return nil, err
+		}
+		// the key goes in a cookie, a query parameter ends up in error texts
+		req.AddCookie(&http.Cookie{Name: accountTokenCookie, Value: s.apiKey})
+		return req.WithContext(ctx), nil
+	}, &content)
+	if err != nil {
+		return nil, fmt.Errorf("error in getContent: %w", err)
+	}
+	return &content.Data, nil
+}
+
+type remoteFile struct {
+	ctx     context.Context
+	storage Storage
+	link    string
+	size    int64
+	offset  int64
+
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyOffset != f.offset {
+		err := f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyOffset += int64(n)
+	if err == io.EOF && f.offset < f.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+// open starts a download at the current offset.
+func (f *remoteFile) open() error {
+	f.Close()
+
+	res, err := f.get(fmt.Sprintf("bytes=%d-", f.offset))
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the range was ignored, skip to the offset
+		_, err = io.CopyN(io.Discard, res.Body, f.offset)
+		if err != nil {
+			res.Body.Close()
+			return fmt.Errorf("skipping to offset %d failed: %w", f.offset, err)
+		}
+	default:
+		res.Body.Close()
+		return fmt.Errorf("download failed with status %d", res.StatusCode)
+	}
+
+	f.body = res.Body
+	f.bodyOffset = f.offset
+	return nil
+}
+
+func (f *remoteFile) probeSize() (int64, error) {
+	res, err := f.get("bytes=0-0")
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes 0-0/12345
+		contentRange := res.Header.Get("Content-Range")
+		if i := strings.LastIndexByte(contentRange, '/'); i >= 0 {
+			size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+			if err == nil {
+				return size, nil
+			}
+		}
+	}
+	if res.StatusCode == http.StatusOK && res.ContentLength >= 0 {
+		return res.ContentLength, nil
+	}
+	return 0, fmt.Errorf("file size is unknown, status %d", res.StatusCode)
+}
+
+func (f *remoteFile) get(byteRange string) (*http.Response, error) {
+	return f.storage.stream(f.ctx, "download", func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.link, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", byteRange)
+		req.AddCookie(&http.Cookie{Name: accountTokenCookie, Value: f.storage.apiKey})
+		return req, nil
+	})
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrNotFound     = errors.New("storage: file not found")
+	ErrUnauthorized = errors.New("storage: unauthorized")
+	ErrRateLimited  = errors.New("storage: rate limited")
+	ErrUnavailable  = errors.New("storage: service unavailable")
+	ErrCircuitOpen  = errors.New("storage: circuit breaker is open")
+)
+
+// StatusError is returned when gofile answers with an HTTP error or a
+// non-ok status field. It unwraps to one of the sentinel errors above.
+type StatusError struct {
+	Op         string
+	HTTPStatus int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("%s failed with http status %d, gofile status %q", e.Op, e.HTTPStatus, e.Status)
+	}
+	return fmt.Sprintf("%s failed with http status %d", e.Op, e.HTTPStatus)
+}
+
+func (e *StatusError) Unwrap() error {
+	status := strings.ToLower(e.Status)
+	switch {
+	case strings.Contains(status, "notfound"):
+		return ErrNotFound
+	case strings.Contains(status, "token"), strings.Contains(status, "auth"), strings.Contains(status, "premium"):
+		return ErrUnauthorized
+	case strings.Contains(status, "ratelimit"):
+		return ErrRateLimited
+	}
+
+	switch {
+	case e.HTTPStatus == http.StatusNotFound:
+		return ErrNotFound
+	case e.HTTPStatus == http.StatusUnauthorized, e.HTTPStatus == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.HTTPStatus == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.HTTPStatus >= http.StatusInternalServerError, e.Status != "":
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// retryable reports whether repeating the call may succeed.
+func retryable(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrRateLimited)
+}
+
+// isOutage reports whether the error says something about gofile health
+// rather than about the request itself.
+func isOutage(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
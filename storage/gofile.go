@@ -2,23 +2,30 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"crud-books/config"
 	"crud-books/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/textproto"
 	"path/filepath"
 	"reflect"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 const (
 	tokenName     = "token"
 	contentIdName = "contentsId"
 	fileName      = "file"
+	folderIdName  = "folderId"
 
 	сontentTypeHeaderName = "Content-Type"
 	contentTypeJSON       = "application/json"
@@ -27,6 +34,7 @@ const (
 var (
 	urlGetServer          = "https://api.gofile.io/getServer"
 	urlDeleteFile         = "https://api.gofile.io/deleteContent"
+	urlCreateFolder       = "https://api.gofile.io/createFolder"
 	urlUploadFileTemplate = "https://%s.gofile.io/uploadFile"
 )
 
@@ -58,9 +66,32 @@ type DeleteFileRequest struct {
 	Token      string `json:"token"`
 }
 
+type CreateFolderRequest struct {
+	ParentFolderId string `json:"parentFolderId"`
+	FolderName     string `json:"folderName"`
+	Token          string `json:"token"`
+}
+
+type DataFromCreateFolderResponse struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CreateFolderResponse struct {
+	Status string                       `json:"status"`
+	Data   DataFromCreateFolderResponse `json:"data"`
+}
+
 type Storage struct {
-	apiKey string
-	client *http.Client
+	apiKey        string
+	folderToken   string
+	client        *http.Client
+	timeout       time.Duration
+	uploadTimeout time.Duration
+	maxRetries    int
+	retryDelay    time.Duration
+	breaker       *breaker
+	logger        *slog.Logger
 }
 
 type QueryParams struct {
@@ -86,31 +117,25 @@ func DoRequest(method, path string, queryParams []QueryParams, body *bytes.Buffe
 	return req, nil
 }
 
-func (s Storage) GetServerToUpload() (string, error) {
-	req, err := DoRequest(
-		http.MethodGet,
-		urlGetServer,
-		[]QueryParams{},
-		&bytes.Buffer{},
-	)
-	if err != nil {
-		return "", fmt.Errorf("error in request of getServerToUpload : %w", err)
-	}
-
-	res, err := s.client.Do(req)
+func (s Storage) GetServerToUpload(ctx context.Context) (string, error) {
+	var jBody ServerToUploadResponse
+	err := s.call(ctx, "getServer", s.timeout, true, func(ctx context.Context) (*http.Request, error) {
+		req, err := DoRequest(
+			http.MethodGet,
+			urlGetServer,
+			[]QueryParams{},
+			&bytes.Buffer{},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return req.WithContext(ctx), nil
+	}, &jBody)
 	if err != nil {
-		return "", fmt.Errorf("error when client send request in getServerToUpload: %w", err)
+		return "", fmt.Errorf("error in getServerToUpload: %w", err)
 	}
-
-	jsonRes, err := io.ReadAll(res.Body)
-	if err != nil {
-		return "", fmt.Errorf("error in reading body of req in getServerToUpload: %w", err)
-	}
-
-	jBody := ServerToUploadResponse{}
-	err = json.Unmarshal(jsonRes, &jBody)
-	if err != nil {
-		return "", fmt.Errorf("error in unmarshalling of req body in getServerToUpload: %w", err)
+	if jBody.Data.Server == "" {
+		return "", fmt.Errorf("error in getServerToUpload: empty server name: %w", ErrUnavailable)
 	}
 
 	serverAddress := fmt.Sprintf(urlUploadFileTemplate, jBody.Data.Server)
@@ -118,20 +143,26 @@ func (s Storage) GetServerToUpload() (string, error) {
 	return serverAddress, nil
 }
 
-func createPdfFormFile(w *multipart.Writer, filename string) (io.Writer, error) {
+// Ping checks that gofile answers API calls.
+func (s Storage) Ping(ctx context.Context) error {
+	_, err := s.GetServerToUpload(ctx)
+	return err
+}
+
+func createFormFile(w *multipart.Writer, filename, contentType string) (io.Writer, error) {
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, "file", filename))
-	h.Set("Content-Type", "application/pdf")
+	h.Set("Content-Type", contentType)
 
 	return w.CreatePart(h)
 }
 
-func getBodyWriter(fileName string, file []byte, apiKey string) (*bytes.Buffer, string, error) {
+func getBodyWriter(fileName, contentType string, file []byte, apiKey, folderId string) (*bytes.Buffer, string, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	defer writer.Close()
 
-	fileWriter, err := createPdfFormFile(writer, fileName)
+	fileWriter, err := createFormFile(writer, fileName, contentType)
 	if err != nil {
 		return body, "", err
 	}
@@ -146,55 +177,104 @@ func getBodyWriter(fileName string, file []byte, apiKey string) (*bytes.Buffer,
 		return body, "", err
 	}
 
+	if folderId != "" {
+		err = writer.WriteField(folderIdName, folderId)
+		if err != nil {
+			return body, "", err
+		}
+	}
+
 	return body, writer.FormDataContentType(), nil
 }
 
-func (s Storage) UploadFile(servForUpload string, file []byte, fileName string) (*models.FileData, error) {
-	body, contentType, err := getBodyWriter(filepath.Base(fileName), file, s.apiKey)
-	if err != nil {
-		return nil, fmt.Errorf("getbodywrite in uploadfile throw error: %w", err)
+// UploadFile stores the file in folderId, or in the configured folder when
+// folderId is empty. It isn't retried: gofile creates a new file for every
+// accepted request, so repeating an upload whose answer was lost would
+// duplicate it.
+func (s Storage) UploadFile(ctx context.Context, servForUpload, folderId string, file []byte, fileName, fileContentType string) (*models.FileData, error) {
+	if folderId == "" {
+		folderId = s.folderToken
 	}
 
-	req, err := DoRequest(
-		http.MethodPost,
-		servForUpload,
-		[]QueryParams{},
-		body,
-	)
+	var uploadResp UploadFileResponse
+	err := s.call(ctx, "uploadFile", s.uploadTimeout, false, func(ctx context.Context) (*http.Request, error) {
+		body, contentType, err := getBodyWriter(filepath.Base(fileName), fileContentType, file, s.apiKey, folderId)
+		if err != nil {
+			return nil, fmt.Errorf("getbodywrite in uploadfile throw error: %w", err)
+		}
+
+		req, err := DoRequest(
+			http.MethodPost,
+			servForUpload,
+			[]QueryParams{},
+			body,
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add(сontentTypeHeaderName, contentType)
+		return req.WithContext(ctx), nil
+	}, &uploadResp)
 	if err != nil {
-		return nil, fmt.Errorf("error in req of UploadFile: %w", err)
+		return nil, fmt.Errorf("error in uploadFile: %w", err)
+	}
+
+	if reflect.ValueOf(uploadResp.Data).IsZero() {
+		return nil, fmt.Errorf("upload file error, service storage unexpected response")
 	}
+	s.logger.DebugContext(ctx, "uploaded file", "file_id", uploadResp.Data.FileID, "folder_id", uploadResp.Data.ParentFolder)
 
-	req.Header.Add("Content-Type", contentType)
+	return &models.FileData{
+		Token:        uploadResp.Data.FileID,
+		DownloadPage: uploadResp.Data.DownloadPage,
+		MimeType:     fileContentType,
+		Md5:          uploadResp.Data.Md5,
+		FolderId:     uploadResp.Data.ParentFolder,
+	}, nil
+}
 
-	res, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("uploadFile func sending request failed: %w", err)
+// CreateFolder creates a folder named name inside parentFolderId, or inside
+// the configured folder when parentFolderId is empty, and returns its id.
+func (s Storage) CreateFolder(ctx context.Context, parentFolderId, name string) (string, error) {
+	if parentFolderId == "" {
+		parentFolderId = s.folderToken
 	}
 
-	jsonResponse, err := io.ReadAll(res.Body)
+	jsonBody, err := json.Marshal(CreateFolderRequest{
+		ParentFolderId: parentFolderId,
+		FolderName:     name,
+		Token:          s.apiKey,
+	})
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("error in marshal of create folder: %w", err)
 	}
-	log.Printf("upload file response : %s", jsonResponse)
 
-	var uploadResp UploadFileResponse
-	err = json.Unmarshal(jsonResponse, &uploadResp)
+	var folderResp CreateFolderResponse
+	err = s.call(ctx, "createFolder", s.timeout, false, func(ctx context.Context) (*http.Request, error) {
+		req, err := DoRequest(
+			http.MethodPut,
+			urlCreateFolder,
+			[]QueryParams{},
+			bytes.NewBuffer(jsonBody),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add(сontentTypeHeaderName, contentTypeJSON)
+		return req.WithContext(ctx), nil
+	}, &folderResp)
 	if err != nil {
-		return nil, fmt.Errorf("error in unmarshal of uploadfile: %w", err)
+		return "", fmt.Errorf("error in create folder: %w", err)
 	}
-
-	if reflect.ValueOf(uploadResp.Data).IsZero() {
-		return nil, fmt.Errorf("upload file error, service storage unexpected response")
+	if folderResp.Data.Id == "" {
+		return "", fmt.Errorf("create folder error, service storage unexpected response")
 	}
 
-	return &models.FileData{
-		Token:        uploadResp.Data.FileID,
-		DownloadPage: uploadResp.Data.DownloadPage,
-	}, nil
+	return folderResp.Data.Id, nil
 }
 
-func (s Storage) DeleteFile(fileToken string) error {
+// DeleteFile treats a missing file as deleted, so retries are safe.
+func (s Storage) DeleteFile(ctx context.Context, fileToken string) error {
 	j := DeleteFileRequest{
 		ContentsId: fileToken,
 		Token:      s.apiKey,
@@ -204,30 +284,65 @@ func (s Storage) DeleteFile(fileToken string) error {
 		return fmt.Errorf("error in marshal of delete file: %w", err)
 	}
 
-	req, err := DoRequest(
-		http.MethodDelete,
-		urlDeleteFile,
-		[]QueryParams{},
-		bytes.NewBuffer(jsonBody),
-	)
-	if err != nil {
-		return fmt.Errorf("error in request of delete file: %w", err)
+	err = s.call(ctx, "deleteContent", s.timeout, true, func(ctx context.Context) (*http.Request, error) {
+		req, err := DoRequest(
+			http.MethodDelete,
+			urlDeleteFile,
+			[]QueryParams{},
+			bytes.NewBuffer(jsonBody),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add(сontentTypeHeaderName, contentTypeJSON)
+		return req.WithContext(ctx), nil
+	}, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
 	}
-
-	req.Header.Add(сontentTypeHeaderName, contentTypeJSON)
-
-	_, err = s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error when sending response of delete file: %w", err)
+		return fmt.Errorf("error in delete file: %w", err)
 	}
 
 	return nil
 }
 
-func New(cfg *config.Config) *Storage {
+func New(cfg *config.Config, logger *slog.Logger) *Storage {
+	timeout := cfg.StorageTimeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	uploadTimeout := cfg.StorageUploadTimeout
+	if uploadTimeout <= 0 {
+		uploadTimeout = defaultUploadTimeout
+	}
+	maxRetries := cfg.StorageMaxRetries
+	if maxRetries < 0 {
+		maxRetries = defaultMaxRetries
+	}
+
 	s := Storage{
-		apiKey: cfg.GoFileServiceApiKey,
-		client: http.DefaultClient,
+		apiKey:      cfg.GoFileServiceApiKey,
+		folderToken: cfg.GoFileFolderToken,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(&http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   10 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: timeout,
+				IdleConnTimeout:       90 * time.Second,
+				MaxIdleConnsPerHost:   10,
+			}),
+		},
+		timeout:       timeout,
+		uploadTimeout: uploadTimeout,
+		maxRetries:    maxRetries,
+		retryDelay:    defaultRetryDelay,
+		breaker:       newBreaker(breakerThreshold, breakerCooldown),
+		logger:        logger,
 	}
 	return &s
 }
@@ -1,20 +1,32 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"crud-books/config"
+	"crud-books/models"
+	"crud-books/tracing"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
 var defaultConfig = config.Config{
 	GoFileServiceApiKey: "123",
 	GoFileFolderToken:   "123",
@@ -49,14 +61,14 @@ func getServerToUploadHandler(t *testing.T, url string) http.Handler {
 }
 
 func Test_Service_GetServerToUpload(t *testing.T) {
-	s := New(&defaultConfig)
+	s := New(&defaultConfig, testLogger)
 
 	const urlToUpload = "store3"
 
 	mockGetToUploadServ := getTestServer(getServerToUploadHandler(t, urlToUpload))
 
 	urlGetServer = mockGetToUploadServ.URL
-	serv, err := s.GetServerToUpload()
+	serv, err := s.GetServerToUpload(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, fmt.Sprintf("https://%s.gofile.io/uploadFile", urlToUpload), serv)
 }
@@ -68,6 +80,7 @@ func uploadFileServerHandler(t *testing.T, fileBytesToCompare []byte, testDataSt
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, fileHeader, _ := r.FormFile("file")
 		assert.Equal(t, "file.pdf", fileHeader.Filename)
+		assert.Equal(t, "application/pdf", fileHeader.Header.Get("Content-Type"))
 
 		file, _ := fileHeader.Open()
 		fileBody, _ := io.ReadAll(file)
@@ -94,7 +107,7 @@ func Test_Service_UploadFile(t *testing.T) {
 		},
 	}
 
-	s := New(&defaultConfig)
+	s := New(&defaultConfig, testLogger)
 	file, err := os.Open("./testsData/file.pdf")
 
 	require.NoError(t, err)
@@ -105,11 +118,12 @@ func Test_Service_UploadFile(t *testing.T) {
 
 	mockUploadServer := getTestServer(uploadFileServerHandler(t, fileBytes, testData))
 
-	got, err := s.UploadFile(mockUploadServer.URL, fileBytes, file.Name())
+	got, err := s.UploadFile(context.Background(), mockUploadServer.URL, "", fileBytes, file.Name(), "application/pdf")
 
 	require.NoError(t, err)
 	assert.Equal(t, "https://gofile.io/d/Z19n9a", got.DownloadPage)
 	assert.Equal(t, fileId, got.Token)
+	assert.Equal(t, testData.Data.Md5, got.Md5)
 }
 
 func deleteFileHandler(t *testing.T) http.Handler {
@@ -121,16 +135,410 @@ func deleteFileHandler(t *testing.T) http.Handler {
 		require.NoError(t, err)
 		assert.Equal(t, testDeleteFileData.ContentsId, reqBody.ContentsId)
 		assert.Equal(t, testDeleteFileData.Token, reqBody.Token)
+		_, err = w.Write([]byte(`{"status":"ok"}`))
+		require.NoError(t, err)
 	})
 	// handlerHelper(t, testData)
 }
 
 func Test_DeleteFile(t *testing.T) {
-	s := New(&defaultConfig)
+	s := New(&defaultConfig, testLogger)
 
 	mockServ := getTestServer(deleteFileHandler(t))
 
 	urlDeleteFile = mockServ.URL
-	err := s.DeleteFile(testDeleteFileData.ContentsId)
+	err := s.DeleteFile(context.Background(), testDeleteFileData.ContentsId)
+	require.NoError(t, err)
+}
+
+func newTestStorage() *Storage {
+	s := New(&defaultConfig, testLogger)
+	s.maxRetries = defaultMaxRetries
+	s.retryDelay = time.Millisecond
+	return s
+}
+
+func Test_DeleteFile_ServerError(t *testing.T) {
+	s := newTestStorage()
+
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	urlDeleteFile = mockServ.URL
+	err := s.DeleteFile(context.Background(), testDeleteFileData.ContentsId)
+	require.Error(t, err)
+}
+
+func Test_OpenFile(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	fileServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(accountTokenCookie)
+		require.NoError(t, err)
+		assert.Equal(t, defaultConfig.GoFileServiceApiKey, cookie.Value)
+		http.ServeContent(w, r, "file.pdf", time.Time{}, bytes.NewReader(content))
+	}))
+
+	contentServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "file", r.URL.Query().Get(contentIdParamName))
+		assert.Empty(t, r.URL.Query().Get(tokenName))
+		cookie, err := r.Cookie(accountTokenCookie)
+		require.NoError(t, err)
+		assert.Equal(t, defaultConfig.GoFileServiceApiKey, cookie.Value)
+		json.NewEncoder(w).Encode(GetContentResponse{
+			Status: "ok",
+			Data: DataFromGetContentResponse{
+				Contents: map[string]ContentEntry{
+					"file": {Id: "file", Type: "file", Link: fileServ.URL},
+				},
+			},
+		})
+	}))
+	urlGetContent = contentServ.URL
+
+	s := New(&defaultConfig, testLogger)
+	f, err := s.OpenFile(context.Background(), "file", 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	_, err = f.Seek(10, io.SeekStart)
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "abcde", string(buf))
+
+	_, err = f.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content[2:], rest)
+}
+
+func Test_DeleteFile_NotFound(t *testing.T) {
+	s := newTestStorage()
+
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := w.Write([]byte(`{"status":"error-notFound"}`))
+		require.NoError(t, err)
+	}))
+
+	urlDeleteFile = mockServ.URL
+	err := s.DeleteFile(context.Background(), testDeleteFileData.ContentsId)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_GetServerToUpload_Retries(t *testing.T) {
+	s := newTestStorage()
+
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(ServerToUploadResponse{
+			Status: "ok",
+			Data:   DataFromServerToUploadResponse{Server: "store1"},
+		})
+	}))
+
+	urlGetServer = mockServ.URL
+	serv, err := s.GetServerToUpload(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "https://store1.gofile.io/uploadFile", serv)
+	assert.Equal(t, 3, calls)
+}
+
+func Test_GetServerToUpload_Unauthorized(t *testing.T) {
+	s := newTestStorage()
+
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := w.Write([]byte(`{"status":"error-wrongToken"}`))
+		require.NoError(t, err)
+	}))
+
+	urlGetServer = mockServ.URL
+	_, err := s.GetServerToUpload(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_UploadFile_NotRetried(t *testing.T) {
+	s := newTestStorage()
+
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	_, err := s.UploadFile(context.Background(), mockServ.URL, "", []byte("text"), "file.txt", "text/plain")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	s := newTestStorage()
+	s.maxRetries = 0
+	now := time.Now()
+	s.breaker.now = func() time.Time { return now }
+
+	failing := true
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, err := w.Write([]byte(`{"status":"ok"}`))
+		require.NoError(t, err)
+	}))
+	urlDeleteFile = mockServ.URL
+
+	for i := 0; i < breakerThreshold; i++ {
+		assert.ErrorIs(t, s.DeleteFile(context.Background(), "file"), ErrUnavailable)
+	}
+	assert.ErrorIs(t, s.DeleteFile(context.Background(), "file"), ErrCircuitOpen)
+	assert.Equal(t, breakerThreshold, calls)
+
+	failing = false
+	now = now.Add(breakerCooldown)
+	require.NoError(t, s.DeleteFile(context.Background(), "file"))
+	require.NoError(t, s.DeleteFile(context.Background(), "file"))
+	assert.Equal(t, breakerThreshold+2, calls)
+}
+
+func Test_CircuitBreaker_CancelledProbe(t *testing.T) {
+	s := newTestStorage()
+	s.maxRetries = 0
+	now := time.Now()
+	s.breaker.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failing := true
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// the probe is abandoned before gofile answers
+		cancel()
+		<-r.Context().Done()
+	}))
+	urlDeleteFile = mockServ.URL
+
+	for i := 0; i < breakerThreshold; i++ {
+		assert.ErrorIs(t, s.DeleteFile(context.Background(), "file"), ErrUnavailable)
+	}
+
+	failing = false
+	now = now.Add(breakerCooldown)
+	assert.ErrorIs(t, s.DeleteFile(ctx, "file"), context.Canceled)
+
+	// the breaker stays open, but lets the next probe through
+	assert.False(t, s.breaker.probing)
+	assert.GreaterOrEqual(t, s.breaker.failures, breakerThreshold)
+	failing = true
+	assert.ErrorIs(t, s.DeleteFile(context.Background(), "file"), ErrUnavailable)
+	assert.Equal(t, breakerThreshold+2, calls)
+}
+
+func Test_StatusError(t *testing.T) {
+	tests := []struct {
+		err  *StatusError
+		want error
+	}{
+		{&StatusError{HTTPStatus: http.StatusOK, Status: "error-notFound"}, ErrNotFound},
+		{&StatusError{HTTPStatus: http.StatusOK, Status: "error-notPremium"}, ErrUnauthorized},
+		{&StatusError{HTTPStatus: http.StatusOK, Status: "error-rateLimit"}, ErrRateLimited},
+		{&StatusError{HTTPStatus: http.StatusOK, Status: "error-unknown"}, ErrUnavailable},
+		{&StatusError{HTTPStatus: http.StatusNotFound}, ErrNotFound},
+		{&StatusError{HTTPStatus: http.StatusForbidden}, ErrUnauthorized},
+		{&StatusError{HTTPStatus: http.StatusTooManyRequests}, ErrRateLimited},
+		{&StatusError{HTTPStatus: http.StatusBadGateway}, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		assert.ErrorIs(t, tt.err, tt.want, tt.err.Error())
+	}
+}
+
+func Test_UploadFile_Folder(t *testing.T) {
+	s := newTestStorage()
+
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, defaultConfig.GoFileFolderToken, r.FormValue(folderIdName))
+		json.NewEncoder(w).Encode(UploadFileResponse{
+			Status: "ok",
+			Data:   DataFromUploadFileResponse{FileID: "file", ParentFolder: r.FormValue(folderIdName)},
+		})
+	}))
+
+	got, err := s.UploadFile(context.Background(), mockServ.URL, "", []byte("text"), "file.txt", "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, defaultConfig.GoFileFolderToken, got.FolderId)
+}
+
+func Test_CreateFolder(t *testing.T) {
+	s := newTestStorage()
+
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var req CreateFolderRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, defaultConfig.GoFileFolderToken, req.ParentFolderId)
+		assert.Equal(t, "user-1", req.FolderName)
+		json.NewEncoder(w).Encode(CreateFolderResponse{
+			Status: "ok",
+			Data:   DataFromCreateFolderResponse{Id: "sub", Name: req.FolderName},
+		})
+	}))
+	urlCreateFolder = mockServ.URL
+
+	id, err := s.CreateFolder(context.Background(), "", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "sub", id)
+}
+
+func Test_ListFolder(t *testing.T) {
+	s := newTestStorage()
+
+	folders := map[string]map[string]ContentEntry{
+		defaultConfig.GoFileFolderToken: {
+			"a":   {Id: "a", Type: contentTypeFile, Name: "a.pdf", Size: 3, Md5: "md5a"},
+			"sub": {Id: "sub", Type: contentTypeFolder, Name: "user-1"},
+		},
+		"sub": {
+			"b": {Id: "b", Type: contentTypeFile, Name: "b.pdf", ParentFolder: "sub"},
+		},
+	}
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, ok := folders[r.URL.Query().Get(contentIdParamName)]
+		require.True(t, ok)
+		json.NewEncoder(w).Encode(GetContentResponse{
+			Status: "ok",
+			Data:   DataFromGetContentResponse{Contents: contents},
+		})
+	}))
+	urlGetContent = mockServ.URL
+
+	files, err := s.ListFolder(context.Background(), "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.StoredFile{
+		{Token: "a", Name: "a.pdf", FolderId: defaultConfig.GoFileFolderToken, Size: 3, Md5: "md5a"},
+		{Token: "b", Name: "b.pdf", FolderId: "sub"},
+	}, files)
+}
+
+func Test_StatFile(t *testing.T) {
+	s := newTestStorage()
+
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(contentIdParamName) != "file" {
+			_, err := w.Write([]byte(`{"status":"error-notFound"}`))
+			require.NoError(t, err)
+			return
+		}
+		json.NewEncoder(w).Encode(GetContentResponse{
+			Status: "ok",
+			Data: DataFromGetContentResponse{
+				ContentEntry: ContentEntry{Id: "file", Type: contentTypeFile, Name: "a.pdf", Link: "http://link", Size: 3},
+			},
+		})
+	}))
+	urlGetContent = mockServ.URL
+
+	info, err := s.StatFile(context.Background(), "file")
+	require.NoError(t, err)
+	assert.Equal(t, &models.StoredFile{Token: "file", Name: "a.pdf", Size: 3}, info)
+
+	info, err = s.StatFile(context.Background(), "gone")
 	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func Test_SendError_HidesKey(t *testing.T) {
+	cfg := defaultConfig
+	cfg.GoFileServiceApiKey = "SECRETKEY"
+	s := New(&cfg, testLogger)
+	s.retryDelay = time.Millisecond
+
+	// a closed server refuses the connection, the transport error would
+	// otherwise quote the full request URL
+	mockServ := getTestServer(http.NotFoundHandler())
+	mockServ.Close()
+	urlGetContent = mockServ.URL
+
+	_, err := s.StatFile(context.Background(), "file")
+	require.ErrorIs(t, err, ErrUnavailable)
+	assert.NotContains(t, err.Error(), cfg.GoFileServiceApiKey)
+}
+
+func Test_Call_Cancelled(t *testing.T) {
+	s := newTestStorage()
+	s.retryDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		cancel()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	urlGetServer = mockServ.URL
+	_, err := s.GetServerToUpload(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Call_Traced(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(tracing.NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	s := newTestStorage()
+
+	var traceparents []string
+	mockServ := getTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		if len(traceparents) < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(ServerToUploadResponse{
+			Status: "ok",
+			Data:   DataFromServerToUploadResponse{Server: "store1"},
+		})
+	}))
+
+	urlGetServer = mockServ.URL
+	_, err = s.GetServerToUpload(context.Background())
+	require.NoError(t, err)
+
+	// one client span per attempt under the span of the operation
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	op := spans[2]
+	assert.Equal(t, "storage.getServer", op.Name)
+	for i, attempt := range spans[:2] {
+		assert.Equal(t, op.SpanContext.SpanID(), attempt.Parent.SpanID())
+		assert.Contains(t, traceparents[i], op.SpanContext.TraceID().String())
+	}
 }
@@ -0,0 +1,65 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"crud-books/config"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBinary  = "pdftoppm"
+	defaultTimeout = 30 * time.Second
+)
+
+// Pdftoppm renders pages with the poppler-utils pdftoppm tool which has to be
+// installed in the container.
+type Pdftoppm struct {
+	binary  string
+	timeout time.Duration
+}
+
+func New(cfg *config.Config) *Pdftoppm {
+	binary := cfg.PdftoppmPath
+	if binary == "" {
+		binary = defaultBinary
+	}
+	return &Pdftoppm{
+		binary:  binary,
+		timeout: defaultTimeout,
+	}
+}
+
+// RenderFirstPage renders the first page of a PDF as a PNG image of the given
+// width. The tool is killed once ctx is done or the timeout elapses.
+func (p Pdftoppm) RenderFirstPage(ctx context.Context, file []byte, width int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.binary,
+		"-png",
+		"-f", "1",
+		"-l", "1",
+		"-singlefile",
+		"-scale-to-x", strconv.Itoa(width),
+		"-scale-to-y", "-1",
+		"-",
+	)
+	cmd.Stdin = bytes.NewReader(file)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %w, stderr: %s", err, stderr.String())
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("pdftoppm returned empty image")
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package thumbnail
+
+import (
+	"context"
+	"crud-books/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeBinary(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "pdftoppm")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755)
+	require.NoError(t, err)
+	return path
+}
+
+func Test_RenderFirstPage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		bin := fakeBinary(t, `cat > /dev/null; printf 'png %s' "$*"`)
+		p := New(&config.Config{PdftoppmPath: bin})
+
+		got, err := p.RenderFirstPage(context.Background(), []byte("%PDF-1.4"), 160)
+		require.NoError(t, err)
+		assert.Equal(t, "png -png -f 1 -l 1 -singlefile -scale-to-x 160 -scale-to-y -1 -", string(got))
+	})
+
+	t.Run("tool_failed", func(t *testing.T) {
+		bin := fakeBinary(t, `echo "Syntax Error" >&2; exit 1`)
+		p := New(&config.Config{PdftoppmPath: bin})
+
+		_, err := p.RenderFirstPage(context.Background(), []byte("%PDF-1.4"), 160)
+		assert.ErrorContains(t, err, "Syntax Error")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		bin := fakeBinary(t, `exec sleep 10`)
+		p := New(&config.Config{PdftoppmPath: bin})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := p.RenderFirstPage(ctx, []byte("%PDF-1.4"), 160)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
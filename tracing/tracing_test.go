@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"crud-books/config"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	traceparent = "00-" + traceID + "-00f067aa0ba902b7-01"
+)
+
+func newRecorder(t *testing.T, sampleRatio float64) *tracetest.InMemoryExporter {
+	_, err := Setup(context.Background(), &config.Config{TracingExporter: ExporterNone})
+	require.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), sampleRatio))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return exporter
+}
+
+func attr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func Test_Setup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{name: "off by default", exporter: ""},
+		{name: "none", exporter: ExporterNone},
+		{name: "unknown", exporter: "zipkin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), &config.Config{TracingExporter: tt.exporter})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func Test_StartEnd(t *testing.T) {
+	exporter := newRecorder(t, 1)
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", attribute.String("op", "test"))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "test", attr(spans[0], "op").AsString())
+	assert.Len(t, spans[0].Events, 1)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+}
+
+func Test_NewProvider_Sampling(t *testing.T) {
+	exporter := newRecorder(t, 0)
+
+	_, span := Start(context.Background(), "dropped")
+	span.End()
+	assert.Empty(t, exporter.GetSpans())
+
+	// a sampled caller keeps its decision
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, span = Start(trace.ContextWithRemoteSpanContext(context.Background(), remote), "kept")
+	span.End()
+	assert.Len(t, exporter.GetSpans(), 1)
+}
+
+func Test_Middleware(t *testing.T) {
+	exporter := newRecorder(t, 1)
+
+	var inner trace.SpanContext
+	e := echo.New()
+	e.Use(Middleware)
+	e.GET("/books/:id", func(c echo.Context) error {
+		inner = trace.SpanContextFromContext(c.Request().Context())
+		if c.Param("id") == "broken" {
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		return c.String(http.StatusOK, "")
+	})
+
+	t.Run("continues incoming trace", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/books/1", nil)
+		req.Header.Set("traceparent", traceparent)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		span := spans[0]
+		assert.Equal(t, "GET /books/:id", span.Name)
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+		assert.Equal(t, traceID, span.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+		assert.Equal(t, span.SpanContext.SpanID(), inner.SpanID())
+		assert.Equal(t, "/books/:id", attr(span, "http.route").AsString())
+		assert.Equal(t, int64(http.StatusOK), attr(span, "http.response.status_code").AsInt64())
+		assert.Equal(t, codes.Unset, span.Status.Code)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		exporter.Reset()
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/books/broken", nil))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.False(t, spans[0].Parent.IsValid())
+		assert.Equal(t, int64(http.StatusInternalServerError), attr(spans[0], "http.response.status_code").AsInt64())
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}